@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -10,23 +12,31 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/jaeger"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/propagation"
 
+	"github.com/sanketny8/ai-gateway-microservices/pkg/buildinfo"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/config"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/router"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/tracing"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
 )
 
 func main() {
+	// Load configuration: CONFIG_FILE (optional), then environment overrides
+	cfg, err := config.LoadConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Initialize tracing
-	tp, err := initTracer()
+	tp, err := initTracer(cfg.Tracing)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -36,63 +46,238 @@ func main() {
 		}
 	}()
 
-	// Initialize cache
-	redisCache, err := cache.NewRedisCache(
-		getEnv("REDIS_ADDR", "localhost:6379"),
-		getEnv("REDIS_PASSWORD", ""),
-		0,
-		5*time.Minute,
-	)
-	if err != nil {
-		log.Printf("Warning: Redis cache disabled: %v", err)
-		redisCache = nil
+	// Initialize cache. Only assign the interface on success, so a failed
+	// Redis connection leaves caching disabled rather than holding a nil
+	// *RedisCache.
+	var responseCache cache.Cache
+	var redisCache *cache.RedisCache
+	if cfg.Cache.Backend == config.BackendMemory {
+		responseCache = cache.NewInMemoryCache(cfg.Cache.MaxEntries, cfg.Cache.TTL)
+		log.Printf("✓ In-memory cache enabled (%d entries)", cfg.Cache.MaxEntries)
+	} else {
+		redisCache, err = cache.NewRedisCache(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, cfg.Cache.TTL)
+		if err != nil {
+			log.Printf("Warning: Redis cache disabled: %v", err)
+		} else {
+			responseCache = redisCache
+		}
 	}
 
-	// Initialize rate limiter (100 requests per user per minute)
-	rateLimiter := ratelimit.NewRateLimiter(100, 100.0/60.0)
+	// Initialize per-user rate limiter
+	rateLimiter, closeLimiter := newRateLimiter(cfg.RateLimit, cfg.RateLimit.Capacity, cfg.RateLimit.RefillRate)
+	defer closeLimiter()
 
 	// Initialize router
-	gwRouter := router.NewRouter(redisCache, rateLimiter)
+	gwRouter := router.NewRouter(responseCache, rateLimiter)
+	var keyLimiter ratelimit.Limiter
+	if perKey := cfg.RateLimit.PerKey; perKey.Capacity > 0 {
+		var closeKeyLimiter func()
+		keyLimiter, closeKeyLimiter = newRateLimiter(cfg.RateLimit, perKey.Capacity, perKey.RefillRate)
+		defer closeKeyLimiter()
+		gwRouter.SetKeyRateLimiter(keyLimiter)
+	}
+	gwRouter.SetLogger(middleware.GetLogger(), cfg.Logging.LLMContent)
+	gwRouter.SetEmbeddingBatching(router.EmbeddingBatching{
+		BatchSize:      cfg.Embeddings.BatchSize,
+		MaxConcurrency: cfg.Embeddings.MaxConcurrency,
+	})
+	gwRouter.SetStreamTimeouts(router.StreamTimeouts{
+		FirstToken: cfg.Providers.StreamFirstTokenTimeout,
+		Idle:       cfg.Providers.StreamIdleTimeout,
+	})
+	gwRouter.SetShadow(router.ShadowConfig{
+		Provider:    cfg.Shadow.Provider,
+		Model:       cfg.Shadow.Model,
+		SampleRate:  cfg.Shadow.SampleRate,
+		Timeout:     cfg.Shadow.Timeout,
+		MaxInFlight: cfg.Shadow.MaxInFlight,
+	})
+	if len(cfg.Filters.BannedPhrases) > 0 {
+		gwRouter.AddRequestFilter(router.NewBannedPhraseFilter(cfg.Filters.BannedPhrases))
+	}
+	if len(cfg.Filters.RedactPatterns) > 0 {
+		redaction, err := router.NewRedactionFilter(cfg.Filters.RedactPatterns, cfg.Filters.Redaction)
+		if err != nil {
+			log.Fatalf("Failed to create redaction filter: %v", err)
+		}
+		gwRouter.AddResponseFilter(redaction)
+	}
+	for prefix, ttl := range cfg.Cache.TTLOverrides {
+		gwRouter.SetCacheTTL(prefix, ttl)
+	}
+	gwRouter.SetPerUserCache(cfg.Cache.PerUser)
+	gwRouter.SetStaleCache(cfg.Cache.StaleTTL)
+	for name, defaults := range cfg.Providers.Defaults {
+		gwRouter.SetProviderDefaults(name, router.ProviderDefaults{
+			MaxTokens:    defaults.MaxTokens,
+			Temperature:  defaults.Temperature,
+			ModelAliases: defaults.ModelAliases,
+		})
+	}
+
+	// Initialize usage tracking: live counters in Redis, and optionally a
+	// history in Postgres
+	var usageTracker *usage.UsageTracker
+	var usageHistory *usage.PostgresUsageStore
+	var usageWriter *usage.UsageWriter
+	var budget *usage.BudgetLimit
+	var usageStores []usage.UsageStore
+	if redisCache != nil {
+		usageTracker = usage.NewUsageTracker(redisCache.Client(), cfg.Prices)
+		usageStores = append(usageStores, usageTracker)
+
+		// Always installed so budgets can be enabled by a reload; a cap of
+		// 0 is unlimited
+		budget = usage.NewBudgetLimit(usageTracker, cfg.MonthlyBudgetUSD)
+		gwRouter.SetBudgetLimit(budget)
+	}
+	if cfg.Usage.PostgresDSN != "" {
+		var err error
+		if usageHistory, err = usage.OpenPostgresUsageStore(cfg.Usage.PostgresDSN, cfg.Prices); err != nil {
+			log.Fatalf("Failed to open usage history: %v", err)
+		}
+		defer usageHistory.Close()
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := usageHistory.Migrate(migrateCtx); err != nil {
+			log.Fatalf("Failed to open usage history: %v", err)
+		}
+		cancelMigrate()
+		usageStores = append(usageStores, usageHistory)
+		log.Println("✓ Usage history stored in Postgres")
+	}
+	if len(usageStores) > 0 && cfg.Usage.BufferSize > 0 {
+		// Usage is written in batches off the request path
+		usageWriter = usage.NewUsageWriter(usage.MultiStore(usageStores...), usage.WriterConfig{
+			BufferSize:    cfg.Usage.BufferSize,
+			BatchSize:     cfg.Usage.BatchSize,
+			FlushInterval: cfg.Usage.FlushInterval,
+		})
+		gwRouter.SetUsageTracker(usageWriter)
+	} else if usageTracker != nil {
+		gwRouter.SetUsageTracker(usageTracker)
+	}
 
-	// Register providers
-	if openaiKey := os.Getenv("OPENAI_API_KEY"); openaiKey != "" {
-		gwRouter.RegisterProvider("openai", providers.NewOpenAIProvider(openaiKey))
+	// The live Redis counters are preferred for the current day and month
+	var usageStats usage.StatsReader
+	var history usage.UsageHistory
+	if usageTracker != nil {
+		usageStats = usageTracker
+	}
+	if usageHistory != nil {
+		history = usageHistory
+		if usageStats == nil {
+			usageStats = usageHistory
+		}
+	}
+	gwRouter.SetUsageReporting(usageStats, history)
+
+	// Register providers. They share one transport, and so one pool of
+	// keep-alive connections.
+	providerCfg := cfg.Providers
+	transport := providers.WithTransport(providers.NewTransport(providers.TransportConfig{
+		MaxIdleConnsPerHost: providerCfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     providerCfg.MaxConnsPerHost,
+		IdleConnTimeout:     providerCfg.IdleConnTimeout,
+	}))
+	// Retries of all providers are drawn from one budget
+	var retries *providers.RetryBudget
+	if providerCfg.RetryBudget.Capacity > 0 {
+		retries = providers.NewRetryBudget(providerCfg.RetryBudget.Capacity, providerCfg.RetryBudget.RefillRate)
+		retries.Observe(middleware.RecordRetryBudget)
+	}
+	retryBudget := providers.WithRetryBudget(retries)
+	// A self-hosted OpenAI-compatible server may not need an API key
+	if providerCfg.OpenAI.APIKey != "" || providerCfg.OpenAI.BaseURL != "" {
+		gwRouter.RegisterProvider("openai", providers.NewOpenAIProvider(providerCfg.OpenAI.APIKey,
+			providers.WithTimeout(providerCfg.Timeout), transport, retryBudget, providers.WithBaseURL(providerCfg.OpenAI.BaseURL),
+			providers.WithReasoningModels(providerCfg.OpenAI.ReasoningModels)))
 		log.Println("✓ OpenAI provider registered")
 	}
-	if anthropicKey := os.Getenv("ANTHROPIC_API_KEY"); anthropicKey != "" {
-		gwRouter.RegisterProvider("anthropic", providers.NewAnthropicProvider(anthropicKey))
+	if providerCfg.Anthropic.APIKey != "" {
+		gwRouter.RegisterProvider("anthropic", providers.NewAnthropicProvider(providerCfg.Anthropic.APIKey,
+			providers.WithTimeout(providerCfg.Timeout), transport, retryBudget, providers.WithBaseURL(providerCfg.Anthropic.BaseURL),
+			providers.WithStrictParameters(providerCfg.StrictParameters)))
 		log.Println("✓ Anthropic provider registered")
 	}
+	if providerCfg.Gemini.APIKey != "" {
+		gwRouter.RegisterProvider("gemini", providers.NewGeminiProvider(providerCfg.Gemini.APIKey,
+			providers.WithTimeout(providerCfg.Timeout), transport, retryBudget, providers.WithBaseURL(providerCfg.Gemini.BaseURL)))
+		log.Println("✓ Gemini provider registered")
+	}
+	if azureCfg := providerCfg.Azure; azureCfg.Endpoint != "" {
+		azure := providers.NewAzureOpenAIProvider(
+			azureCfg.Endpoint,
+			azureCfg.APIKey,
+			azureCfg.APIVersion,
+			azureCfg.Deployments,
+			providers.WithTimeout(providerCfg.Timeout), transport, retryBudget,
+		)
+		gwRouter.RegisterProvider("azure", azure)
+		log.Printf("✓ Azure OpenAI provider registered (%d deployments)", len(azureCfg.Deployments))
+	}
+	gwRouter.SetHomeRegion(providerCfg.HomeRegion)
+	for _, compatible := range providerCfg.Compatible {
+		provider := providers.NewCompatibleProvider(providers.CompatibleConfig{
+			Name:        compatible.Name,
+			BaseURL:     compatible.BaseURL,
+			APIKey:      compatible.APIKey,
+			AuthHeader:  compatible.AuthHeader,
+			ModelPrefix: compatible.ModelPrefix,
+		}, providers.WithTimeout(providerCfg.Timeout), transport, retryBudget)
+		if compatible.Region != "" {
+			gwRouter.RegisterRegionalProvider(compatible.Name, compatible.Region, provider)
+			log.Printf("✓ OpenAI-compatible provider %s registered in %s (%s)", compatible.Name, compatible.Region, compatible.BaseURL)
+			continue
+		}
+		gwRouter.RegisterProvider(compatible.Name, provider)
+		log.Printf("✓ OpenAI-compatible provider %s registered (%s)", compatible.Name, compatible.BaseURL)
+	}
 
-	// Create Gin router
-	ginRouter := gin.Default()
-
-	// Middleware
-	ginRouter.Use(gin.Recovery())
-	ginRouter.Use(middleware.TracingMiddleware())
-	ginRouter.Use(middleware.MetricsMiddleware())
+	// Provider endpoints are probed for health and latency until shutdown
+	probeCtx, stopProbes := context.WithCancel(context.Background())
+	defer stopProbes()
+	gwRouter.StartHealthProbes(probeCtx, providerCfg.HealthProbeInterval, 5*time.Second)
 
-	// Health endpoints
-	ginRouter.GET("/health", healthCheck)
-	ginRouter.GET("/ready", readinessCheck)
+	// Rate limits, routes, prices and budgets can be reloaded with SIGHUP
+	// when running from a config file
+	reloadable := func(c *config.Config) {
+		applyReloadable(c, rateLimiter, keyLimiter, gwRouter, usageTracker, usageHistory, budget)
+	}
+	reloadable(cfg)
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go config.NewReloader(path, cfg, reloadable).Watch(hup)
+	}
 
-	// Prometheus metrics
-	ginRouter.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	// Semantic caching (optional)
+	if cfg.Cache.Semantic.Threshold > 0 && responseCache != nil {
+		gwRouter.EnableSemanticCache(cache.NewSemanticCache(responseCache, 10000), router.SemanticCacheConfig{
+			EmbeddingModel:      cfg.Cache.Semantic.EmbeddingModel,
+			SimilarityThreshold: cfg.Cache.Semantic.Threshold,
+		})
+		log.Println("✓ Semantic cache enabled")
+	}
 
-	// API v1 routes
-	v1 := ginRouter.Group("/v1")
-	{
-		v1.POST("/chat/completions", gwRouter.HandleChatCompletion)
-		v1.POST("/embeddings", handleEmbeddings)
-		v1.GET("/usage", handleUsage)
+	// Authentication of the API and admin routes
+	var auth []gin.HandlerFunc
+	if keyFile := cfg.Auth.JWTPublicKeyFile; keyFile != "" {
+		publicKey, err := loadRSAPublicKey(keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load JWT public key: %v", err)
+		}
+		auth = append(auth, middleware.JWTAuthMiddleware(publicKey))
+		log.Println("✓ JWT authentication enabled")
 	}
 
+	ginRouter := newEngine(cfg, gwRouter, auth)
+
 	// Start server
 	srv := &http.Server{
-		Addr:           ":8080",
+		Addr:           fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:        ginRouter,
-		ReadTimeout:    60 * time.Second,
-		WriteTimeout:   60 * time.Second,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
 		MaxHeaderBytes: 1 << 20,
 	}
 
@@ -103,12 +288,23 @@ func main() {
 		}
 	}()
 
-	log.Println("🚀 AI Gateway started on :8080")
+	info := buildinfo.Get()
+	log.Printf("🚀 AI Gateway %s (commit %s) started on %s", info.Version, info.Commit, srv.Addr)
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// Refuse new requests and let in-flight streams finish before closing
+	// connections
+	log.Printf("Draining %d in-flight streams...", gwRouter.ActiveStreams())
+	gracePeriod := cfg.Server.ShutdownGracePeriod
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), gracePeriod)
+	if err := gwRouter.Drain(drainCtx); err != nil {
+		log.Printf("Warning: %d streams still active after %s", gwRouter.ActiveStreams(), gracePeriod)
+	}
+	cancelDrain()
+
 	log.Println("Shutting down server...")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -117,27 +313,100 @@ func main() {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
-	if redisCache != nil {
-		redisCache.Close()
+	// Write the usage still buffered
+	if usageWriter != nil {
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := usageWriter.Close(flushCtx); err != nil {
+			log.Printf("Warning: failed to flush usage records: %v", err)
+		}
+		cancelFlush()
+	}
+
+	if responseCache != nil {
+		responseCache.Close()
 	}
 
 	log.Println("Server exited")
 }
 
-func initTracer() (*sdktrace.TracerProvider, error) {
-	exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint("http://localhost:14268/api/traces")))
+// newEngine creates the HTTP server's routes and middleware, with auth
+// authenticating the API and admin routes
+func newEngine(cfg *config.Config, gwRouter *router.Router, auth []gin.HandlerFunc) *gin.Engine {
+	ginRouter := gin.New()
+
+	// Middleware, outermost first: the request ID is assigned before the
+	// span is started, so both are available to logging and metrics, and
+	// recovery runs innermost so panics are recorded on the span, logged
+	// and counted as 500s
+	ginRouter.Use(middleware.RequestIDMiddleware())
+	ginRouter.Use(middleware.TracingMiddleware())
+	ginRouter.Use(middleware.LoggingMiddleware())
+	ginRouter.Use(middleware.MetricsMiddleware())
+	ginRouter.Use(middleware.RecoveryMiddleware())
+
+	// Health endpoints
+	ginRouter.GET("/health", healthCheck)
+	ginRouter.GET("/ready", readinessCheck(gwRouter))
+
+	// Prometheus metrics, optionally behind their own credentials
+	metricsAuth := middleware.MetricsAuthMiddleware(cfg.Metrics.BearerToken, cfg.Metrics.Username, cfg.Metrics.Password)
+	ginRouter.GET("/metrics", metricsAuth, gin.WrapH(promhttp.Handler()))
+
+	// API v1 routes. Chat completions share one in-flight limit across
+	// transports. Responses are compressed outside the timeout, so its 504s
+	// are too; streams are left uncompressed.
+	concurrencyLimit := middleware.ConcurrencyLimitMiddleware(cfg.Server.MaxInFlight)
+	v1 := ginRouter.Group("/v1", append(auth,
+		middleware.CompressionMiddleware(cfg.Server.CompressionMinSize),
+		middleware.TimeoutMiddleware(cfg.Server.RequestTimeout),
+	)...)
+	{
+		v1.POST("/chat/completions", concurrencyLimit, gwRouter.HandleChatCompletion)
+		v1.GET("/chat/stream", concurrencyLimit, gwRouter.HandleChatStream)
+		v1.GET("/models", gwRouter.HandleListModels)
+		v1.POST("/embeddings", gwRouter.HandleEmbeddings)
+		v1.POST("/tokenize", gwRouter.HandleTokenize)
+		v1.GET("/usage", gwRouter.HandleUsage)
+	}
+
+	// Build version and provider endpoints, authenticated like the API
+	// since base URLs can name internal hosts
+	ginRouter.GET("/version", append(auth, gwRouter.HandleVersion)...)
+
+	// Admin routes require a token with the admin scope, so they are
+	// unavailable without JWT authentication
+	admin := ginRouter.Group("/admin", append(auth, middleware.RequireScope(middleware.AdminScope))...)
+	{
+		admin.GET("/ratelimit", gwRouter.HandleRateLimitOffenders)
+		admin.GET("/ratelimit/:user", gwRouter.HandleRateLimitStats)
+		admin.POST("/ratelimit/:user/reset", gwRouter.HandleRateLimitReset)
+		admin.GET("/providers", gwRouter.HandleListProviders)
+		admin.GET("/providers/health", gwRouter.HandleProviderHealth)
+		admin.POST("/providers/:name/enable", gwRouter.HandleProviderEnable)
+		admin.POST("/providers/:name/disable", gwRouter.HandleProviderDisable)
+		admin.DELETE("/cache", gwRouter.HandleCacheDelete)
+		admin.DELETE("/cache/user/:id", gwRouter.HandleUserCacheDelete)
+		admin.DELETE("/cache/model/:model", gwRouter.HandleModelCacheDelete)
+	}
+
+	return ginRouter
+}
+
+// initTracer installs the global tracer provider, exporting to the OTLP
+// collector if one is configured
+func initTracer(cfg config.TracingConfig) (tracing.Provider, error) {
+	tp, err := tracing.NewTracerProvider(context.Background(), tracing.Config{
+		ServiceName: cfg.ServiceName,
+		Endpoint:    cfg.OTLPEndpoint,
+		Protocol:    cfg.OTLPProtocol,
+		Sampler:     cfg.Sampler,
+		SampleRatio: cfg.SampleRatio,
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("ai-gateway"),
-		)),
-	)
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 	return tp, nil
 }
 
@@ -148,37 +417,104 @@ func healthCheck(c *gin.Context) {
 	})
 }
 
-func readinessCheck(c *gin.Context) {
-	// Check Redis, DB, etc.
-	c.JSON(http.StatusOK, gin.H{
-		"ready": true,
-	})
+// readinessCheck reports whether the gateway's dependencies are usable,
+// with 503 and the per-dependency status when one is not
+func readinessCheck(gwRouter *router.Router) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks := gwRouter.ReadinessCheck(c.Request.Context())
+
+		status := http.StatusOK
+		if !router.Ready(checks) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"ready":  status == http.StatusOK,
+			"checks": checks,
+		})
+	}
 }
 
-func handleEmbeddings(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"object": "list",
-		"data":   []map[string]interface{}{},
-	})
+// newRateLimiter creates a rate limiter of the configured algorithm with a
+// capacity and refill rate. Idle token buckets are evicted until the
+// returned close function is called.
+func newRateLimiter(cfg config.RateLimitConfig, capacity int, refillRate float64) (ratelimit.Limiter, func()) {
+	if cfg.Algorithm == config.AlgorithmSlidingWindow {
+		limiter := ratelimit.NewSlidingWindowLimiter(int64(capacity), cfg.Window)
+		limiter.SetBatchReserve(cfg.BatchReserve)
+		return limiter, func() {}
+	}
+	tokenBucket := ratelimit.NewRateLimiter(int64(capacity), refillRate)
+	tokenBucket.SetBatchReserve(cfg.BatchReserve)
+	tokenBucket.StartEviction(time.Minute, 10*time.Minute)
+	return tokenBucket, tokenBucket.Close
+}
+
+// setRateLimit sets the limit of a limiter built by newRateLimiter
+func setRateLimit(limiter ratelimit.Limiter, cfg config.RateLimitConfig, capacity int, refillRate float64) {
+	switch l := limiter.(type) {
+	case *ratelimit.RateLimiter:
+		l.SetDefaultLimit(int64(capacity), refillRate)
+		l.SetBatchReserve(cfg.BatchReserve)
+	case *ratelimit.SlidingWindowLimiter:
+		l.SetLimit(int64(capacity), cfg.Window)
+		l.SetBatchReserve(cfg.BatchReserve)
+	}
 }
 
-func handleUsage(c *gin.Context) {
-	userID := c.GetString("user_id")
-	if userID == "" {
-		userID = "anonymous"
+// applyReloadable swaps the reloadable settings of cfg into the running
+// gateway: rate limits, model routes, prices and budgets. keyLimiter is nil
+// when API keys aren't rate limited.
+func applyReloadable(cfg *config.Config, limiter, keyLimiter ratelimit.Limiter, gwRouter *router.Router, tracker *usage.UsageTracker, history *usage.PostgresUsageStore, budget *usage.BudgetLimit) {
+	setRateLimit(limiter, cfg.RateLimit, cfg.RateLimit.Capacity, cfg.RateLimit.RefillRate)
+	if keyLimiter != nil {
+		setRateLimit(keyLimiter, cfg.RateLimit, cfg.RateLimit.PerKey.Capacity, cfg.RateLimit.PerKey.RefillRate)
+	}
+	if decider, ok := limiter.(ratelimit.Decider); ok {
+		thresholds := make(map[string]ratelimit.Thresholds, len(cfg.RateLimit.Users))
+		for userID, limits := range cfg.RateLimit.Users {
+			thresholds[userID] = ratelimit.Thresholds{Soft: int64(limits.Soft), Hard: int64(limits.Hard), RefillRate: limits.RefillRate}
+		}
+		decider.SetThresholds(int64(cfg.RateLimit.SoftLimit), thresholds)
 	}
+	gwRouter.SetRateLimitWait(cfg.RateLimit.MaxWait)
+	gwRouter.SetRateLimitTokens(cfg.RateLimit.Unit == config.UnitTokens)
 
-	c.JSON(http.StatusOK, gin.H{
-		"user_id":     userID,
-		"tokens_used": 12345,
-		"requests":    100,
-		"cost":        5.67,
-	})
+	// Azure deployments are routed by exact model name, ahead of the
+	// configured routes
+	var routes []router.ModelRoute
+	if cfg.Providers.Azure.Endpoint != "" {
+		for model := range cfg.Providers.Azure.Deployments {
+			routes = append(routes, router.ModelRoute{Pattern: model, Provider: "azure"})
+		}
+	}
+	// OpenAI-compatible servers get the models under their prefix
+	for _, compatible := range cfg.Providers.Compatible {
+		if compatible.ModelPrefix != "" {
+			routes = append(routes, router.ModelRoute{Pattern: compatible.ModelPrefix + "*", Provider: compatible.Name})
+		}
+	}
+	for _, route := range cfg.Routes {
+		routes = append(routes, router.ModelRoute{Pattern: route.Pattern, Provider: route.Provider})
+	}
+	gwRouter.SetModelRoutes(routes)
+	gwRouter.SetDefaultProvider(cfg.DefaultProvider)
+
+	if tracker != nil {
+		tracker.SetPrices(cfg.Prices)
+	}
+	if history != nil {
+		history.SetPrices(cfg.Prices)
+	}
+	if budget != nil {
+		budget.SetCaps(cfg.MonthlyBudgetUSD, cfg.UserBudgetsUSD)
+	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// loadRSAPublicKey reads a PEM-encoded RSA public key from a file
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	return defaultValue
+	return jwt.ParseRSAPublicKeyFromPEM(data)
 }
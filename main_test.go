@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/config"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/router"
+)
+
+func TestKeyRateLimitThroughMiddlewareChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Default()
+	cfg.RateLimit.PerKey = config.KeyRateLimitConfig{Capacity: 1, RefillRate: 0.001}
+	userLimiter, closeUserLimiter := newRateLimiter(cfg.RateLimit, cfg.RateLimit.Capacity, cfg.RateLimit.RefillRate)
+	defer closeUserLimiter()
+	keyLimiter, closeKeyLimiter := newRateLimiter(cfg.RateLimit, cfg.RateLimit.PerKey.Capacity, cfg.RateLimit.PerKey.RefillRate)
+	defer closeKeyLimiter()
+
+	gwRouter := router.NewRouter(nil, userLimiter)
+	gwRouter.SetKeyRateLimiter(keyLimiter)
+	gwRouter.RegisterProvider("openai", providers.NewOpenAIProvider("test-key", providers.WithBaseURL(upstream.URL)))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	engine := newEngine(cfg, gwRouter, []gin.HandlerFunc{middleware.JWTAuthMiddleware(&key.PublicKey)})
+
+	// Two keys of the same user
+	token := func(jti string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub": "user-1", "jti": jti, "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+	keyA, keyB := token("key-a"), token("key-b")
+	send := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send(keyA).Code)
+
+	// key-a is throttled on its own, while key-b has its own limit
+	w := send(keyA)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "API key rate limit exceeded")
+	assert.Equal(t, http.StatusOK, send(keyB).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(keyB).Code)
+}
+
+func TestApplyReloadableSetsKeyLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.PerKey = config.KeyRateLimitConfig{Capacity: 1, RefillRate: 0.001}
+	userLimiter, closeUserLimiter := newRateLimiter(cfg.RateLimit, cfg.RateLimit.Capacity, cfg.RateLimit.RefillRate)
+	defer closeUserLimiter()
+	keyLimiter, closeKeyLimiter := newRateLimiter(cfg.RateLimit, cfg.RateLimit.PerKey.Capacity, cfg.RateLimit.PerKey.RefillRate)
+	defer closeKeyLimiter()
+
+	cfg.RateLimit.PerKey.Capacity = 3
+	applyReloadable(cfg, userLimiter, keyLimiter, router.NewRouter(nil, userLimiter), nil, nil, nil)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, keyLimiter.Allow("key-a", 1))
+	}
+	assert.False(t, keyLimiter.Allow("key-a", 1))
+}
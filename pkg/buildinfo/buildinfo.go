@@ -0,0 +1,26 @@
+// Package buildinfo holds the version of the running build. The variables
+// are set at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/sanketny8/ai-gateway-microservices/pkg/buildinfo.Version=v1.2.0 \
+//	  -X github.com/sanketny8/ai-gateway-microservices/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/sanketny8/ai-gateway-microservices/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+// Set with -ldflags; builds without them report the defaults
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// Get returns the version of the running build
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+}
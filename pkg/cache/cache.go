@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores JSON-encoded values by key. Get returns ErrCacheMiss for
+// keys that are absent or expired.
+type Cache interface {
+	Get(ctx context.Context, key string, dest interface{}) error
+	// Set stores a value with the cache's default TTL
+	Set(ctx context.Context, key string, value interface{}) error
+	// SetWithTTL stores a value with the given TTL
+	SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// PrefixDeleter is implemented by caches that can delete every key with a
+// prefix
+type PrefixDeleter interface {
+	// DeleteByPrefix deletes the keys starting with prefix and returns how
+	// many were deleted
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// Pinger is implemented by caches backed by a remote store whose
+// reachability can be checked
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the format of cached values, stored with
+// every entry. Bump it when a cached type such as ChatResponse changes
+// shape: entries stored under another version are misses, so they are
+// fetched afresh instead of decoding into partially-populated values.
+const SchemaVersion = 1
+
+// cacheEntry is the stored form of a cached value
+type cacheEntry struct {
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// encodeEntry encodes a value as an entry of a schema version
+func encodeEntry(version int, value interface{}) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return json.Marshal(cacheEntry{Version: version, Payload: payload})
+}
+
+// decodeEntry decodes the value of an entry into dest. Entries of another
+// schema version, or written before entries were versioned, are misses.
+func decodeEntry(version int, data []byte, dest interface{}) error {
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Version != version || entry.Payload == nil {
+		return ErrCacheMiss
+	}
+	if err := json.Unmarshal(entry.Payload, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal cache value: %w", err)
+	}
+	return nil
+}
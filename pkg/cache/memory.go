@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// cacheEvictionsTotal counts entries dropped to keep an InMemoryCache
+// within its size bound
+var cacheEvictionsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "cache_evictions_total",
+		Help: "Total number of entries evicted from the in-memory cache",
+	},
+)
+
+// InMemoryCache is a process-local cache for development, tests and
+// single-instance deployments. It holds at most maxEntries values and
+// evicts the least recently used one to make room for a new one.
+type InMemoryCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries from most to least recently used
+	order *list.List
+
+	// Schema version entries are stored and read under
+	version int
+
+	now func() time.Time
+}
+
+// memoryEntry is an encoded cacheEntry and its expiry; a zero expiry never
+// expires
+type memoryEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+var (
+	_ Cache         = (*InMemoryCache)(nil)
+	_ PrefixDeleter = (*InMemoryCache)(nil)
+)
+
+// NewInMemoryCache creates an in-memory cache holding at most maxEntries
+// values with the given default TTL. A maxEntries of zero is unbounded.
+func NewInMemoryCache(maxEntries int, ttl time.Duration) *InMemoryCache {
+	return &InMemoryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		version:    SchemaVersion,
+		now:        time.Now,
+	}
+}
+
+// SetSchemaVersion overrides the schema version entries are stored and
+// read under, SchemaVersion by default
+func (c *InMemoryCache) SetSchemaVersion(version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = version
+}
+
+// Get retrieves a value from cache. Entries of another schema version are
+// misses.
+func (c *InMemoryCache) Get(ctx context.Context, key string, dest interface{}) error {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return ErrCacheMiss
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.removeElement(elem)
+		c.mu.Unlock()
+		return ErrCacheMiss
+	}
+	c.order.MoveToFront(elem)
+	data, version := entry.data, c.version
+	c.mu.Unlock()
+
+	return decodeEntry(version, data, dest)
+}
+
+// Set stores a value in cache with the default TTL
+func (c *InMemoryCache) Set(ctx context.Context, key string, value interface{}) error {
+	return c.SetWithTTL(ctx, key, value, c.ttl)
+}
+
+// SetWithTTL stores a value in cache with the given TTL; a zero TTL never
+// expires
+func (c *InMemoryCache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	c.mu.Lock()
+	version := c.version
+	c.mu.Unlock()
+	data, err := encodeEntry(version, value)
+	if err != nil {
+		return err
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.data = data
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, data: data, expires: expires})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+		cacheEvictionsTotal.Inc()
+	}
+	return nil
+}
+
+// Delete removes a value from cache
+func (c *InMemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+	return nil
+}
+
+// DeleteByPrefix deletes the keys starting with prefix
+func (c *InMemoryCache) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(elem)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Len returns the number of entries held, including expired entries not
+// yet removed
+func (c *InMemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Close releases the cache's entries
+func (c *InMemoryCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	return nil
+}
+
+// removeElement drops an entry; the caller must hold mu
+func (c *InMemoryCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*memoryEntry).key)
+}
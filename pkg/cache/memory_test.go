@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewInMemoryCache(3, time.Minute)
+	evictions := testutil.ToFloat64(cacheEvictionsTotal)
+
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, c.Set(ctx, key, key))
+	}
+
+	// Reading "a" makes "b" the least recently used entry
+	var value string
+	assert.NoError(t, c.Get(ctx, "a", &value))
+
+	assert.NoError(t, c.Set(ctx, "d", "d"))
+	assert.NoError(t, c.Set(ctx, "e", "e"))
+
+	assert.Equal(t, 3, c.Len())
+	assert.ErrorIs(t, c.Get(ctx, "b", &value), ErrCacheMiss)
+	assert.ErrorIs(t, c.Get(ctx, "c", &value), ErrCacheMiss)
+	for _, key := range []string{"a", "d", "e"} {
+		assert.NoError(t, c.Get(ctx, key, &value))
+		assert.Equal(t, key, value)
+	}
+	assert.Equal(t, evictions+2, testutil.ToFloat64(cacheEvictionsTotal))
+}
+
+func TestInMemoryCacheExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	c := NewInMemoryCache(0, time.Minute)
+	c.now = func() time.Time { return now }
+
+	assert.NoError(t, c.Set(ctx, "default", 1))
+	assert.NoError(t, c.SetWithTTL(ctx, "long", 2, time.Hour))
+	assert.NoError(t, c.SetWithTTL(ctx, "forever", 3, 0))
+
+	now = now.Add(2 * time.Minute)
+	var value int
+	assert.ErrorIs(t, c.Get(ctx, "default", &value), ErrCacheMiss)
+	assert.NoError(t, c.Get(ctx, "long", &value))
+	assert.Equal(t, 2, value)
+
+	now = now.Add(24 * time.Hour)
+	assert.ErrorIs(t, c.Get(ctx, "long", &value), ErrCacheMiss)
+	assert.NoError(t, c.Get(ctx, "forever", &value))
+	assert.Equal(t, 1, c.Len(), "expired entries are removed on read")
+}
+
+func TestInMemoryCacheJSONSemantics(t *testing.T) {
+	ctx := context.Background()
+	c := NewInMemoryCache(10, time.Minute)
+
+	type response struct {
+		ID    string `json:"id"`
+		Count int    `json:"count"`
+	}
+	stored := response{ID: "resp-1", Count: 2}
+	assert.NoError(t, c.Set(ctx, "key", &stored))
+
+	// Values are copied in and out, as with Redis
+	stored.Count = 3
+	var got response
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.Equal(t, response{ID: "resp-1", Count: 2}, got)
+
+	var wrongType []int
+	assert.ErrorContains(t, c.Get(ctx, "key", &wrongType), "failed to unmarshal")
+	assert.ErrorContains(t, c.Set(ctx, "bad", make(chan int)), "failed to marshal")
+
+	assert.NoError(t, c.Delete(ctx, "key"))
+	assert.ErrorIs(t, c.Get(ctx, "key", &got), ErrCacheMiss)
+}
+
+func TestInMemoryCacheSchemaVersionMismatchMisses(t *testing.T) {
+	ctx := context.Background()
+	c := NewInMemoryCache(10, time.Minute)
+	c.SetSchemaVersion(SchemaVersion - 1)
+	assert.NoError(t, c.Set(ctx, "key", map[string]string{"id": "old-format"}))
+
+	// The entry written under the previous version is a miss under the
+	// current one, and readable again under its own
+	c.SetSchemaVersion(SchemaVersion)
+	var got map[string]string
+	assert.ErrorIs(t, c.Get(ctx, "key", &got), ErrCacheMiss)
+	c.SetSchemaVersion(SchemaVersion - 1)
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.Equal(t, "old-format", got["id"])
+}
+
+func TestDecodeEntry(t *testing.T) {
+	data, err := encodeEntry(SchemaVersion, map[string]int{"n": 1})
+	assert.NoError(t, err)
+	var got map[string]int
+	assert.NoError(t, decodeEntry(SchemaVersion, data, &got))
+	assert.Equal(t, 1, got["n"])
+
+	assert.ErrorIs(t, decodeEntry(SchemaVersion+1, data, &got), ErrCacheMiss)
+	// Values stored before entries were versioned are misses
+	assert.ErrorIs(t, decodeEntry(SchemaVersion, []byte(`{"id":"chatcmpl-1"}`), &got), ErrCacheMiss)
+	assert.ErrorIs(t, decodeEntry(SchemaVersion, []byte(`"text"`), &got), ErrCacheMiss)
+}
+
+func TestInMemoryCacheConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	c := NewInMemoryCache(50, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("key-%d", (worker*j)%100)
+				_ = c.Set(ctx, key, j)
+				var value int
+				_ = c.Get(ctx, key, &value)
+				if j%10 == 0 {
+					_ = c.Delete(ctx, key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 50)
+}
+
+func TestInMemoryCacheDeleteByPrefix(t *testing.T) {
+	ctx := context.Background()
+	c := NewInMemoryCache(0, time.Minute)
+	for _, key := range []string{"chat:a", "chat:b", "embeddings:a"} {
+		assert.NoError(t, c.Set(ctx, key, key))
+	}
+
+	deleted, err := c.DeleteByPrefix(ctx, "chat:")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, 1, c.Len())
+}
@@ -2,8 +2,8 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,8 +13,20 @@ import (
 type RedisCache struct {
 	client *redis.Client
 	ttl    time.Duration
+
+	// Schema version entries are stored and read under
+	version int
 }
 
+var (
+	_ Cache         = (*RedisCache)(nil)
+	_ Pinger        = (*RedisCache)(nil)
+	_ PrefixDeleter = (*RedisCache)(nil)
+)
+
+// scanBatchSize is the number of keys requested per SCAN call
+const scanBatchSize = 500
+
 // NewRedisCache creates a new Redis cache
 func NewRedisCache(addr string, password string, db int, ttl time.Duration) (*RedisCache, error) {
 	client := redis.NewClient(&redis.Options{
@@ -32,12 +44,20 @@ func NewRedisCache(addr string, password string, db int, ttl time.Duration) (*Re
 	}
 
 	return &RedisCache{
-		client: client,
-		ttl:    ttl,
+		client:  client,
+		ttl:     ttl,
+		version: SchemaVersion,
 	}, nil
 }
 
-// Get retrieves a value from cache
+// SetSchemaVersion overrides the schema version entries are stored and
+// read under, SchemaVersion by default
+func (c *RedisCache) SetSchemaVersion(version int) {
+	c.version = version
+}
+
+// Get retrieves a value from cache. Entries of another schema version are
+// misses.
 func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) error {
 	val, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
@@ -47,21 +67,22 @@ func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) erro
 		return fmt.Errorf("failed to get from cache: %w", err)
 	}
 
-	if err := json.Unmarshal([]byte(val), dest); err != nil {
-		return fmt.Errorf("failed to unmarshal cache value: %w", err)
-	}
-
-	return nil
+	return decodeEntry(c.version, []byte(val), dest)
 }
 
-// Set stores a value in cache
+// Set stores a value in cache with the default TTL
 func (c *RedisCache) Set(ctx context.Context, key string, value interface{}) error {
-	data, err := json.Marshal(value)
+	return c.SetWithTTL(ctx, key, value, c.ttl)
+}
+
+// SetWithTTL stores a value in cache with the given TTL
+func (c *RedisCache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := encodeEntry(c.version, value)
 	if err != nil {
-		return fmt.Errorf("failed to marshal value: %w", err)
+		return err
 	}
 
-	if err := c.client.Set(ctx, key, data, c.ttl).Err(); err != nil {
+	if err := c.client.Set(ctx, key, data, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to set cache: %w", err)
 	}
 
@@ -76,6 +97,57 @@ func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// DeleteByPrefix deletes the keys starting with prefix. Keys are found with
+// SCAN, so Redis isn't blocked on large keyspaces; keys written during the
+// scan may be missed.
+func (c *RedisCache) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	pattern := escapeGlob(prefix) + "*"
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to scan cache: %w", err)
+		}
+		if len(keys) > 0 {
+			n, err := c.client.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete from cache: %w", err)
+			}
+			deleted += int(n)
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob escapes the characters of s that are special in a Redis MATCH
+// pattern
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Ping checks that Redis is reachable
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Client returns the underlying Redis client so other components can share
+// the connection pool
+func (c *RedisCache) Client() *redis.Client {
+	return c.client
+}
+
 // Close closes the Redis connection
 func (c *RedisCache) Close() error {
 	return c.client.Close()
@@ -83,4 +155,3 @@ func (c *RedisCache) Close() error {
 
 // ErrCacheMiss is returned when a key is not found in cache
 var ErrCacheMiss = fmt.Errorf("cache miss")
-
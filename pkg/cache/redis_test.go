@@ -0,0 +1,12 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, "chat:", escapeGlob("chat:"))
+	assert.Equal(t, `user:a\*b\?\[c\]\\:`, escapeGlob(`user:a*b?[c]\:`))
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// SemanticCache finds cached responses for prompts that are similar, rather
+// than identical, to a new prompt. It keeps an in-memory index of prompt
+// embeddings pointing at entries stored in the wrapped Cache.
+type SemanticCache struct {
+	backend    Cache
+	maxEntries int
+	entries    []semanticEntry
+	mu         sync.RWMutex
+}
+
+// semanticEntry links a prompt embedding to the key of its cached response
+type semanticEntry struct {
+	namespace string
+	vector    []float64
+	key       string
+}
+
+// NewSemanticCache creates a new semantic cache indexing at most maxEntries
+// prompts; the oldest entries are dropped first
+func NewSemanticCache(backend Cache, maxEntries int) *SemanticCache {
+	return &SemanticCache{
+		backend:    backend,
+		maxEntries: maxEntries,
+	}
+}
+
+// Lookup retrieves the cached value of the most similar prompt in the
+// namespace whose cosine similarity is at least threshold
+func (sc *SemanticCache) Lookup(ctx context.Context, namespace string, vector []float64, threshold float64, dest interface{}) error {
+	sc.mu.RLock()
+	bestKey := ""
+	bestScore := threshold
+	for _, entry := range sc.entries {
+		if entry.namespace != namespace {
+			continue
+		}
+		if score := cosineSimilarity(vector, entry.vector); score >= bestScore {
+			bestKey = entry.key
+			bestScore = score
+		}
+	}
+	sc.mu.RUnlock()
+
+	if bestKey == "" {
+		return ErrCacheMiss
+	}
+
+	err := sc.backend.Get(ctx, bestKey, dest)
+	if err == ErrCacheMiss {
+		// The response expired from the backend, drop it from the index
+		sc.remove(bestKey)
+	}
+	return err
+}
+
+// Store indexes a prompt embedding under the key its response was cached with
+func (sc *SemanticCache) Store(namespace string, vector []float64, key string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.entries = append(sc.entries, semanticEntry{
+		namespace: namespace,
+		vector:    vector,
+		key:       key,
+	})
+	if sc.maxEntries > 0 && len(sc.entries) > sc.maxEntries {
+		sc.entries = sc.entries[len(sc.entries)-sc.maxEntries:]
+	}
+}
+
+// remove drops all index entries pointing at key
+func (sc *SemanticCache) remove(key string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	kept := sc.entries[:0]
+	for _, entry := range sc.entries {
+		if entry.key != key {
+			kept = append(kept, entry)
+		}
+	}
+	sc.entries = kept
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, or 0 when
+// they can't be compared
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,943 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/tracing"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
+)
+
+// Config is the gateway configuration. It is loaded from a YAML or JSON
+// file, then overridden by environment variables.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Cache      CacheConfig      `yaml:"cache"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
+	Providers  ProvidersConfig  `yaml:"providers"`
+	Embeddings EmbeddingsConfig `yaml:"embeddings"`
+	Shadow     ShadowConfig     `yaml:"shadow"`
+	Filters    FiltersConfig    `yaml:"filters"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Usage      UsageConfig      `yaml:"usage"`
+
+	// Routes sends models to providers, ahead of the built-in routes
+	Routes []RouteConfig `yaml:"routes"`
+
+	// StrictModelRouting rejects models no route matches. When disabled,
+	// they are sent to DefaultProvider.
+	StrictModelRouting bool   `yaml:"strict_model_routing"`
+	DefaultProvider    string `yaml:"default_provider"`
+
+	// MonthlyBudgetUSD caps the monthly spend per user; zero disables it
+	MonthlyBudgetUSD float64 `yaml:"monthly_budget_usd"`
+
+	// UserBudgetsUSD overrides MonthlyBudgetUSD for individual users
+	UserBudgetsUSD map[string]float64 `yaml:"user_budgets_usd"`
+
+	// Prices extends and overrides the default model price table
+	Prices usage.PriceTable `yaml:"prices"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port         int           `yaml:"port"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// ShutdownGracePeriod is how long shutdown waits for in-flight streams
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period"`
+
+	// RequestTimeout bounds how long an API request may take, streams
+	// included; zero disables it. Keep it below WriteTimeout so the 504
+	// can still be written.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
+	// MaxInFlight caps the chat completions handled at once; zero
+	// disables the cap
+	MaxInFlight int `yaml:"max_in_flight"`
+
+	// CompressionMinSize is the size in bytes from which API responses are
+	// gzipped for clients accepting it; zero disables compression
+	CompressionMinSize int `yaml:"compression_min_size"`
+}
+
+// RedisConfig configures the Redis connection
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// CacheConfig configures response caching
+type CacheConfig struct {
+	// Backend is the cache store, BackendRedis or BackendMemory
+	Backend string        `yaml:"backend"`
+	TTL     time.Duration `yaml:"ttl"`
+
+	// MaxEntries bounds the in-memory backend; zero is unbounded
+	MaxEntries int `yaml:"max_entries"`
+
+	// TTLOverrides sets the TTL of models by model name prefix
+	TTLOverrides map[string]time.Duration `yaml:"ttl_overrides"`
+
+	// StaleTTL is how long a stale copy of each chat response is kept, to
+	// be served when the provider fails. It must exceed every freshness
+	// TTL; zero disables stale serving.
+	StaleTTL time.Duration `yaml:"stale_ttl"`
+
+	// PerUser keeps cached responses per user instead of sharing them
+	// across users, isolating tenants that send identical requests
+	PerUser bool `yaml:"per_user"`
+
+	Semantic SemanticCacheConfig `yaml:"semantic"`
+}
+
+// SemanticCacheConfig configures similarity-based caching
+type SemanticCacheConfig struct {
+	// Threshold is the minimum cosine similarity of a hit; zero disables
+	// the semantic cache
+	Threshold      float64 `yaml:"threshold"`
+	EmbeddingModel string  `yaml:"embedding_model"`
+}
+
+// Cache backends
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+)
+
+// Rate limiting algorithms
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+// Rate limit units
+const (
+	UnitRequests = "requests"
+	UnitTokens   = "tokens"
+)
+
+// RateLimitConfig configures per-user rate limiting
+type RateLimitConfig struct {
+	Algorithm string `yaml:"algorithm"`
+
+	// Unit is what the limits count: requests, or the prompt and
+	// completion tokens of the requests
+	Unit string `yaml:"unit"`
+
+	// Capacity is the token bucket size, or the limit per window for the
+	// sliding window, in Units
+	Capacity int `yaml:"capacity"`
+
+	// RefillRate is the token bucket refill rate in tokens per second
+	RefillRate float64 `yaml:"refill_rate"`
+
+	// Window is the sliding window length
+	Window time.Duration `yaml:"window"`
+
+	// MaxWait is how long a rate limited request waits for the token
+	// bucket to refill before it is rejected; zero rejects immediately
+	MaxWait time.Duration `yaml:"max_wait"`
+
+	// BatchReserve is the fraction of each limit kept for interactive
+	// requests; requests sent with "X-Priority: batch" can't use it
+	BatchReserve float64 `yaml:"batch_reserve"`
+
+	// SoftLimit is the usage, in Units, beyond which requests are still
+	// allowed but answered with an X-RateLimit-Warning header; zero
+	// disables it
+	SoftLimit int `yaml:"soft_limit"`
+
+	// Users overrides the soft and hard limits of individual users
+	Users map[string]UserRateLimitConfig `yaml:"users"`
+
+	// PerKey limits each API key, across models, in addition to the user
+	// it belongs to; requests must pass both
+	PerKey KeyRateLimitConfig `yaml:"per_key"`
+}
+
+// KeyRateLimitConfig holds the limit of each API key, counted in the same
+// unit and with the same algorithm and window as the user limits. Zero
+// Capacity disables key limits.
+type KeyRateLimitConfig struct {
+	Capacity   int     `yaml:"capacity"`
+	RefillRate float64 `yaml:"refill_rate"`
+}
+
+// UserRateLimitConfig holds the limits of a user, e.g. a customer on a
+// higher tier. Hard replaces Capacity and RefillRate the refill rate, which
+// otherwise scales with Hard; zero keeps the defaults.
+type UserRateLimitConfig struct {
+	Soft       int     `yaml:"soft"`
+	Hard       int     `yaml:"hard"`
+	RefillRate float64 `yaml:"refill_rate"`
+}
+
+// ProvidersConfig configures the LLM providers. A provider is registered
+// when its credentials are set.
+type ProvidersConfig struct {
+	// Timeout bounds each non-streaming provider call
+	Timeout time.Duration `yaml:"timeout"`
+
+	// StreamFirstTokenTimeout bounds the wait for the first chunk of a
+	// streamed completion, and StreamIdleTimeout the wait for each chunk
+	// after it; a stalled stream is aborted. Zero disables them.
+	StreamFirstTokenTimeout time.Duration `yaml:"stream_first_token_timeout"`
+	StreamIdleTimeout       time.Duration `yaml:"stream_idle_timeout"`
+
+	// MaxIdleConnsPerHost is the number of keep-alive connections kept open
+	// to each provider host, MaxConnsPerHost caps the connections to each
+	// host (zero means no cap) and IdleConnTimeout is how long an idle
+	// connection is kept
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+
+	// HomeRegion is the region whose endpoints regional providers prefer
+	HomeRegion string `yaml:"home_region"`
+
+	// StrictParameters rejects requests setting parameters the provider
+	// cannot honor, such as a seed for Anthropic, with a 400 instead of
+	// ignoring them
+	StrictParameters bool `yaml:"strict_parameters"`
+
+	// HealthProbeInterval is how often every provider endpoint's health and
+	// latency are probed in the background. Zero disables the probes.
+	HealthProbeInterval time.Duration `yaml:"health_probe_interval"`
+
+	// RetryBudget caps the retries of all providers together
+	RetryBudget RetryBudgetConfig `yaml:"retry_budget"`
+
+	OpenAI    OpenAIConfig   `yaml:"openai"`
+	Anthropic ProviderConfig `yaml:"anthropic"`
+	Gemini    ProviderConfig `yaml:"gemini"`
+	Azure     AzureConfig    `yaml:"azure"`
+
+	// Compatible registers servers speaking the OpenAI API under their own
+	// names
+	Compatible []CompatibleProviderConfig `yaml:"compatible"`
+
+	// Defaults holds the default request parameters of providers by name
+	Defaults map[string]ProviderDefaultsConfig `yaml:"defaults"`
+}
+
+// RetryBudgetConfig sizes the token bucket provider retries are drawn
+// from: Capacity retries, refilled at RefillRate retries per second. Once
+// it is empty failed calls are not retried. Zero Capacity disables the
+// budget.
+type RetryBudgetConfig struct {
+	Capacity   int     `yaml:"capacity"`
+	RefillRate float64 `yaml:"refill_rate"`
+}
+
+// ProviderDefaultsConfig sets parameters of a provider's chat completion
+// requests that the requests themselves leave unset, and model aliases
+// resolving to the provider's models
+type ProviderDefaultsConfig struct {
+	MaxTokens    int               `yaml:"max_tokens"`
+	Temperature  *float64          `yaml:"temperature"`
+	ModelAliases map[string]string `yaml:"model_aliases"`
+}
+
+// ProviderConfig holds the credentials of a provider. BaseURL overrides
+// the public API endpoint, e.g. for a proxy or a self-hosted compatible
+// server.
+type ProviderConfig struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+}
+
+// OpenAIConfig configures the OpenAI provider
+type OpenAIConfig struct {
+	ProviderConfig `yaml:",inline"`
+
+	// ReasoningModels are the prefixes of the names of reasoning models,
+	// whose requests are sent with max_completion_tokens instead of
+	// max_tokens and without a temperature
+	ReasoningModels []string `yaml:"reasoning_models"`
+}
+
+// validateBaseURL checks an optional base URL is an absolute http(s) URL
+func validateBaseURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URL, got %q", raw)
+	}
+	return nil
+}
+
+// AzureConfig configures the Azure OpenAI provider
+type AzureConfig struct {
+	Endpoint   string `yaml:"endpoint"`
+	APIKey     string `yaml:"api_key"`
+	APIVersion string `yaml:"api_version"`
+
+	// Deployments maps model names to deployment names
+	Deployments map[string]string `yaml:"deployments"`
+}
+
+// CompatibleProviderConfig configures an OpenAI-compatible server such as
+// vLLM, LocalAI, Together or Groq. Models starting with ModelPrefix are
+// routed to it, with the prefix stripped. Entries sharing a name are the
+// endpoints of one provider in different regions, each setting Region.
+type CompatibleProviderConfig struct {
+	Name        string `yaml:"name"`
+	BaseURL     string `yaml:"base_url"`
+	APIKey      string `yaml:"api_key"`
+	AuthHeader  string `yaml:"auth_header"`
+	ModelPrefix string `yaml:"model_prefix"`
+	Region      string `yaml:"region"`
+}
+
+// RouteConfig routes models matching a pattern, an exact model name or a
+// glob such as "gpt-4*", to a provider
+type RouteConfig struct {
+	Pattern  string `yaml:"pattern"`
+	Provider string `yaml:"provider"`
+}
+
+// AuthConfig configures client authentication
+type AuthConfig struct {
+	// JWTPublicKeyFile enables JWT authentication when set
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file"`
+}
+
+// MetricsConfig protects the metrics endpoint, separately from the API's
+// authentication. Scrapers present BearerToken or the basic auth
+// credentials; with neither set the endpoint is open.
+type MetricsConfig struct {
+	BearerToken string `yaml:"bearer_token"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+}
+
+// EmbeddingsConfig configures how embeddings requests with many inputs are
+// split into batches sent to the provider concurrently
+type EmbeddingsConfig struct {
+	// BatchSize is the most inputs per provider call; zero disables
+	// batching
+	BatchSize      int `yaml:"batch_size"`
+	MaxConcurrency int `yaml:"max_concurrency"`
+}
+
+// ShadowConfig mirrors a sample of served chat completions to a shadow
+// provider whose responses are discarded
+type ShadowConfig struct {
+	// Provider receives the copies; empty disables shadowing
+	Provider string `yaml:"provider"`
+	// Model replaces the model of the copies; empty keeps the request's
+	Model       string        `yaml:"model"`
+	SampleRate  float64       `yaml:"sample_rate"`
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxInFlight int           `yaml:"max_in_flight"`
+}
+
+// FiltersConfig configures the filters screening chat completion requests
+// and those run over responses before they are cached and returned
+type FiltersConfig struct {
+	// BannedPhrases rejects requests whose messages contain any of them,
+	// ignoring case
+	BannedPhrases []string `yaml:"banned_phrases"`
+
+	// RedactPatterns are regular expressions whose matches in response
+	// content are replaced with Redaction
+	RedactPatterns []string `yaml:"redact_patterns"`
+	Redaction      string   `yaml:"redaction"`
+}
+
+// LoggingConfig configures logging
+type LoggingConfig struct {
+	// LLMContent includes message and response content in per-call logs
+	LLMContent bool `yaml:"llm_content"`
+}
+
+// TracingConfig configures trace sampling and export
+type TracingConfig struct {
+	ServiceName string `yaml:"service_name"`
+
+	// OTLPEndpoint is the collector spans are exported to over
+	// OTLPProtocol, grpc or http/protobuf; without one nothing is traced
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	OTLPProtocol string `yaml:"otlp_protocol"`
+
+	// Sampler is always, never or ratio; with ratio, SampleRatio of the
+	// traces starting at the gateway are recorded
+	Sampler     string  `yaml:"sampler"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// UsageConfig configures how usage records are written. Records are
+// buffered and written in batches of up to BatchSize, at least every
+// FlushInterval; a BufferSize of zero writes each record as the request
+// completes.
+type UsageConfig struct {
+	BufferSize    int           `yaml:"buffer_size"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+
+	// PostgresDSN is the database keeping the usage history, besides the
+	// Redis counters; empty disables it
+	PostgresDSN string `yaml:"postgres_dsn"`
+}
+
+// Default returns the configuration used when nothing is configured
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:                8080,
+			ReadTimeout:         60 * time.Second,
+			WriteTimeout:        60 * time.Second,
+			ShutdownGracePeriod: 30 * time.Second,
+			MaxInFlight:         1000,
+			CompressionMinSize:  1024,
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Cache: CacheConfig{
+			Backend:    BackendRedis,
+			TTL:        5 * time.Minute,
+			MaxEntries: 10000,
+			Semantic: SemanticCacheConfig{
+				EmbeddingModel: "text-embedding-3-small",
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Algorithm:    AlgorithmTokenBucket,
+			Unit:         UnitRequests,
+			Capacity:     100,
+			RefillRate:   100.0 / 60.0,
+			Window:       time.Minute,
+			BatchReserve: 0.2,
+		},
+		Providers: ProvidersConfig{
+			Timeout:                 60 * time.Second,
+			StreamFirstTokenTimeout: 60 * time.Second,
+			StreamIdleTimeout:       30 * time.Second,
+			MaxIdleConnsPerHost:     100,
+			IdleConnTimeout:         90 * time.Second,
+			HealthProbeInterval:     30 * time.Second,
+			RetryBudget: RetryBudgetConfig{
+				Capacity:   100,
+				RefillRate: 10,
+			},
+			// Anthropic requires max_tokens
+			Defaults: map[string]ProviderDefaultsConfig{
+				"anthropic": {MaxTokens: 1024},
+			},
+			OpenAI: OpenAIConfig{
+				ReasoningModels: []string{"o1", "o3", "o4"},
+			},
+			Azure: AzureConfig{
+				APIVersion: "2024-02-01",
+			},
+		},
+		Embeddings: EmbeddingsConfig{
+			BatchSize:      100,
+			MaxConcurrency: 4,
+		},
+		Shadow: ShadowConfig{
+			Timeout:     60 * time.Second,
+			MaxInFlight: 100,
+		},
+		Filters: FiltersConfig{
+			Redaction: "[REDACTED]",
+		},
+		Tracing: TracingConfig{
+			ServiceName:  "ai-gateway",
+			OTLPProtocol: tracing.ProtocolHTTP,
+			Sampler:      tracing.SamplerAlways,
+			SampleRatio:  1,
+		},
+		Usage: UsageConfig{
+			BufferSize:    10000,
+			BatchSize:     100,
+			FlushInterval: time.Second,
+		},
+		StrictModelRouting: true,
+		Prices:             usage.DefaultPriceTable(),
+	}
+}
+
+// LoadConfig loads the configuration file at path over the defaults, then
+// applies environment variable overrides and validates the result. An
+// empty path skips the file. JSON files are accepted as well as YAML.
+func LoadConfig(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration is usable
+func (c *Config) Validate() error {
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.RequestTimeout < 0 {
+		return fmt.Errorf("server.request_timeout must not be negative")
+	}
+	if c.Server.MaxInFlight < 0 {
+		return fmt.Errorf("server.max_in_flight must not be negative")
+	}
+	if c.Server.CompressionMinSize < 0 {
+		return fmt.Errorf("server.compression_min_size must not be negative")
+	}
+	if c.Server.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("server.shutdown_grace_period must not be negative")
+	}
+	if c.Cache.Backend != BackendRedis && c.Cache.Backend != BackendMemory {
+		return fmt.Errorf("cache.backend must be %s or %s, got %q", BackendRedis, BackendMemory, c.Cache.Backend)
+	}
+	if c.Cache.MaxEntries < 0 {
+		return fmt.Errorf("cache.max_entries must not be negative")
+	}
+	if c.Cache.TTL < 0 {
+		return fmt.Errorf("cache.ttl must not be negative")
+	}
+	for prefix, ttl := range c.Cache.TTLOverrides {
+		if ttl < 0 {
+			return fmt.Errorf("cache.ttl_overrides: TTL of %s must not be negative", prefix)
+		}
+		if c.Cache.StaleTTL > 0 && c.Cache.StaleTTL <= ttl {
+			return fmt.Errorf("cache.stale_ttl must exceed cache.ttl_overrides, %s of %s", ttl, prefix)
+		}
+	}
+	if c.Cache.StaleTTL < 0 {
+		return fmt.Errorf("cache.stale_ttl must not be negative")
+	}
+	if c.Cache.StaleTTL > 0 && c.Cache.StaleTTL <= c.Cache.TTL {
+		return fmt.Errorf("cache.stale_ttl must exceed cache.ttl, %s", c.Cache.TTL)
+	}
+	if c.Cache.Semantic.Threshold < 0 || c.Cache.Semantic.Threshold > 1 {
+		return fmt.Errorf("cache.semantic.threshold must be between 0 and 1, got %g", c.Cache.Semantic.Threshold)
+	}
+
+	switch c.RateLimit.Algorithm {
+	case AlgorithmTokenBucket:
+		if c.RateLimit.RefillRate <= 0 {
+			return fmt.Errorf("rate_limit.refill_rate must be positive")
+		}
+	case AlgorithmSlidingWindow:
+		if c.RateLimit.Window <= 0 {
+			return fmt.Errorf("rate_limit.window must be positive")
+		}
+	default:
+		return fmt.Errorf("rate_limit.algorithm must be %s or %s, got %q", AlgorithmTokenBucket, AlgorithmSlidingWindow, c.RateLimit.Algorithm)
+	}
+	if c.RateLimit.Unit != UnitRequests && c.RateLimit.Unit != UnitTokens {
+		return fmt.Errorf("rate_limit.unit must be %s or %s, got %q", UnitRequests, UnitTokens, c.RateLimit.Unit)
+	}
+	if c.RateLimit.MaxWait < 0 {
+		return fmt.Errorf("rate_limit.max_wait must not be negative")
+	}
+	if c.RateLimit.BatchReserve < 0 || c.RateLimit.BatchReserve >= 1 {
+		return fmt.Errorf("rate_limit.batch_reserve must be at least 0 and below 1, got %g", c.RateLimit.BatchReserve)
+	}
+	if c.RateLimit.Capacity <= 0 {
+		return fmt.Errorf("rate_limit.capacity must be positive")
+	}
+	if c.RateLimit.SoftLimit < 0 || c.RateLimit.SoftLimit >= c.RateLimit.Capacity {
+		return fmt.Errorf("rate_limit.soft_limit must be at least 0 and below rate_limit.capacity, got %d", c.RateLimit.SoftLimit)
+	}
+	if perKey := c.RateLimit.PerKey; perKey.Capacity < 0 {
+		return fmt.Errorf("rate_limit.per_key.capacity must not be negative")
+	} else if perKey.Capacity > 0 && c.RateLimit.Algorithm == AlgorithmTokenBucket && perKey.RefillRate <= 0 {
+		return fmt.Errorf("rate_limit.per_key.refill_rate must be positive")
+	}
+	for userID, limits := range c.RateLimit.Users {
+		if limits.Soft < 0 || limits.Hard < 0 || limits.RefillRate < 0 {
+			return fmt.Errorf("rate_limit.users.%s: limits must not be negative", userID)
+		}
+		hard := c.RateLimit.Capacity
+		if limits.Hard > 0 {
+			hard = limits.Hard
+		}
+		if limits.Soft >= hard {
+			return fmt.Errorf("rate_limit.users.%s: soft must be below the hard limit, %d", userID, hard)
+		}
+	}
+
+	if c.Providers.Timeout < 0 {
+		return fmt.Errorf("providers.timeout must not be negative")
+	}
+	if c.Providers.StreamFirstTokenTimeout < 0 || c.Providers.StreamIdleTimeout < 0 {
+		return fmt.Errorf("providers.stream_first_token_timeout and providers.stream_idle_timeout must not be negative")
+	}
+	if c.Providers.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("providers.max_idle_conns_per_host must be positive")
+	}
+	if c.Providers.MaxConnsPerHost < 0 {
+		return fmt.Errorf("providers.max_conns_per_host must not be negative")
+	}
+	if c.Providers.IdleConnTimeout <= 0 {
+		return fmt.Errorf("providers.idle_conn_timeout must be positive")
+	}
+	for name, baseURL := range map[string]string{
+		"providers.openai.base_url":    c.Providers.OpenAI.BaseURL,
+		"providers.anthropic.base_url": c.Providers.Anthropic.BaseURL,
+		"providers.gemini.base_url":    c.Providers.Gemini.BaseURL,
+		"providers.azure.endpoint":     c.Providers.Azure.Endpoint,
+	} {
+		if err := validateBaseURL(baseURL); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if c.Providers.HealthProbeInterval < 0 {
+		return fmt.Errorf("providers.health_probe_interval must not be negative")
+	}
+	if budget := c.Providers.RetryBudget; budget.Capacity < 0 {
+		return fmt.Errorf("providers.retry_budget.capacity must not be negative")
+	} else if budget.Capacity > 0 && budget.RefillRate <= 0 {
+		return fmt.Errorf("providers.retry_budget.refill_rate must be positive")
+	}
+	builtin := map[string]bool{"openai": true, "anthropic": true, "gemini": true, "azure": true}
+	regions := map[string]map[string]bool{}
+	for i, compatible := range c.Providers.Compatible {
+		if compatible.Name == "" || compatible.BaseURL == "" {
+			return fmt.Errorf("providers.compatible[%d]: name and base_url are required", i)
+		}
+		// A name may only repeat for endpoints in distinct regions
+		seen, repeated := regions[compatible.Name]
+		if builtin[compatible.Name] || (repeated && (compatible.Region == "" || seen[""] || seen[compatible.Region])) {
+			return fmt.Errorf("providers.compatible[%d]: duplicate provider name %q", i, compatible.Name)
+		}
+		if !repeated {
+			seen = map[string]bool{}
+			regions[compatible.Name] = seen
+		}
+		seen[compatible.Region] = true
+		if err := validateBaseURL(compatible.BaseURL); err != nil {
+			return fmt.Errorf("providers.compatible[%d].base_url: %w", i, err)
+		}
+	}
+	for name, defaults := range c.Providers.Defaults {
+		if defaults.MaxTokens < 0 {
+			return fmt.Errorf("providers.defaults.%s.max_tokens must not be negative", name)
+		}
+		if t := defaults.Temperature; t != nil && (*t < 0 || *t > 2) {
+			return fmt.Errorf("providers.defaults.%s.temperature must be between 0 and 2, got %g", name, *t)
+		}
+		for alias, model := range defaults.ModelAliases {
+			if model == "" {
+				return fmt.Errorf("providers.defaults.%s.model_aliases.%s: model is required", name, alias)
+			}
+		}
+	}
+	if azure := c.Providers.Azure; azure.Endpoint != "" {
+		if azure.APIKey == "" {
+			return fmt.Errorf("providers.azure.api_key is required with an endpoint")
+		}
+		if len(azure.Deployments) == 0 {
+			return fmt.Errorf("providers.azure.deployments is required with an endpoint")
+		}
+	}
+
+	if c.Tracing.ServiceName == "" {
+		return fmt.Errorf("tracing.service_name is required")
+	}
+	if err := validateBaseURL(c.Tracing.OTLPEndpoint); err != nil {
+		return fmt.Errorf("tracing.otlp_endpoint must be an absolute http or https URL, got %q", c.Tracing.OTLPEndpoint)
+	}
+	if c.Tracing.OTLPProtocol != tracing.ProtocolGRPC && c.Tracing.OTLPProtocol != tracing.ProtocolHTTP {
+		return fmt.Errorf("tracing.otlp_protocol must be %s or %s, got %q", tracing.ProtocolGRPC, tracing.ProtocolHTTP, c.Tracing.OTLPProtocol)
+	}
+	switch c.Tracing.Sampler {
+	case tracing.SamplerAlways, tracing.SamplerNever:
+	case tracing.SamplerRatio:
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			return fmt.Errorf("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+		}
+	default:
+		return fmt.Errorf("tracing.sampler must be %s, %s or %s, got %q", tracing.SamplerAlways, tracing.SamplerNever, tracing.SamplerRatio, c.Tracing.Sampler)
+	}
+
+	if c.Usage.BufferSize < 0 {
+		return fmt.Errorf("usage.buffer_size must not be negative")
+	}
+	if c.Usage.BufferSize > 0 && c.Usage.BatchSize <= 0 {
+		return fmt.Errorf("usage.batch_size must be positive")
+	}
+	if c.Usage.BufferSize > 0 && c.Usage.FlushInterval <= 0 {
+		return fmt.Errorf("usage.flush_interval must be positive")
+	}
+	if c.Usage.PostgresDSN != "" && c.Usage.BufferSize == 0 {
+		return fmt.Errorf("usage.postgres_dsn requires usage.buffer_size to be positive")
+	}
+
+	if c.Embeddings.BatchSize < 0 {
+		return fmt.Errorf("embeddings.batch_size must not be negative")
+	}
+	if c.Embeddings.MaxConcurrency <= 0 {
+		return fmt.Errorf("embeddings.max_concurrency must be positive")
+	}
+
+	if c.Shadow.SampleRate < 0 || c.Shadow.SampleRate > 1 {
+		return fmt.Errorf("shadow.sample_rate must be between 0 and 1, got %g", c.Shadow.SampleRate)
+	}
+	if c.Shadow.Timeout <= 0 {
+		return fmt.Errorf("shadow.timeout must be positive")
+	}
+	if c.Shadow.MaxInFlight <= 0 {
+		return fmt.Errorf("shadow.max_in_flight must be positive")
+	}
+
+	if (c.Metrics.Username == "") != (c.Metrics.Password == "") {
+		return fmt.Errorf("metrics.username and metrics.password must be set together")
+	}
+
+	for i, pattern := range c.Filters.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("filters.redact_patterns[%d]: %w", i, err)
+		}
+	}
+
+	for i, route := range c.Routes {
+		if route.Pattern == "" || route.Provider == "" {
+			return fmt.Errorf("routes[%d]: pattern and provider are required", i)
+		}
+		if _, err := path.Match(route.Pattern, ""); err != nil {
+			return fmt.Errorf("routes[%d]: invalid pattern %q", i, route.Pattern)
+		}
+	}
+
+	if !c.StrictModelRouting && c.DefaultProvider == "" {
+		return fmt.Errorf("default_provider is required when strict_model_routing is disabled")
+	}
+	if c.StrictModelRouting && c.DefaultProvider != "" {
+		return fmt.Errorf("default_provider requires strict_model_routing to be disabled")
+	}
+
+	if c.MonthlyBudgetUSD < 0 {
+		return fmt.Errorf("monthly_budget_usd must not be negative")
+	}
+	for userID, budget := range c.UserBudgetsUSD {
+		if budget < 0 {
+			return fmt.Errorf("user_budgets_usd: budget of %s must not be negative", userID)
+		}
+	}
+	for model, price := range c.Prices {
+		if price.PromptPer1K < 0 || price.CompletionPer1K < 0 || price.CachedPromptPer1K < 0 {
+			return fmt.Errorf("prices: price of %s must not be negative", model)
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set. The variable names predate the config file and are kept for
+// compatibility.
+func (c *Config) applyEnv() error {
+	var err error
+	set := func(key string, apply func(string) error) {
+		value := os.Getenv(key)
+		if value == "" || err != nil {
+			return
+		}
+		if applyErr := apply(value); applyErr != nil {
+			err = fmt.Errorf("invalid %s: %w", key, applyErr)
+		}
+	}
+
+	set("PORT", intVar(&c.Server.Port))
+	set("SHUTDOWN_GRACE_PERIOD", durationVar(&c.Server.ShutdownGracePeriod))
+	set("REQUEST_TIMEOUT", durationVar(&c.Server.RequestTimeout))
+	set("MAX_IN_FLIGHT", intVar(&c.Server.MaxInFlight))
+	set("COMPRESSION_MIN_SIZE", intVar(&c.Server.CompressionMinSize))
+	set("REDIS_ADDR", stringVar(&c.Redis.Addr))
+	set("REDIS_PASSWORD", stringVar(&c.Redis.Password))
+	set("REDIS_DB", intVar(&c.Redis.DB))
+	set("CACHE_BACKEND", stringVar(&c.Cache.Backend))
+	set("CACHE_TTL", durationVar(&c.Cache.TTL))
+	set("CACHE_MAX_ENTRIES", intVar(&c.Cache.MaxEntries))
+	set("CACHE_PER_USER", boolVar(&c.Cache.PerUser))
+	set("CACHE_STALE_TTL", durationVar(&c.Cache.StaleTTL))
+	set("CACHE_TTL_OVERRIDES", func(value string) error {
+		ttls, err := parseCacheTTLs(value)
+		c.Cache.TTLOverrides = ttls
+		return err
+	})
+	set("SEMANTIC_CACHE_THRESHOLD", floatVar(&c.Cache.Semantic.Threshold))
+	set("SEMANTIC_CACHE_MODEL", stringVar(&c.Cache.Semantic.EmbeddingModel))
+	set("RATE_LIMIT_ALGORITHM", stringVar(&c.RateLimit.Algorithm))
+	set("RATE_LIMIT_UNIT", stringVar(&c.RateLimit.Unit))
+	set("RATE_LIMIT_CAPACITY", intVar(&c.RateLimit.Capacity))
+	set("RATE_LIMIT_REFILL_RATE", floatVar(&c.RateLimit.RefillRate))
+	set("RATE_LIMIT_MAX_WAIT", durationVar(&c.RateLimit.MaxWait))
+	set("RATE_LIMIT_BATCH_RESERVE", floatVar(&c.RateLimit.BatchReserve))
+	set("RATE_LIMIT_SOFT_LIMIT", intVar(&c.RateLimit.SoftLimit))
+	set("RATE_LIMIT_KEY_CAPACITY", intVar(&c.RateLimit.PerKey.Capacity))
+	set("RATE_LIMIT_KEY_REFILL_RATE", floatVar(&c.RateLimit.PerKey.RefillRate))
+	set("PROVIDER_TIMEOUT", durationVar(&c.Providers.Timeout))
+	set("PROVIDER_STREAM_FIRST_TOKEN_TIMEOUT", durationVar(&c.Providers.StreamFirstTokenTimeout))
+	set("PROVIDER_STREAM_IDLE_TIMEOUT", durationVar(&c.Providers.StreamIdleTimeout))
+	set("PROVIDER_MAX_IDLE_CONNS_PER_HOST", intVar(&c.Providers.MaxIdleConnsPerHost))
+	set("PROVIDER_MAX_CONNS_PER_HOST", intVar(&c.Providers.MaxConnsPerHost))
+	set("PROVIDER_IDLE_CONN_TIMEOUT", durationVar(&c.Providers.IdleConnTimeout))
+	set("PROVIDER_HOME_REGION", stringVar(&c.Providers.HomeRegion))
+	set("PROVIDER_HEALTH_PROBE_INTERVAL", durationVar(&c.Providers.HealthProbeInterval))
+	set("PROVIDER_STRICT_PARAMETERS", boolVar(&c.Providers.StrictParameters))
+	set("PROVIDER_RETRY_BUDGET_CAPACITY", intVar(&c.Providers.RetryBudget.Capacity))
+	set("PROVIDER_RETRY_BUDGET_REFILL_RATE", floatVar(&c.Providers.RetryBudget.RefillRate))
+	set("OPENAI_API_KEY", stringVar(&c.Providers.OpenAI.APIKey))
+	set("OPENAI_BASE_URL", stringVar(&c.Providers.OpenAI.BaseURL))
+	set("OPENAI_REASONING_MODELS", listVar(&c.Providers.OpenAI.ReasoningModels))
+	set("ANTHROPIC_API_KEY", stringVar(&c.Providers.Anthropic.APIKey))
+	set("ANTHROPIC_BASE_URL", stringVar(&c.Providers.Anthropic.BaseURL))
+	set("GEMINI_API_KEY", stringVar(&c.Providers.Gemini.APIKey))
+	set("GEMINI_BASE_URL", stringVar(&c.Providers.Gemini.BaseURL))
+	set("AZURE_OPENAI_ENDPOINT", stringVar(&c.Providers.Azure.Endpoint))
+	set("AZURE_OPENAI_API_KEY", stringVar(&c.Providers.Azure.APIKey))
+	set("AZURE_OPENAI_API_VERSION", stringVar(&c.Providers.Azure.APIVersion))
+	set("AZURE_OPENAI_DEPLOYMENTS", func(value string) error {
+		deployments, err := parseDeployments(value)
+		c.Providers.Azure.Deployments = deployments
+		return err
+	})
+	set("EMBEDDING_BATCH_SIZE", intVar(&c.Embeddings.BatchSize))
+	set("EMBEDDING_MAX_CONCURRENCY", intVar(&c.Embeddings.MaxConcurrency))
+	set("SHADOW_PROVIDER", stringVar(&c.Shadow.Provider))
+	set("SHADOW_MODEL", stringVar(&c.Shadow.Model))
+	set("SHADOW_SAMPLE_RATE", floatVar(&c.Shadow.SampleRate))
+	set("SHADOW_TIMEOUT", durationVar(&c.Shadow.Timeout))
+	set("SHADOW_MAX_IN_FLIGHT", intVar(&c.Shadow.MaxInFlight))
+	set("JWT_PUBLIC_KEY_FILE", stringVar(&c.Auth.JWTPublicKeyFile))
+	set("METRICS_BEARER_TOKEN", stringVar(&c.Metrics.BearerToken))
+	set("METRICS_USERNAME", stringVar(&c.Metrics.Username))
+	set("METRICS_PASSWORD", stringVar(&c.Metrics.Password))
+	set("LOG_LLM_CONTENT", boolVar(&c.Logging.LLMContent))
+	set("OTEL_SERVICE_NAME", stringVar(&c.Tracing.ServiceName))
+	set("OTEL_EXPORTER_OTLP_ENDPOINT", stringVar(&c.Tracing.OTLPEndpoint))
+	set("OTEL_EXPORTER_OTLP_PROTOCOL", stringVar(&c.Tracing.OTLPProtocol))
+	set("TRACING_SAMPLER", stringVar(&c.Tracing.Sampler))
+	set("TRACING_SAMPLE_RATIO", floatVar(&c.Tracing.SampleRatio))
+	set("USAGE_BUFFER_SIZE", intVar(&c.Usage.BufferSize))
+	set("USAGE_BATCH_SIZE", intVar(&c.Usage.BatchSize))
+	set("USAGE_FLUSH_INTERVAL", durationVar(&c.Usage.FlushInterval))
+	set("USAGE_POSTGRES_DSN", stringVar(&c.Usage.PostgresDSN))
+	set("STRICT_MODEL_ROUTING", boolVar(&c.StrictModelRouting))
+	set("DEFAULT_PROVIDER", stringVar(&c.DefaultProvider))
+	set("MONTHLY_BUDGET_USD", floatVar(&c.MonthlyBudgetUSD))
+	return err
+}
+
+func stringVar(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func intVar(dst *int) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.Atoi(value)
+		return err
+	}
+}
+
+func floatVar(dst *float64) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.ParseFloat(value, 64)
+		return err
+	}
+}
+
+func boolVar(dst *bool) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.ParseBool(value)
+		return err
+	}
+}
+
+// listVar parses a comma-separated list
+func listVar(dst *[]string) func(string) error {
+	return func(value string) error {
+		*dst = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+		return nil
+	}
+}
+
+func durationVar(dst *time.Duration) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = time.ParseDuration(value)
+		return err
+	}
+}
+
+// parseDeployments parses a comma-separated list of model=deployment pairs
+func parseDeployments(value string) (map[string]string, error) {
+	deployments := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, deployment, ok := strings.Cut(pair, "=")
+		if !ok || model == "" || deployment == "" {
+			return nil, fmt.Errorf("expected model=deployment, got %q", pair)
+		}
+		deployments[strings.TrimSpace(model)] = strings.TrimSpace(deployment)
+	}
+	return deployments, nil
+}
+
+// parseCacheTTLs parses a comma-separated list of model=duration pairs
+func parseCacheTTLs(value string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, duration, ok := strings.Cut(pair, "=")
+		if !ok || model == "" {
+			return nil, fmt.Errorf("expected model=duration, got %q", pair)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for %s: %w", model, err)
+		}
+		ttls[strings.TrimSpace(model)] = ttl
+	}
+	return ttls, nil
+}
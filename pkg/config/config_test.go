@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
+)
+
+// envKeys lists every environment override
+var envKeys = []string{
+	"PORT", "SHUTDOWN_GRACE_PERIOD", "REQUEST_TIMEOUT", "MAX_IN_FLIGHT", "COMPRESSION_MIN_SIZE",
+	"REDIS_ADDR", "REDIS_PASSWORD", "REDIS_DB",
+	"CACHE_BACKEND", "CACHE_TTL", "CACHE_MAX_ENTRIES", "CACHE_PER_USER", "CACHE_STALE_TTL", "CACHE_TTL_OVERRIDES", "SEMANTIC_CACHE_THRESHOLD", "SEMANTIC_CACHE_MODEL",
+	"RATE_LIMIT_ALGORITHM", "RATE_LIMIT_UNIT", "RATE_LIMIT_CAPACITY", "RATE_LIMIT_REFILL_RATE", "RATE_LIMIT_MAX_WAIT", "RATE_LIMIT_BATCH_RESERVE", "RATE_LIMIT_SOFT_LIMIT", "RATE_LIMIT_KEY_CAPACITY", "RATE_LIMIT_KEY_REFILL_RATE",
+	"PROVIDER_TIMEOUT", "PROVIDER_STREAM_FIRST_TOKEN_TIMEOUT", "PROVIDER_STREAM_IDLE_TIMEOUT", "PROVIDER_MAX_IDLE_CONNS_PER_HOST", "PROVIDER_MAX_CONNS_PER_HOST", "PROVIDER_IDLE_CONN_TIMEOUT", "PROVIDER_HOME_REGION", "PROVIDER_HEALTH_PROBE_INTERVAL", "PROVIDER_STRICT_PARAMETERS", "PROVIDER_RETRY_BUDGET_CAPACITY", "PROVIDER_RETRY_BUDGET_REFILL_RATE", "OPENAI_API_KEY", "OPENAI_BASE_URL", "OPENAI_REASONING_MODELS", "ANTHROPIC_API_KEY", "ANTHROPIC_BASE_URL",
+	"GEMINI_API_KEY", "GEMINI_BASE_URL", "AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_API_KEY",
+	"AZURE_OPENAI_API_VERSION", "AZURE_OPENAI_DEPLOYMENTS", "EMBEDDING_BATCH_SIZE", "EMBEDDING_MAX_CONCURRENCY",
+	"SHADOW_PROVIDER", "SHADOW_MODEL", "SHADOW_SAMPLE_RATE", "SHADOW_TIMEOUT", "SHADOW_MAX_IN_FLIGHT",
+	"JWT_PUBLIC_KEY_FILE", "METRICS_BEARER_TOKEN", "METRICS_USERNAME", "METRICS_PASSWORD", "LOG_LLM_CONTENT", "OTEL_SERVICE_NAME", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "TRACING_SAMPLER", "TRACING_SAMPLE_RATIO",
+	"USAGE_BUFFER_SIZE", "USAGE_BATCH_SIZE", "USAGE_FLUSH_INTERVAL", "USAGE_POSTGRES_DSN",
+	"STRICT_MODEL_ROUTING", "DEFAULT_PROVIDER", "MONTHLY_BUDGET_USD",
+}
+
+// clearEnv unsets the environment overrides for the duration of a test
+func clearEnv(t *testing.T) {
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, AlgorithmTokenBucket, cfg.RateLimit.Algorithm)
+	assert.Equal(t, 5*time.Minute, cfg.Cache.TTL)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := LoadConfig("testdata/gateway.yaml")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 9090, cfg.Server.Port)
+	assert.Equal(t, time.Minute, cfg.Server.ShutdownGracePeriod)
+	assert.Equal(t, 60*time.Second, cfg.Server.ReadTimeout, "unset fields keep their defaults")
+	assert.Equal(t, RedisConfig{Addr: "redis:6379", DB: 2}, cfg.Redis)
+	assert.Equal(t, 10*time.Minute, cfg.Cache.TTL)
+	assert.Equal(t, map[string]time.Duration{"gpt-4": time.Hour}, cfg.Cache.TTLOverrides)
+	assert.Equal(t, 0.95, cfg.Cache.Semantic.Threshold)
+	assert.Equal(t, RateLimitConfig{Algorithm: AlgorithmSlidingWindow, Unit: UnitRequests, Capacity: 50, RefillRate: 100.0 / 60.0, Window: 30 * time.Second, BatchReserve: 0.2}, cfg.RateLimit)
+	assert.Equal(t, 2*time.Minute, cfg.Providers.Timeout)
+	assert.Equal(t, "sk-file", cfg.Providers.OpenAI.APIKey)
+	assert.Equal(t, "2024-02-01", cfg.Providers.Azure.APIVersion)
+	assert.Equal(t, map[string]string{"gpt-4o": "prod-gpt4o"}, cfg.Providers.Azure.Deployments)
+	assert.Equal(t, []CompatibleProviderConfig{{Name: "groq", BaseURL: "https://api.groq.com/openai/v1", APIKey: "gsk-file", ModelPrefix: "groq/"}}, cfg.Providers.Compatible)
+
+	// File prices extend the default table
+	assert.Equal(t, usage.ModelPrice{PromptPer1K: 0.01, CompletionPer1K: 0.02}, cfg.Prices["my-finetune"])
+	assert.Contains(t, cfg.Prices, "gpt-4o")
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"server": {"port": 7070}, "cache": {"ttl": "1m"}}`), 0o600))
+
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 7070, cfg.Server.Port)
+	assert.Equal(t, time.Minute, cfg.Cache.TTL)
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PORT", "8181")
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	t.Setenv("CACHE_TTL_OVERRIDES", "gpt-3.5=5m")
+	t.Setenv("CACHE_BACKEND", "memory")
+	t.Setenv("OPENAI_REASONING_MODELS", "o1, o3,gpt-5")
+
+	cfg, err := LoadConfig("testdata/gateway.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, 8181, cfg.Server.Port)
+	assert.Equal(t, "sk-env", cfg.Providers.OpenAI.APIKey)
+	assert.Equal(t, map[string]time.Duration{"gpt-3.5": 5 * time.Minute}, cfg.Cache.TTLOverrides)
+	assert.Equal(t, BackendMemory, cfg.Cache.Backend)
+	assert.Equal(t, []string{"o1", "o3", "gpt-5"}, cfg.Providers.OpenAI.ReasoningModels)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		env   map[string]string
+		error string
+	}{
+		{"malformed env value", map[string]string{"RATE_LIMIT_CAPACITY": "lots"}, "invalid RATE_LIMIT_CAPACITY"},
+		{"malformed duration", map[string]string{"CACHE_TTL": "5"}, "invalid CACHE_TTL"},
+		{"stale TTL within freshness", map[string]string{"CACHE_TTL": "1h", "CACHE_STALE_TTL": "30m"}, "cache.stale_ttl must exceed cache.ttl"},
+		{"stale TTL within override", map[string]string{"CACHE_STALE_TTL": "2h", "CACHE_TTL_OVERRIDES": "gpt-4=3h"}, "cache.stale_ttl must exceed cache.ttl_overrides"},
+		{"port out of range", map[string]string{"PORT": "70000"}, "server.port"},
+		{"negative max in flight", map[string]string{"MAX_IN_FLIGHT": "-1"}, "server.max_in_flight"},
+		{"negative compression min size", map[string]string{"COMPRESSION_MIN_SIZE": "-1"}, "server.compression_min_size"},
+		{"unknown cache backend", map[string]string{"CACHE_BACKEND": "memcached"}, "cache.backend"},
+		{"no embedding concurrency", map[string]string{"EMBEDDING_MAX_CONCURRENCY": "0"}, "embeddings.max_concurrency"},
+		{"shadow sample rate above 1", map[string]string{"SHADOW_SAMPLE_RATE": "1.5"}, "shadow.sample_rate"},
+		{"negative max wait", map[string]string{"RATE_LIMIT_MAX_WAIT": "-1s"}, "rate_limit.max_wait"},
+		{"metrics username without password", map[string]string{"METRICS_USERNAME": "prometheus"}, "metrics.username"},
+		{"soft limit above capacity", map[string]string{"RATE_LIMIT_SOFT_LIMIT": "100"}, "rate_limit.soft_limit"},
+		{"key limit without refill", map[string]string{"RATE_LIMIT_KEY_CAPACITY": "10"}, "rate_limit.per_key.refill_rate"},
+		{"whole limit reserved", map[string]string{"RATE_LIMIT_BATCH_RESERVE": "1"}, "rate_limit.batch_reserve"},
+		{"negative stream idle timeout", map[string]string{"PROVIDER_STREAM_IDLE_TIMEOUT": "-1s"}, "providers.stream_idle_timeout"},
+		{"unknown otlp protocol", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "thrift"}, "tracing.otlp_protocol"},
+		{"relative otlp endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}, "tracing.otlp_endpoint"},
+		{"sample ratio above 1", map[string]string{"TRACING_SAMPLER": "ratio", "TRACING_SAMPLE_RATIO": "2"}, "tracing.sample_ratio"},
+		{"unknown unit", map[string]string{"RATE_LIMIT_UNIT": "dollars"}, "rate_limit.unit"},
+		{"unknown algorithm", map[string]string{"RATE_LIMIT_ALGORITHM": "leaky_bucket"}, "rate_limit.algorithm"},
+		{"no idle connections", map[string]string{"PROVIDER_MAX_IDLE_CONNS_PER_HOST": "0"}, "providers.max_idle_conns_per_host"},
+		{"negative connection cap", map[string]string{"PROVIDER_MAX_CONNS_PER_HOST": "-1"}, "providers.max_conns_per_host"},
+		{"no idle connection timeout", map[string]string{"PROVIDER_IDLE_CONN_TIMEOUT": "0s"}, "providers.idle_conn_timeout"},
+		{"retry budget without refill", map[string]string{"PROVIDER_RETRY_BUDGET_REFILL_RATE": "0"}, "providers.retry_budget.refill_rate"},
+		{"negative health probe interval", map[string]string{"PROVIDER_HEALTH_PROBE_INTERVAL": "-1s"}, "providers.health_probe_interval"},
+		{"relative base url", map[string]string{"OPENAI_BASE_URL": "localhost:8000/v1"}, "providers.openai.base_url"},
+		{"unbuffered postgres usage", map[string]string{"USAGE_BUFFER_SIZE": "0", "USAGE_POSTGRES_DSN": "postgres://localhost/gateway"}, "usage.postgres_dsn"},
+		{"no usage batch size", map[string]string{"USAGE_BATCH_SIZE": "0"}, "usage.batch_size"},
+		{"lenient routing without default provider", map[string]string{"STRICT_MODEL_ROUTING": "false"}, "default_provider is required"},
+		{"default provider in strict mode", map[string]string{"DEFAULT_PROVIDER": "openai"}, "strict_model_routing"},
+		{"azure without deployments", map[string]string{"AZURE_OPENAI_ENDPOINT": "https://example.openai.azure.com", "AZURE_OPENAI_API_KEY": "key"}, "providers.azure.deployments"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig("")
+			assert.ErrorContains(t, err, tc.error)
+		})
+	}
+
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("providers:\n  compatible:\n    - name: openai\n      base_url: http://localhost:8000/v1\n"), 0o600))
+	_, err := LoadConfig(path)
+	assert.ErrorContains(t, err, `duplicate provider name "openai"`)
+
+	// Entries may share a name only as endpoints in distinct regions
+	regional := "providers:\n  compatible:\n    - name: vllm\n      base_url: http://a/v1\n      region: eu-west\n    - name: vllm\n      base_url: http://b/v1\n      region: %s\n"
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(regional, "us-east")), 0o600))
+	_, err = LoadConfig(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(regional, "eu-west")), 0o600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, `duplicate provider name "vllm"`)
+
+	assert.NoError(t, os.WriteFile(path, []byte("providers:\n  defaults:\n    openai:\n      temperature: 3\n"), 0o600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "providers.defaults.openai.temperature")
+
+	assert.NoError(t, os.WriteFile(path, []byte("rate_limit:\n  users:\n    user-1: {soft: 50, hard: 50}\n"), 0o600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "rate_limit.users.user-1: soft must be below the hard limit")
+
+	assert.NoError(t, os.WriteFile(path, []byte("rate_limit:\n  users:\n    user-1: {hard: 500, refill_rate: -1}\n"), 0o600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "rate_limit.users.user-1: limits must not be negative")
+
+	assert.NoError(t, os.WriteFile(path, []byte("filters:\n  redact_patterns: ['[a-z']\n"), 0o600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "filters.redact_patterns[0]")
+
+	_, err = LoadConfig("testdata/missing.yaml")
+	assert.ErrorContains(t, err, "failed to read config")
+}
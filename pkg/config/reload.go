@@ -0,0 +1,122 @@
+package config
+
+import (
+	"log"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// RestartRequired returns the settings that differ in next but only take
+// effect after a restart. Everything except the rate limits, routes, prices
+// and budgets is fixed at startup, as is whether API keys are rate limited.
+func (c *Config) RestartRequired(next *Config) []string {
+	var changed []string
+	sections := []struct {
+		name       string
+		prev, next interface{}
+	}{
+		{"server", c.Server, next.Server},
+		{"redis", c.Redis, next.Redis},
+		{"cache", c.Cache, next.Cache},
+		{"rate_limit.algorithm", c.RateLimit.Algorithm, next.RateLimit.Algorithm},
+		{"rate_limit.per_key", c.RateLimit.PerKey.Capacity > 0, next.RateLimit.PerKey.Capacity > 0},
+		{"providers", c.Providers, next.Providers},
+		{"embeddings", c.Embeddings, next.Embeddings},
+		{"shadow", c.Shadow, next.Shadow},
+		{"filters", c.Filters, next.Filters},
+		{"auth", c.Auth, next.Auth},
+		{"metrics", c.Metrics, next.Metrics},
+		{"logging", c.Logging, next.Logging},
+		{"tracing", c.Tracing, next.Tracing},
+		{"usage", c.Usage, next.Usage},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.prev, section.next) {
+			changed = append(changed, section.name)
+		}
+	}
+	return changed
+}
+
+// withReloadable returns a copy of c with the reloadable settings of next
+func (c *Config) withReloadable(next *Config) *Config {
+	merged := *c
+	merged.RateLimit.Capacity = next.RateLimit.Capacity
+	merged.RateLimit.RefillRate = next.RateLimit.RefillRate
+	merged.RateLimit.Window = next.RateLimit.Window
+	merged.RateLimit.MaxWait = next.RateLimit.MaxWait
+	merged.RateLimit.BatchReserve = next.RateLimit.BatchReserve
+	merged.RateLimit.SoftLimit = next.RateLimit.SoftLimit
+	merged.RateLimit.Users = next.RateLimit.Users
+	// The per-key limiter only exists if it was enabled at startup
+	if (c.RateLimit.PerKey.Capacity > 0) == (next.RateLimit.PerKey.Capacity > 0) {
+		merged.RateLimit.PerKey = next.RateLimit.PerKey
+	}
+	merged.Routes = next.Routes
+	merged.StrictModelRouting = next.StrictModelRouting
+	merged.DefaultProvider = next.DefaultProvider
+	merged.Prices = next.Prices
+	merged.MonthlyBudgetUSD = next.MonthlyBudgetUSD
+	merged.UserBudgetsUSD = next.UserBudgetsUSD
+	return &merged
+}
+
+// Reloader reloads the configuration file on demand, typically on SIGHUP.
+// Only the rate limits, routes, prices and budgets are reloaded; changes to
+// other settings are logged and ignored.
+type Reloader struct {
+	path    string
+	current *Config
+	apply   func(*Config)
+	mu      sync.Mutex
+}
+
+// NewReloader creates a reloader of the file at path. apply is called with
+// each reloaded configuration and must swap the reloadable settings into
+// the running gateway.
+func NewReloader(path string, current *Config, apply func(*Config)) *Reloader {
+	return &Reloader{
+		path:    path,
+		current: current,
+		apply:   apply,
+	}
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads the configuration again and applies its reloadable
+// settings. On error the configuration in effect is kept.
+func (r *Reloader) Reload() error {
+	next, err := LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range r.current.RestartRequired(next) {
+		log.Printf("Config reload: %s changed; restart to apply", name)
+	}
+	r.current = r.current.withReloadable(next)
+	r.apply(r.current)
+	return nil
+}
+
+// Watch reloads the configuration on every signal received until signals
+// is closed
+func (r *Reloader) Watch(signals <-chan os.Signal) {
+	for range signals {
+		if err := r.Reload(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+			continue
+		}
+		log.Println("✓ Configuration reloaded")
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+func TestReloadAppliesNewRateLimit(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig := func(body string) {
+		assert.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+	}
+	writeConfig("server:\n  port: 8080\nrate_limit:\n  capacity: 5\n  refill_rate: 0.001\n")
+
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	limiter := ratelimit.NewRateLimiter(int64(cfg.RateLimit.Capacity), cfg.RateLimit.RefillRate)
+
+	applied := make(chan *Config, 1)
+	reloader := NewReloader(path, cfg, func(c *Config) {
+		limiter.SetDefaultLimit(int64(c.RateLimit.Capacity), c.RateLimit.RefillRate)
+		applied <- c
+	})
+
+	signals := make(chan os.Signal, 1)
+	go reloader.Watch(signals)
+	defer close(signals)
+
+	assert.True(t, limiter.Allow("user-1", 1))
+
+	// Lower the limit and change the port, which needs a restart
+	writeConfig("server:\n  port: 9090\nrate_limit:\n  capacity: 2\n  refill_rate: 0.001\nroutes:\n  - pattern: my-model\n    provider: openai\n")
+	signals <- os.Interrupt
+	reloaded := <-applied
+
+	assert.Equal(t, 2, reloaded.RateLimit.Capacity)
+	assert.Equal(t, []RouteConfig{{Pattern: "my-model", Provider: "openai"}}, reloaded.Routes)
+	assert.Equal(t, 8080, reloaded.Server.Port, "restart-only settings are ignored")
+	assert.Equal(t, reloaded, reloader.Current())
+
+	// The existing bucket now holds at most the new capacity
+	assert.True(t, limiter.Allow("user-1", 1))
+	assert.True(t, limiter.Allow("user-1", 1))
+	assert.False(t, limiter.Allow("user-1", 1))
+}
+
+func TestReloadKeepsConfigOnError(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("rate_limit:\n  capacity: 5\n"), 0o600))
+
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	reloader := NewReloader(path, cfg, func(*Config) { t.Fatal("invalid config applied") })
+
+	assert.NoError(t, os.WriteFile(path, []byte("rate_limit:\n  capacity: -1\n"), 0o600))
+	assert.ErrorContains(t, reloader.Reload(), "rate_limit.capacity")
+	assert.Same(t, cfg, reloader.Current())
+}
+
+func TestRestartRequired(t *testing.T) {
+	prev := Default()
+	next := Default()
+	next.Server.Port = 9090
+	next.Providers.OpenAI.APIKey = "sk-new"
+	next.RateLimit.Capacity = 10
+	next.MonthlyBudgetUSD = 50
+
+	assert.Equal(t, []string{"server", "providers"}, prev.RestartRequired(next))
+
+	// Per-key limits can change, but not be turned on or off
+	prev.RateLimit.PerKey = KeyRateLimitConfig{Capacity: 5, RefillRate: 1}
+	next.RateLimit.PerKey = KeyRateLimitConfig{Capacity: 10, RefillRate: 2}
+	assert.Equal(t, []string{"server", "providers"}, prev.RestartRequired(next))
+	assert.Equal(t, next.RateLimit.PerKey, prev.withReloadable(next).RateLimit.PerKey)
+
+	next.RateLimit.PerKey = KeyRateLimitConfig{}
+	assert.Equal(t, []string{"server", "rate_limit.per_key", "providers"}, prev.RestartRequired(next))
+	assert.Equal(t, prev.RateLimit.PerKey, prev.withReloadable(next).RateLimit.PerKey)
+}
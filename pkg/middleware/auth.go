@@ -1,28 +1,30 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates API keys
+// AuthMiddleware validates API keys, storing the user a key belongs to as
+// user_id in the context and the key's APIKeyID as api_key_id
 func AuthMiddleware(validKeys map[string]string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract API key from header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
-			c.Abort()
+			RespondError(c, http.StatusUnauthorized, errors.New("missing authorization header"))
 			return
 		}
 
 		// Parse Bearer token
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
-			c.Abort()
+			RespondError(c, http.StatusUnauthorized, errors.New("invalid authorization format"))
 			return
 		}
 
@@ -31,14 +33,21 @@ func AuthMiddleware(validKeys map[string]string) gin.HandlerFunc {
 		// Validate API key
 		userID, valid := validKeys[apiKey]
 		if !valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
-			c.Abort()
+			RespondError(c, http.StatusUnauthorized, errors.New("invalid API key"))
 			return
 		}
 
-		// Store user ID in context
+		// Store user ID and key in context
 		c.Set("user_id", userID)
+		c.Set("api_key_id", APIKeyID(apiKey))
 		c.Next()
 	}
 }
 
+// APIKeyID identifies an API key without revealing it, e.g. in rate limit
+// keys and stats
+func APIKeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
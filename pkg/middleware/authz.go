@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelScopePrefix marks token scopes that grant access to models, e.g.
+// "models:gpt-4" allows every model starting with "gpt-4" and "models:*"
+// allows every model
+const ModelScopePrefix = "models:"
+
+// AdminScope is the token scope granting access to the admin endpoints
+const AdminScope = "admin"
+
+// ModelOverrideScope is the token scope allowing the X-Model-Override
+// header; admins may use it too
+const ModelOverrideScope = "model_override"
+
+// HasScope reports whether the request's token grants scope. It reads the
+// scopes set by JWTAuthMiddleware, so without JWT authentication it is
+// always false.
+func HasScope(c *gin.Context, scope string) bool {
+	for _, granted := range c.GetStringSlice("scopes") {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects requests whose token lacks scope with 403 Forbidden.
+// Without JWT authentication every request is rejected.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if HasScope(c, scope) {
+			c.Next()
+			return
+		}
+		RespondError(c, http.StatusForbidden, errors.New("missing required scope: "+scope))
+	}
+}
+
+// ModelAccessPolicy decides which models a user may call. Allowed model
+// prefixes come from the user's token scopes and from a static per-user map.
+// Users without any model restriction may call every model.
+type ModelAccessPolicy struct {
+	userModels map[string][]string
+}
+
+// NewModelAccessPolicy creates a new policy from allowed model prefixes
+// keyed by user ID
+func NewModelAccessPolicy(userModels map[string][]string) *ModelAccessPolicy {
+	if userModels == nil {
+		userModels = make(map[string][]string)
+	}
+	return &ModelAccessPolicy{
+		userModels: userModels,
+	}
+}
+
+// Allowed reports whether the user may call the model
+func (p *ModelAccessPolicy) Allowed(userID string, scopes []string, model string) bool {
+	prefixes := p.userModels[userID]
+	for _, scope := range scopes {
+		if strings.HasPrefix(scope, ModelScopePrefix) {
+			prefixes = append(prefixes, strings.TrimPrefix(scope, ModelScopePrefix))
+		}
+	}
+
+	// No restriction configured for this user
+	if prefixes == nil {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if prefix == "*" || strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelAccessPolicy(t *testing.T) {
+	policy := NewModelAccessPolicy(map[string][]string{
+		"free-user": {"gpt-3.5"},
+	})
+
+	// Static per-user policy
+	assert.True(t, policy.Allowed("free-user", nil, "gpt-3.5-turbo"))
+	assert.False(t, policy.Allowed("free-user", nil, "gpt-4"))
+
+	// Token scopes
+	assert.True(t, policy.Allowed("scoped-user", []string{"models:claude-"}, "claude-3-opus-20240229"))
+	assert.False(t, policy.Allowed("scoped-user", []string{"models:claude-"}, "gpt-4"))
+	assert.True(t, policy.Allowed("scoped-user", []string{"models:*"}, "gpt-4"))
+
+	// Users without restrictions may call anything
+	assert.True(t, policy.Allowed("other-user", []string{"admin"}, "gpt-4"))
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	send := func(scopes []string) int {
+		engine := gin.New()
+		engine.Use(func(c *gin.Context) {
+			if scopes != nil {
+				c.Set("scopes", scopes)
+			}
+		})
+		engine.GET("/admin", RequireScope(AdminScope), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send([]string{"models:*", "admin"}))
+	assert.Equal(t, http.StatusForbidden, send([]string{"models:*"}))
+	assert.Equal(t, http.StatusForbidden, send(nil))
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriters pools gzip writers, which are costly to allocate
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// CompressionMiddleware gzips responses of at least minSize bytes for
+// clients that accept gzip. Smaller responses are sent as they are, as are
+// server-sent event streams and any response the handler flushes, since
+// compression would hold back their incremental delivery. A minSize of zero
+// or less disables compression.
+func CompressionMiddleware(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if minSize <= 0 {
+			c.Next()
+			return
+		}
+		c.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &gzipResponseWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+			w.finish()
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return strings.TrimRight(q, "0.") != "q="
+	}
+	return false
+}
+
+// gzipResponseWriter buffers a response until it reaches minSize, then
+// compresses it. Streamed and already encoded responses pass through.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+	passthrough bool
+}
+
+// Write implements io.Writer
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(data)
+	case w.passthrough:
+		return w.ResponseWriter.Write(data)
+	}
+
+	header := w.Header()
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") || header.Get("Content-Encoding") != "" {
+		if err := w.pass(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() < w.minSize {
+		return len(data), nil
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf.Reset()
+	return len(data), nil
+}
+
+// WriteString implements io.StringWriter
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written reports whether the response has been started, including when
+// it is still buffered
+func (w *gzipResponseWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// WriteHeaderNow sends the headers, so the response can no longer be
+// compressed
+func (w *gzipResponseWriter) WriteHeaderNow() {
+	if w.gz == nil {
+		w.passthrough = true
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush sends what has been written so far. A response flushed before it
+// is compressed is being streamed, so it is sent uncompressed.
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	} else {
+		w.pass()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// pass sends the buffered response uncompressed and stops buffering
+func (w *gzipResponseWriter) pass() error {
+	w.passthrough = true
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// finish completes the response once the handlers return
+func (w *gzipResponseWriter) finish() {
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+		return
+	}
+	w.pass()
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCompressionEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(CompressionMiddleware(1024))
+	engine.GET("/large", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"content": strings.Repeat("completion ", 500)})
+	})
+	engine.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"content": "Hi"})
+	})
+	engine.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			c.SSEvent("", strings.Repeat("chunk ", 500))
+			c.Writer.Flush()
+		}
+	})
+	return engine
+}
+
+func get(engine *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	engine := newCompressionEngine()
+
+	// Large responses are gzipped
+	w := get(engine, "/large", "gzip, deflate")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	gz, err := gzip.NewReader(w.Body)
+	if assert.NoError(t, err) {
+		body, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `{"content":"completion completion`)
+	}
+
+	// Small responses and clients not accepting gzip get plain responses
+	w = get(engine, "/small", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, `{"content":"Hi"}`, w.Body.String())
+	w = get(engine, "/large", "")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	w = get(engine, "/large", "gzip;q=0")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
+
+func TestCompressionSkipsStreams(t *testing.T) {
+	engine := newCompressionEngine()
+
+	w := get(engine, "/stream", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "data:chunk chunk"))
+}
+
+func TestCompressionDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(CompressionMiddleware(0))
+	engine.GET("/large", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("completion ", 500))
+	})
+
+	w := get(engine, "/large", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Header().Get("Vary"))
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"deflate, gzip;q=1":     true,
+		"br;q=1.0, gzip; q=0.5": true,
+		"gzip;q=0":              false,
+		"gzip;q=0.000":          false,
+		"*":                     true,
+		"identity":              false,
+	} {
+		assert.Equal(t, want, acceptsGzip(header), header)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// concurrencyRetryAfter is the Retry-After, in seconds, of requests
+// rejected for exceeding the in-flight limit
+const concurrencyRetryAfter = 1
+
+// ConcurrencyLimitMiddleware caps the requests handled at once by the
+// routes it is applied to, so a traffic spike cannot exhaust upstream
+// connections or memory. Requests over the limit are rejected right away
+// with 503 and a Retry-After rather than queued. The in-flight count is
+// exported as http_requests_in_flight, labeled by route. A limit of zero
+// or less disables the cap but still counts the requests.
+func ConcurrencyLimitMiddleware(limit int) gin.HandlerFunc {
+	var slots chan struct{}
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+
+	return func(c *gin.Context) {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				c.Header("Retry-After", strconv.Itoa(concurrencyRetryAfter))
+				RespondError(c, http.StatusServiceUnavailable, errors.New("too many requests in flight"))
+				return
+			}
+		}
+
+		inFlight := httpRequestsInFlight.WithLabelValues(c.FullPath())
+		inFlight.Inc()
+		defer inFlight.Dec()
+		c.Next()
+	}
+}
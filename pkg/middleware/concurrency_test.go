@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimitRejectsOverflow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", ConcurrencyLimitMiddleware(2), func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", nil))
+		return w
+	}
+
+	// Saturate the limit
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, send().Code)
+		}()
+		<-entered
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequestsInFlight.WithLabelValues("/v1/chat/completions")))
+
+	w := send()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// Finished requests free their slots
+	close(release)
+	wg.Wait()
+	assert.Equal(t, float64(0), testutil.ToFloat64(httpRequestsInFlight.WithLabelValues("/v1/chat/completions")))
+	go func() { <-entered }()
+	assert.Equal(t, http.StatusOK, send().Code)
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error types of the error envelope, as in OpenAI's API
+const (
+	ErrorTypeInvalidRequest = "invalid_request_error"
+	ErrorTypeAuthentication = "authentication_error"
+	ErrorTypePermission     = "permission_error"
+	ErrorTypeNotFound       = "not_found_error"
+	ErrorTypeRateLimit      = "rate_limit_error"
+	ErrorTypeQuota          = "insufficient_quota"
+	ErrorTypeTimeout        = "timeout_error"
+	ErrorTypeServer         = "server_error"
+)
+
+// APIError describes a failed request. Code, when set, is a
+// machine-readable reason more specific than Type.
+type APIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// ErrorResponse is the body of every error response, the envelope OpenAI
+// clients and SDKs parse: {"error": {"message", "type", "code"}}
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// NewErrorResponse creates the error response of a status, typed by the
+// status
+func NewErrorResponse(status int, message string) ErrorResponse {
+	return ErrorResponse{Error: APIError{Message: message, Type: ErrorTypeForStatus(status), Code: codeForStatus(status)}}
+}
+
+// ErrorTypeForStatus returns the error type of an HTTP status
+func ErrorTypeForStatus(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrorTypeAuthentication
+	case status == http.StatusPaymentRequired:
+		return ErrorTypeQuota
+	case status == http.StatusForbidden:
+		return ErrorTypePermission
+	case status == http.StatusNotFound:
+		return ErrorTypeNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrorTypeRateLimit
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrorTypeTimeout
+	case status >= 500:
+		return ErrorTypeServer
+	}
+	return ErrorTypeInvalidRequest
+}
+
+// codeForStatus returns the code of statuses with a well-known reason
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusPaymentRequired:
+		return "insufficient_quota"
+	case http.StatusTooManyRequests:
+		return "rate_limit_exceeded"
+	}
+	return ""
+}
+
+// RespondError responds with an error in the error envelope and aborts the
+// remaining handlers
+func RespondError(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, NewErrorResponse(status, err.Error()))
+}
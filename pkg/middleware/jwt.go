@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTAuthMiddleware validates RS256-signed bearer tokens. The `sub` claim is
+// stored as "user_id" and the `scope` claim, if any, as "scopes" in the
+// context for downstream authorization. Each token is an API key of its
+// user: the APIKeyID of its `jti` claim, or of the token itself if it has
+// none, is stored as "api_key_id".
+func JWTAuthMiddleware(publicKey *rsa.PublicKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Extract token from header
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			RespondError(c, http.StatusUnauthorized, errors.New("missing authorization header"))
+			return
+		}
+
+		// Parse Bearer token
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			RespondError(c, http.StatusUnauthorized, errors.New("invalid authorization format"))
+			return
+		}
+
+		// Validate signature and time-based claims (exp, nbf)
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
+			return publicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}))
+		if err != nil {
+			RespondError(c, http.StatusUnauthorized, errors.New(jwtErrorMessage(err)))
+			return
+		}
+
+		// Extract identity
+		subject, err := claims.GetSubject()
+		if err != nil || subject == "" {
+			RespondError(c, http.StatusUnauthorized, errors.New("token missing sub claim"))
+			return
+		}
+
+		// Store identity, key and scopes in context
+		c.Set("user_id", subject)
+		if jti, _ := claims["jti"].(string); jti != "" {
+			c.Set("api_key_id", APIKeyID(jti))
+		} else {
+			c.Set("api_key_id", APIKeyID(parts[1]))
+		}
+		if scopes := parseScopes(claims["scope"]); len(scopes) > 0 {
+			c.Set("scopes", scopes)
+		}
+		c.Next()
+	}
+}
+
+// jwtErrorMessage maps a token validation error to a client-facing message
+func jwtErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "token expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "token not yet valid"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "invalid token signature"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed token"
+	default:
+		return "invalid token"
+	}
+}
+
+// parseScopes reads a scope claim given either as a space-separated string
+// or as an array of strings
+func parseScopes(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		scopes := make([]string, 0, len(v))
+		for _, s := range v {
+			if scope, ok := s.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	assert.NoError(t, err)
+	return token
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ginRouter := gin.New()
+	ginRouter.Use(JWTAuthMiddleware(&key.PublicKey))
+	ginRouter.GET("/whoami", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id"), "scopes": c.GetStringSlice("scopes")})
+	})
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		body   string
+	}{
+		{
+			name:   "valid token",
+			token:  signToken(t, key, jwt.MapClaims{"sub": "user-1", "scope": "models:gpt admin", "exp": now.Add(time.Hour).Unix()}),
+			status: http.StatusOK,
+			body:   `{"scopes":["models:gpt","admin"],"user_id":"user-1"}`,
+		},
+		{
+			name:   "expired token",
+			token:  signToken(t, key, jwt.MapClaims{"sub": "user-1", "exp": now.Add(-time.Hour).Unix()}),
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"message":"token expired","type":"authentication_error"}}`,
+		},
+		{
+			name:   "token not yet valid",
+			token:  signToken(t, key, jwt.MapClaims{"sub": "user-1", "nbf": now.Add(time.Hour).Unix()}),
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"message":"token not yet valid","type":"authentication_error"}}`,
+		},
+		{
+			name:   "wrong signing key",
+			token:  signToken(t, otherKey, jwt.MapClaims{"sub": "user-1"}),
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"message":"invalid token signature","type":"authentication_error"}}`,
+		},
+		{
+			name:   "missing sub claim",
+			token:  signToken(t, key, jwt.MapClaims{"scope": "admin"}),
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"message":"token missing sub claim","type":"authentication_error"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/whoami", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			ginRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.JSONEq(t, tt.body, w.Body.String())
+		})
+	}
+}
+
+func TestJWTAuthMiddlewareSetsKeyID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ginRouter := gin.New()
+	ginRouter.Use(JWTAuthMiddleware(&key.PublicKey))
+	ginRouter.GET("/key", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("api_key_id"))
+	})
+	keyID := func(token string) string {
+		req := httptest.NewRequest("GET", "/key", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		ginRouter.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// Tokens are identified by their jti, else by the token itself
+	withJTI := signToken(t, key, jwt.MapClaims{"sub": "user-1", "jti": "key-1"})
+	assert.Equal(t, APIKeyID("key-1"), keyID(withJTI))
+	withoutJTI := signToken(t, key, jwt.MapClaims{"sub": "user-1"})
+	assert.Equal(t, APIKeyID(withoutJTI), keyID(withoutJTI))
+}
@@ -42,6 +42,7 @@ func LoggingMiddleware() gin.HandlerFunc {
 			zap.Duration("duration", duration),
 			zap.String("ip", c.ClientIP()),
 			zap.String("user_agent", c.Request.UserAgent()),
+			zap.String("request_id", RequestIDFromContext(c.Request.Context())),
 		)
 
 		// Log errors if any
@@ -50,6 +51,7 @@ func LoggingMiddleware() gin.HandlerFunc {
 				logger.Error("Request error",
 					zap.String("error", e.Error()),
 					zap.String("path", path),
+					zap.String("request_id", RequestIDFromContext(c.Request.Context())),
 				)
 			}
 		}
@@ -60,4 +62,3 @@ func LoggingMiddleware() gin.HandlerFunc {
 func GetLogger() *zap.Logger {
 	return logger
 }
-
@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -28,13 +32,21 @@ var (
 		[]string{"method", "endpoint"},
 	)
 
+	httpRequestsInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being handled by concurrency-limited routes",
+		},
+		[]string{"endpoint"},
+	)
+
 	// LLM metrics
 	llmRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "llm_requests_total",
 			Help: "Total number of LLM requests",
 		},
-		[]string{"provider", "model", "status"},
+		[]string{"provider", "model", "status", "shadow"},
 	)
 
 	llmRequestDuration = promauto.NewHistogramVec(
@@ -43,7 +55,15 @@ var (
 			Help:    "LLM request latency in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"provider", "model"},
+		[]string{"provider", "model", "shadow"},
+	)
+
+	llmErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_errors_total",
+			Help: "Total number of failed LLM requests by error type",
+		},
+		[]string{"provider", "model", "error_type"},
 	)
 
 	llmTokensUsed = promauto.NewCounterVec(
@@ -51,7 +71,64 @@ var (
 			Name: "llm_tokens_used_total",
 			Help: "Total number of tokens used",
 		},
-		[]string{"provider", "model", "type"},
+		[]string{"provider", "model", "type", "shadow"},
+	)
+
+	llmTokenDetails = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_token_details_total",
+			Help: "Prompt tokens read from the prompt cache (type cached) and completion tokens spent on reasoning (type reasoning), which are included in llm_tokens_used_total",
+		},
+		[]string{"provider", "model", "type", "shadow"},
+	)
+
+	regionRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_region_requests_total",
+			Help: "Total number of requests sent to regional provider backends",
+		},
+		[]string{"provider", "region"},
+	)
+
+	providerUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_provider_up",
+			Help: "Whether the provider answered its last health probe (1) or not (0)",
+		},
+		[]string{"provider"},
+	)
+
+	providerProbeLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_provider_probe_latency_seconds",
+			Help: "Latency of the provider's last successful health probe",
+		},
+		[]string{"provider"},
+	)
+
+	modelOverridesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_overrides_total",
+			Help: "Total number of requests whose model was replaced by X-Model-Override",
+		},
+		[]string{"requested_model", "model"},
+	)
+
+	// Request coalescing metrics. Identical concurrent requests join one
+	// in-flight upstream call; each join is an upstream call saved.
+	requestCoalescedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "request_coalesced_total",
+			Help: "Total number of requests served by joining an identical in-flight call",
+		},
+		[]string{"model"},
+	)
+
+	coalescingGroupsInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "request_coalescing_groups_in_flight",
+			Help: "In-flight upstream calls that identical requests can join",
+		},
 	)
 
 	// Cache metrics
@@ -69,16 +146,49 @@ var (
 		},
 	)
 
-	// Rate limit metrics
-	rateLimitExceededTotal = promauto.NewCounterVec(
+	cacheStaleHitsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "cache_stale_hits_total",
+			Help: "Total number of stale cached responses served because the provider failed",
+		},
+	)
+
+	// Rate limit metrics. The counter is not labeled by user, since every
+	// user would add a series; the heaviest users are tracked in memory
+	// instead.
+	rateLimitExceededTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "rate_limit_exceeded_total",
 			Help: "Total number of rate limit exceeded events",
 		},
-		[]string{"user_id"},
+	)
+	rateLimitOffenders    = NewOffenderTracker(maxRateLimitOffenders)
+	rateLimitWarningTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rate_limit_warnings_total",
+			Help: "Total number of requests allowed beyond a soft rate limit",
+		},
+	)
+
+	// Retry budget metrics, shared by all providers
+	retryBudgetRetriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retry_budget_retries_total",
+			Help: "Total number of provider retries allowed or shed by the retry budget",
+		},
+		[]string{"outcome"},
+	)
+	retryBudgetRemaining = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retry_budget_remaining",
+			Help: "Provider retries left in the retry budget",
+		},
 	)
 )
 
+// maxRateLimitOffenders bounds the users tracked by rateLimitOffenders
+const maxRateLimitOffenders = 1000
+
 // MetricsMiddleware collects HTTP metrics
 func MetricsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -104,12 +214,66 @@ func MetricsMiddleware() gin.HandlerFunc {
 	}
 }
 
-// RecordLLMRequest records LLM request metrics
-func RecordLLMRequest(provider, model, status string, duration time.Duration, promptTokens, completionTokens int) {
-	llmRequestsTotal.WithLabelValues(provider, model, status).Inc()
-	llmRequestDuration.WithLabelValues(provider, model).Observe(duration.Seconds())
-	llmTokensUsed.WithLabelValues(provider, model, "prompt").Add(float64(promptTokens))
-	llmTokensUsed.WithLabelValues(provider, model, "completion").Add(float64(completionTokens))
+// RecordLLMRequest records LLM request metrics. Calls mirrored to a shadow
+// provider are labeled shadow="true".
+func RecordLLMRequest(provider, model, status string, shadow bool, duration time.Duration, promptTokens, completionTokens int) {
+	shadowLabel := strconv.FormatBool(shadow)
+	llmRequestsTotal.WithLabelValues(provider, model, status, shadowLabel).Inc()
+	llmRequestDuration.WithLabelValues(provider, model, shadowLabel).Observe(duration.Seconds())
+	llmTokensUsed.WithLabelValues(provider, model, "prompt", shadowLabel).Add(float64(promptTokens))
+	llmTokensUsed.WithLabelValues(provider, model, "completion", shadowLabel).Add(float64(completionTokens))
+}
+
+// RecordLLMTokenDetails records the cached prompt tokens and reasoning
+// tokens of a successful LLM request
+func RecordLLMTokenDetails(provider, model string, shadow bool, cachedTokens, reasoningTokens int) {
+	shadowLabel := strconv.FormatBool(shadow)
+	if cachedTokens > 0 {
+		llmTokenDetails.WithLabelValues(provider, model, "cached", shadowLabel).Add(float64(cachedTokens))
+	}
+	if reasoningTokens > 0 {
+		llmTokenDetails.WithLabelValues(provider, model, "reasoning", shadowLabel).Add(float64(reasoningTokens))
+	}
+}
+
+// RecordLLMError records a failed LLM request
+func RecordLLMError(provider, model, errorType string) {
+	llmErrorsTotal.WithLabelValues(provider, model, errorType).Inc()
+}
+
+// RecordModelOverride records a request for requestedModel served with
+// model instead
+func RecordModelOverride(requestedModel, model string) {
+	modelOverridesTotal.WithLabelValues(requestedModel, model).Inc()
+}
+
+// RecordRegionRequest records a request sent to a regional provider
+// backend
+func RecordRegionRequest(provider, region string) {
+	regionRequestsTotal.WithLabelValues(provider, region).Inc()
+}
+
+// RecordProviderHealth records the outcome of a provider's health probe
+func RecordProviderHealth(provider string, up bool, latency time.Duration) {
+	if !up {
+		providerUp.WithLabelValues(provider).Set(0)
+		return
+	}
+	providerUp.WithLabelValues(provider).Set(1)
+	providerProbeLatency.WithLabelValues(provider).Set(latency.Seconds())
+}
+
+// RecordRequestCoalesced records a request served by joining an identical
+// in-flight call instead of making its own
+func RecordRequestCoalesced(model string) {
+	requestCoalescedTotal.WithLabelValues(model).Inc()
+}
+
+// TrackCoalescingGroup counts an in-flight call identical requests can join
+// until the returned function is called
+func TrackCoalescingGroup() (done func()) {
+	coalescingGroupsInFlight.Inc()
+	return coalescingGroupsInFlight.Dec
 }
 
 // RecordCacheHit records a cache hit
@@ -122,8 +286,69 @@ func RecordCacheMiss() {
 	cacheMissesTotal.Inc()
 }
 
+// RecordCacheStaleHit records a stale cached response served in place of
+// a provider error
+func RecordCacheStaleHit() {
+	cacheStaleHitsTotal.Inc()
+}
+
 // RecordRateLimitExceeded records a rate limit exceeded event
 func RecordRateLimitExceeded(userID string) {
-	rateLimitExceededTotal.WithLabelValues(userID).Inc()
+	rateLimitExceededTotal.Inc()
+	rateLimitOffenders.Add(userID)
+}
+
+// RecordRateLimitWarning records a request allowed beyond a soft rate limit
+func RecordRateLimitWarning() {
+	rateLimitWarningTotal.Inc()
+}
+
+// RecordRetryBudget records a provider retry allowed or shed by the retry
+// budget, and the retries left in it
+func RecordRetryBudget(allowed bool, remaining float64) {
+	outcome := "shed"
+	if allowed {
+		outcome = "allowed"
+	}
+	retryBudgetRetriesTotal.WithLabelValues(outcome).Inc()
+	retryBudgetRemaining.Set(remaining)
 }
 
+// TopRateLimitOffenders returns up to n of the users rate limited most
+// often since the process started
+func TopRateLimitOffenders(n int) []Offender {
+	return rateLimitOffenders.Top(n)
+}
+
+// MetricsAuthMiddleware protects the metrics endpoint, which exposes
+// provider, model and traffic details, independently of the API's authentication: scrapers
+// present either the bearer token or the basic auth credentials, whichever
+// are set. With neither set every request is let through.
+func MetricsAuthMiddleware(token, username, password string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" && username == "" {
+			c.Next()
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if bearer, ok := strings.CutPrefix(authHeader, "Bearer "); ok && token != "" && secureEqual(bearer, token) {
+			c.Next()
+			return
+		}
+		if user, pass, ok := c.Request.BasicAuth(); ok && username != "" && secureEqual(user, username) && secureEqual(pass, password) {
+			c.Next()
+			return
+		}
+
+		if username != "" {
+			c.Header("WWW-Authenticate", `Basic realm="metrics"`)
+		}
+		RespondError(c, http.StatusUnauthorized, errors.New("invalid metrics credentials"))
+	}
+}
+
+// secureEqual compares secrets in constant time
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/metrics", MetricsAuthMiddleware("scrape-token", "prometheus", "secret"), gin.WrapH(promhttp.Handler()))
+
+	cases := []struct {
+		name   string
+		auth   func(req *http.Request)
+		status int
+	}{
+		{"no credentials", func(req *http.Request) {}, http.StatusUnauthorized},
+		{"bearer token", func(req *http.Request) { req.Header.Set("Authorization", "Bearer scrape-token") }, http.StatusOK},
+		{"wrong bearer token", func(req *http.Request) { req.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"basic auth", func(req *http.Request) { req.SetBasicAuth("prometheus", "secret") }, http.StatusOK},
+		{"wrong password", func(req *http.Request) { req.SetBasicAuth("prometheus", "guess") }, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			tc.auth(req)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.status, w.Code)
+			if tc.status == http.StatusOK {
+				assert.Contains(t, w.Body.String(), "go_goroutines")
+			} else {
+				assert.Equal(t, `Basic realm="metrics"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestMetricsAuthMiddlewareOpenWithoutCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/metrics", MetricsAuthMiddleware("", "", ""), gin.WrapH(promhttp.Handler()))
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
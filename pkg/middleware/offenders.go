@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"sort"
+	"sync"
+)
+
+// Offender is a user and the number of times they were rate limited
+type Offender struct {
+	UserID string `json:"user_id"`
+	Count  int64  `json:"count"`
+}
+
+// OffenderTracker counts events per user in bounded memory, keeping the
+// heaviest users. It tracks at most capacity users; once full, a new user
+// takes the place of the one with the lowest count and inherits that count
+// (the Space-Saving algorithm), so counts of users that arrive late may be
+// overestimated by at most the evicted count, while any user seen more
+// often than total/capacity times is always retained.
+type OffenderTracker struct {
+	mu       sync.Mutex
+	capacity int
+	counts   map[string]int64
+}
+
+// NewOffenderTracker creates a tracker holding at most capacity users
+func NewOffenderTracker(capacity int) *OffenderTracker {
+	return &OffenderTracker{
+		capacity: capacity,
+		counts:   make(map[string]int64, capacity),
+	}
+}
+
+// Add counts an event for the user
+func (t *OffenderTracker) Add(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.counts[userID]; ok || len(t.counts) < t.capacity {
+		t.counts[userID]++
+		return
+	}
+
+	// Replace the user with the lowest count
+	var minUser string
+	var minCount int64 = -1
+	for user, count := range t.counts {
+		if minCount < 0 || count < minCount {
+			minUser, minCount = user, count
+		}
+	}
+	delete(t.counts, minUser)
+	t.counts[userID] = minCount + 1
+}
+
+// Top returns up to n users with the highest counts, highest first
+func (t *OffenderTracker) Top(n int) []Offender {
+	t.mu.Lock()
+	offenders := make([]Offender, 0, len(t.counts))
+	for user, count := range t.counts {
+		offenders = append(offenders, Offender{UserID: user, Count: count})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].Count != offenders[j].Count {
+			return offenders[i].Count > offenders[j].Count
+		}
+		return offenders[i].UserID < offenders[j].UserID
+	})
+	if n >= 0 && n < len(offenders) {
+		offenders = offenders[:n]
+	}
+	return offenders
+}
+
+// Len returns the number of users tracked
+func (t *OffenderTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.counts)
+}
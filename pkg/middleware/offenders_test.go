@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffenderTrackerStaysBounded(t *testing.T) {
+	tracker := NewOffenderTracker(10)
+	for i := 0; i < 2000; i++ {
+		tracker.Add("heavy")
+		for j := 0; j < 5; j++ {
+			tracker.Add(fmt.Sprintf("user-%d-%d", i, j))
+		}
+	}
+
+	assert.Equal(t, 10, tracker.Len())
+	top := tracker.Top(1)
+	assert.Equal(t, []Offender{{UserID: "heavy", Count: 2000}}, top, "users above total/capacity are always retained")
+	assert.Len(t, tracker.Top(100), 10)
+}
+
+func TestRecordRateLimitExceededHasOneSeries(t *testing.T) {
+	for i := 0; i < 5000; i++ {
+		RecordRateLimitExceeded(fmt.Sprintf("user-%d", i))
+	}
+
+	assert.Equal(t, 1, testutil.CollectAndCount(rateLimitExceededTotal))
+	assert.LessOrEqual(t, rateLimitOffenders.Len(), maxRateLimitOffenders)
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecoveryMiddleware recovers from panics in handlers, responding 500 in
+// the error envelope. The panic is recorded on the request's span and
+// added to the request's errors for LoggingMiddleware, so it must run
+// after both; as the innermost middleware, the others see the 500.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		err := fmt.Errorf("panic: %v", recovered)
+		span := trace.SpanFromContext(c.Request.Context())
+		span.RecordError(err, trace.WithStackTrace(true))
+		span.SetStatus(codes.Error, err.Error())
+		_ = c.Error(err)
+		RespondError(c, http.StatusInternalServerError, errors.New("internal server error"))
+	})
+}
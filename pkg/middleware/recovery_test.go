@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecoveryRecordsPanicOnSpan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	engine := gin.New()
+	engine.Use(RequestIDMiddleware(), TracingMiddleware(), LoggingMiddleware(), MetricsMiddleware(), RecoveryMiddleware())
+	engine.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set(RequestIDHeader, "req-panic")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	// The panic is recovered into a 500 in the error envelope
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var resp ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, ErrorTypeServer, resp.Error.Type)
+
+	// and recorded on the request's span, which carries the request ID
+	ended := spans.Ended()
+	if assert.Len(t, ended, 1) {
+		span := ended[0]
+		assert.Equal(t, codes.Error, span.Status().Code)
+		if assert.Len(t, span.Events(), 1) {
+			assert.Equal(t, "exception", span.Events()[0].Name)
+			assert.Contains(t, span.Events()[0].Attributes, attribute.String("exception.message", "panic: boom"))
+		}
+		assert.Contains(t, span.Attributes(), attribute.String("request.id", "req-panic"))
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID that correlates a request's logs, trace and
+// response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// RequestIDMiddleware gives every request an ID: the client's X-Request-ID
+// if it sent a usable one, else a new UUID. The ID is stored in the request
+// context and echoed in the response header; it runs first so that the
+// tracing, logging and metrics middleware all see it. It is also set on
+// the request's span if one was already started.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		ctx := ContextWithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(RequestIDHeader, id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+
+		c.Next()
+	}
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log and
+// echo: printable ASCII without spaces, of bounded length
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID of ctx, or "" if it has none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
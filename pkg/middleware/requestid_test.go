@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RequestIDMiddleware())
+	engine.GET("/id", func(c *gin.Context) {
+		c.String(http.StatusOK, RequestIDFromContext(c.Request.Context()))
+	})
+	send := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/id", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	// A supplied ID is reused
+	w := send("client-req-42")
+	assert.Equal(t, "client-req-42", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, "client-req-42", w.Body.String())
+
+	// Otherwise a UUID is generated and round-trips in the header
+	w = send("")
+	id := w.Header().Get(RequestIDHeader)
+	_, err := uuid.Parse(id)
+	assert.NoError(t, err)
+	assert.Equal(t, id, w.Body.String())
+	assert.NotEqual(t, id, send("").Header().Get(RequestIDHeader))
+
+	// IDs unsafe to log are replaced
+	for _, unsafe := range []string{"with space", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		assert.NotEqual(t, unsafe, send(unsafe).Header().Get(RequestIDHeader))
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutMiddleware bounds how long a request may take. The request context
+// gets the deadline, so provider calls made with it are cancelled once it
+// passes; handlers report such failures as 504 Gateway Timeout, and a
+// handler that returns without responding gets a 504 here. A streamed
+// response that has already started is cut off instead. A timeout of zero
+// or less disables the bound.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			RespondError(c, http.StatusGatewayTimeout, errors.New("request timed out after "+timeout.String()))
+		}
+	}
+}
@@ -8,7 +8,8 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-// TracingMiddleware adds OpenTelemetry tracing to requests
+// TracingMiddleware adds OpenTelemetry tracing to requests. The span
+// carries the request ID set by RequestIDMiddleware, if it ran first.
 func TracingMiddleware() gin.HandlerFunc {
 	tracer := otel.Tracer("ai-gateway")
 
@@ -23,6 +24,9 @@ func TracingMiddleware() gin.HandlerFunc {
 				attribute.String("http.user_agent", c.Request.UserAgent()),
 			),
 		)
+		if id := RequestIDFromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
 		defer span.End()
 
 		// Store context in Gin context
@@ -1,11 +1,16 @@
 package providers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,17 +18,28 @@ import (
 type AnthropicProvider struct {
 	apiKey  string
 	baseURL string
-	client  *http.Client
+	client  *retryableClient
+	timeout time.Duration
+
+	// Whether a seed, which Anthropic has no equivalent of, is rejected
+	// rather than ignored
+	strictParameters bool
 }
 
 // NewAnthropicProvider creates a new Anthropic provider
-func NewAnthropicProvider(apiKey string) *AnthropicProvider {
+func NewAnthropicProvider(apiKey string, opts ...Option) *AnthropicProvider {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return &AnthropicProvider{
 		apiKey:  apiKey,
-		baseURL: "https://api.anthropic.com/v1",
-		client: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		baseURL: o.baseURLOr("https://api.anthropic.com/v1"),
+		client:  newRetryableClient(newHTTPClient(o.transport), o.retry, o.retryBudget),
+		timeout: o.timeout,
+
+		strictParameters: o.strictParameters,
 	}
 }
 
@@ -32,13 +48,310 @@ func (p *AnthropicProvider) Name() string {
 	return "anthropic"
 }
 
+// BaseURL returns the base URL of the API
+func (p *AnthropicProvider) BaseURL() string {
+	return p.baseURL
+}
+
+// anthropicPromptCachingBeta is the beta header value enabling prompt
+// caching
+const anthropicPromptCachingBeta = "prompt-caching-2024-07-31"
+
 // anthropicRequest represents Anthropic's request format
 type anthropicRequest struct {
 	Model       string              `json:"model"`
-	Messages    []Message           `json:"messages"`
+	Messages    []anthropicMessage  `json:"messages"`
 	MaxTokens   int                 `json:"max_tokens"`
-	Temperature float64             `json:"temperature,omitempty"`
+	Temperature *float64            `json:"temperature,omitempty"`
 	Stream      bool                `json:"stream,omitempty"`
+
+	// System is a string, or a list of text blocks when part of it is
+	// cached
+	System        interface{}        `json:"system,omitempty"`
+	TopP          float64            `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Metadata      *anthropicMetadata `json:"metadata,omitempty"`
+
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+
+	// promptCaching is set when a block carries cache_control, which
+	// needs the prompt caching beta header
+	promptCaching bool
+}
+
+// setHeaders sets the headers of a Messages API request
+func (p *AnthropicProvider) setHeaders(httpReq *http.Request, anthropicReq anthropicRequest) {
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	httpReq.Header.Set("Content-Type", "application/json")
+	if anthropicReq.promptCaching {
+		httpReq.Header.Set("anthropic-beta", anthropicPromptCachingBeta)
+	}
+}
+
+// anthropicTool is a tool definition in Anthropic's format
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicToolChoice is how the model must use the tools: "auto", "any"
+// or "tool" with the name of the tool to call
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// anthropicMetadata carries the end-user identifier
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+// anthropicMessage is a message whose content is either a string or a list
+// of content blocks
+type anthropicMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// anthropicBlock is a text, image, tool_use or tool_result content block
+type anthropicBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+
+	// tool_use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicImageSource holds an image as base64 data or a URL
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// toAnthropicMessage converts a message, translating OpenAI image_url parts
+// into Anthropic image blocks. Data URLs become base64 sources and other
+// URLs are passed as url sources.
+func toAnthropicMessage(msg Message) anthropicMessage {
+	if msg.Parts == nil {
+		return anthropicMessage{Role: msg.Role, Content: msg.Content}
+	}
+
+	blocks := make([]anthropicBlock, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		switch {
+		case part.Type == ContentPartText:
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+		case part.Type == ContentPartImageURL && part.ImageURL != nil:
+			source := &anthropicImageSource{Type: "url", URL: part.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				source = &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: source})
+		}
+	}
+	return anthropicMessage{Role: msg.Role, Content: blocks}
+}
+
+// toAnthropicToolUse converts an assistant message calling tools into
+// text and tool_use blocks
+func toAnthropicToolUse(msg Message) (anthropicMessage, error) {
+	var blocks []anthropicBlock
+	if msg.Content != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+	}
+	for _, call := range msg.ToolCalls {
+		input := json.RawMessage(call.Function.Arguments)
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		if !json.Valid(input) {
+			return anthropicMessage{}, newError("anthropic", ErrorKindInvalidRequest, fmt.Errorf("arguments of tool call %s are not valid JSON", call.ID))
+		}
+		blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+	}
+	return anthropicMessage{Role: "assistant", Content: blocks}, nil
+}
+
+// withCacheControl marks the last content block of a message with a cache
+// control hint, turning string content into a text block
+func withCacheControl(msg anthropicMessage, cacheControl *CacheControl) anthropicMessage {
+	blocks, ok := msg.Content.([]anthropicBlock)
+	if !ok {
+		text, _ := msg.Content.(string)
+		blocks = []anthropicBlock{{Type: "text", Text: text}}
+	}
+	if len(blocks) == 0 {
+		return msg
+	}
+	// Copy so a shared block list isn't modified
+	blocks = append([]anthropicBlock(nil), blocks...)
+	blocks[len(blocks)-1].CacheControl = cacheControl
+	msg.Content = blocks
+	return msg
+}
+
+// toAnthropicTools converts function tools and the tool choice. A choice of
+// "none" drops the tools, since Anthropic then has nothing to choose from.
+func toAnthropicTools(tools []Tool, choice json.RawMessage) ([]anthropicTool, *anthropicToolChoice, error) {
+	var toolChoice *anthropicToolChoice
+	if len(choice) > 0 {
+		var mode string
+		var named struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		switch {
+		case json.Unmarshal(choice, &mode) == nil:
+			switch mode {
+			case "none":
+				return nil, nil, nil
+			case "auto":
+				toolChoice = &anthropicToolChoice{Type: "auto"}
+			case "required":
+				toolChoice = &anthropicToolChoice{Type: "any"}
+			default:
+				return nil, nil, newError("anthropic", ErrorKindInvalidRequest, fmt.Errorf("unsupported tool_choice %q", mode))
+			}
+		case json.Unmarshal(choice, &named) == nil && named.Function.Name != "":
+			toolChoice = &anthropicToolChoice{Type: "tool", Name: named.Function.Name}
+		default:
+			return nil, nil, newError("anthropic", ErrorKindInvalidRequest, errors.New("invalid tool_choice"))
+		}
+	}
+
+	converted := make([]anthropicTool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return nil, nil, newError("anthropic", ErrorKindUnsupported, fmt.Errorf("unsupported tool type %q", tool.Type))
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		converted = append(converted, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return converted, toolChoice, nil
+}
+
+// toAnthropicRequest converts a chat request to Anthropic's format:
+//
+//   - system messages are joined into the top-level system prompt
+//   - image parts are translated into Anthropic image blocks
+//   - function tools become Anthropic tools; assistant tool calls become
+//     tool_use blocks and "tool" messages tool_result blocks of a user
+//     message
+//   - temperature is capped at 1, Anthropic's maximum (OpenAI allows 2)
+//   - top_p is passed as is, stop becomes stop_sequences and user becomes
+//     metadata.user_id
+//   - max_tokens is required by Anthropic and defaults to 1024
+//   - a message's cache_control marks its last content block; a marked
+//     system message turns the system prompt into text blocks
+//
+// presence_penalty and frequency_penalty have no Anthropic equivalent and
+// are dropped.
+func toAnthropicRequest(req *ChatRequest) (anthropicRequest, error) {
+	anthropicReq := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.temperature(),
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+	}
+
+	if req.Logprobs || req.TopLogprobs > 0 {
+		return anthropicRequest{}, newError("anthropic", ErrorKindUnsupported, errors.New("logprobs are not supported"))
+	}
+	if len(req.Tools) > 0 {
+		tools, choice, err := toAnthropicTools(req.Tools, req.ToolChoice)
+		if err != nil {
+			return anthropicRequest{}, err
+		}
+		anthropicReq.Tools, anthropicReq.ToolChoice = tools, choice
+	}
+
+	var system []anthropicBlock
+	for _, msg := range req.Messages {
+		if msg.CacheControl != nil {
+			anthropicReq.promptCaching = true
+		}
+		switch {
+		case msg.Role == "system":
+			system = append(system, anthropicBlock{Type: "text", Text: msg.Content, CacheControl: msg.CacheControl})
+			continue
+		case msg.Role == "tool":
+			// Consecutive tool results are sent together in one user message
+			result := anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content}
+			if n := len(anthropicReq.Messages); n > 0 {
+				if blocks, ok := anthropicReq.Messages[n-1].Content.([]anthropicBlock); ok && len(blocks) > 0 && blocks[0].Type == "tool_result" {
+					anthropicReq.Messages[n-1].Content = append(blocks, result)
+					break
+				}
+			}
+			anthropicReq.Messages = append(anthropicReq.Messages, anthropicMessage{Role: "user", Content: []anthropicBlock{result}})
+		case len(msg.ToolCalls) > 0:
+			converted, err := toAnthropicToolUse(msg)
+			if err != nil {
+				return anthropicRequest{}, err
+			}
+			anthropicReq.Messages = append(anthropicReq.Messages, converted)
+		default:
+			anthropicReq.Messages = append(anthropicReq.Messages, toAnthropicMessage(msg))
+		}
+		if msg.CacheControl != nil {
+			n := len(anthropicReq.Messages) - 1
+			anthropicReq.Messages[n] = withCacheControl(anthropicReq.Messages[n], msg.CacheControl)
+		}
+	}
+	anthropicReq.System = anthropicSystem(system)
+
+	if anthropicReq.Temperature != nil && *anthropicReq.Temperature > 1 {
+		*anthropicReq.Temperature = 1
+	}
+	if req.User != "" {
+		anthropicReq.Metadata = &anthropicMetadata{UserID: req.User}
+	}
+
+	// Default max tokens if not specified
+	if anthropicReq.MaxTokens == 0 {
+		anthropicReq.MaxTokens = 1024
+	}
+
+	return anthropicReq, nil
+}
+
+// anthropicSystem returns the system prompt: the system messages joined
+// into a string, or kept as text blocks if any is marked for caching
+func anthropicSystem(blocks []anthropicBlock) interface{} {
+	texts := make([]string, len(blocks))
+	for i, block := range blocks {
+		if block.CacheControl != nil {
+			return blocks
+		}
+		texts[i] = block.Text
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	return strings.Join(texts, "\n\n")
 }
 
 // anthropicResponse represents Anthropic's response format
@@ -49,31 +362,90 @@ type anthropicResponse struct {
 	Content []struct {
 		Type string `json:"type"`
 		Text string `json:"text"`
+
+		// tool_use blocks
+		ID    string          `json:"id"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
 	} `json:"content"`
 	Model        string `json:"model"`
 	StopReason   string `json:"stop_reason"`
-	Usage        struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage"`
+	Usage        anthropicUsage `json:"usage"`
 }
 
 // ChatCompletion performs a chat completion using Anthropic's API
-func (p *AnthropicProvider) ChatCompletion(req *ChatRequest) (*ChatResponse, error) {
+func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if err := p.checkSeed(req); err != nil {
+		return nil, err
+	}
+
 	// Convert to Anthropic format
-	anthropicReq := anthropicRequest{
-		Model:       req.Model,
-		Messages:    req.Messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		Stream:      req.Stream,
+	anthropicReq, err := toAnthropicRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
-	// Default max tokens if not specified
-	if anthropicReq.MaxTokens == 0 {
-		anthropicReq.MaxTokens = 1024
+	if req.N > 1 {
+		return p.completeN(ctx, anthropicReq, req.N)
+	}
+	return p.complete(ctx, anthropicReq)
+}
+
+// completeN emulates n choices, which Anthropic has no parameter for, with
+// n parallel requests. Their usage is summed; if any request fails the
+// others are canceled and its error is returned.
+func (p *AnthropicProvider) completeN(ctx context.Context, anthropicReq anthropicRequest, n int) (*ChatResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make([]*ChatResponse, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = p.complete(ctx, anthropicReq)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
 	}
+	wg.Wait()
 
+	// Prefer the error that canceled the other requests
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && (firstErr == nil || KindOf(firstErr) == ErrorKindCanceled) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	chatResp := responses[0]
+	for i, resp := range responses[1:] {
+		choice := resp.Choices[0]
+		choice.Index = i + 1
+		chatResp.Choices = append(chatResp.Choices, choice)
+		chatResp.Usage.PromptTokens += resp.Usage.PromptTokens
+		chatResp.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		chatResp.Usage.TotalTokens += resp.Usage.TotalTokens
+		chatResp.Usage.CacheCreationInputTokens += resp.Usage.CacheCreationInputTokens
+		chatResp.Usage.CacheReadInputTokens += resp.Usage.CacheReadInputTokens
+		if resp.Usage.PromptTokensDetails != nil {
+			chatResp.Usage.PromptTokensDetails = &PromptTokensDetails{CachedTokens: chatResp.Usage.CacheReadInputTokens}
+		}
+	}
+	return chatResp, nil
+}
+
+// complete sends a single Messages API request
+func (p *AnthropicProvider) complete(ctx context.Context, anthropicReq anthropicRequest) (*ChatResponse, error) {
 	// Marshal request
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
@@ -81,44 +453,52 @@ func (p *AnthropicProvider) ChatCompletion(req *ChatRequest) (*ChatResponse, err
 	}
 
 	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", p.baseURL+"/messages", bytes.NewBuffer(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
-	httpReq.Header.Set("x-api-key", p.apiKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-	httpReq.Header.Set("Content-Type", "application/json")
+	p.setHeaders(httpReq, anthropicReq)
 
 	// Send request
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, newTransportError(p.Name(), "send request", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, newTransportError(p.Name(), "read response", err)
 	}
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newStatusError(p.Name(), resp, respBody)
 	}
 
 	// Parse Anthropic response
 	var anthropicResp anthropicResponse
 	if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
 	}
 
-	// Convert to standard format
-	content := ""
-	if len(anthropicResp.Content) > 0 {
-		content = anthropicResp.Content[0].Text
+	// Convert to standard format; text blocks are joined and tool_use
+	// blocks become tool calls
+	message := Message{Role: "assistant"}
+	for _, block := range anthropicResp.Content {
+		switch block.Type {
+		case "text":
+			message.Content += block.Text
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
 	}
 
 	chatResp := &ChatResponse{
@@ -128,21 +508,257 @@ func (p *AnthropicProvider) ChatCompletion(req *ChatRequest) (*ChatResponse, err
 		Model:   anthropicResp.Model,
 		Choices: []Choice{
 			{
-				Index: 0,
-				Message: Message{
-					Role:    "assistant",
-					Content: content,
-				},
-				FinishReason: anthropicResp.StopReason,
+				Index:        0,
+				Message:      message,
+				FinishReason: anthropicFinishReason(anthropicResp.StopReason),
 			},
 		},
-		Usage: Usage{
-			PromptTokens:     anthropicResp.Usage.InputTokens,
-			CompletionTokens: anthropicResp.Usage.OutputTokens,
-			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
-		},
+		Usage:             anthropicResp.Usage.toUsage(anthropicResp.Usage.OutputTokens),
+		UpstreamRequestID: upstreamRequestID(resp.Header),
 	}
 
 	return chatResp, nil
 }
 
+// anthropicFinishReason maps Anthropic stop reasons to OpenAI's finish reasons
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return reason
+	}
+}
+
+// ChatCompletionStream performs a streamed chat completion, translating
+// Anthropic's events into stream chunks. Streams have a single choice.
+func (p *AnthropicProvider) ChatCompletionStream(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, error) {
+	if req.N > 1 {
+		return nil, newError(p.Name(), ErrorKindUnsupported, errors.New("n greater than 1 is not supported when streaming"))
+	}
+	if err := p.checkSeed(req); err != nil {
+		return nil, err
+	}
+	anthropicReq, err := toAnthropicRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	anthropicReq.Stream = true
+
+	body, err := json.Marshal(anthropicReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	p.setHeaders(httpReq, anthropicReq)
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "send request", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	return streamResponse(ctx, resp, readAnthropicStream), nil
+}
+
+// anthropicStreamEvent is the data payload of an Anthropic SSE event. Only
+// the fields of the events the gateway relays are decoded.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Index        int `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicUsage holds the token counts of a response. Input tokens
+// exclude those written to or read from the prompt cache.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage converts the usage, counting cached tokens as prompt tokens and
+// reporting cache reads as OpenAI's cached tokens. Streams report the
+// output tokens separately from the input tokens.
+func (u anthropicUsage) toUsage(outputTokens int) Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	usage := Usage{
+		PromptTokens:             prompt,
+		CompletionTokens:         outputTokens,
+		TotalTokens:              prompt + outputTokens,
+		CacheCreationInputTokens: u.CacheCreationInputTokens,
+		CacheReadInputTokens:     u.CacheReadInputTokens,
+	}
+	if u.CacheReadInputTokens > 0 {
+		usage.PromptTokensDetails = &PromptTokensDetails{CachedTokens: u.CacheReadInputTokens}
+	}
+	return usage
+}
+
+// readAnthropicStream parses Anthropic's SSE events and sends them as stream
+// chunks until the message_stop event is received:
+//
+//   - message_start opens the assistant message
+//   - content_block_start of a tool_use block starts a tool call
+//   - content_block_delta carries the text or the tool call arguments
+//   - message_delta carries the stop reason and output token count, sent
+//     as a finish chunk followed by a usage chunk
+//
+// ping and content_block_stop events are skipped.
+func readAnthropicStream(ctx context.Context, r io.Reader, chunks chan<- StreamChunk) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var id, model string
+	var input anthropicUsage
+	// toolCalls maps the content block index of each tool_use block to the
+	// index of its tool call
+	toolCalls := map[int]int{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// The event type is repeated in the data, so "event:" lines
+			// are skipped along with blank separators
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			return fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+
+		var out []StreamChunk
+		switch event.Type {
+		case "message_start":
+			id, model = event.Message.ID, event.Message.Model
+			input = event.Message.Usage
+			out = append(out, StreamChunk{Role: "assistant"})
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				index := len(toolCalls)
+				toolCalls[event.Index] = index
+				out = append(out, StreamChunk{ToolCalls: []ToolCallDelta{{
+					Index:    index,
+					ID:       event.ContentBlock.ID,
+					Type:     "function",
+					Function: FunctionCallDelta{Name: event.ContentBlock.Name},
+				}}})
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				out = append(out, StreamChunk{Content: event.Delta.Text})
+			case "input_json_delta":
+				if index, ok := toolCalls[event.Index]; ok {
+					out = append(out, StreamChunk{ToolCalls: []ToolCallDelta{{
+						Index:    index,
+						Function: FunctionCallDelta{Arguments: event.Delta.PartialJSON},
+					}}})
+				}
+			}
+		case "message_delta":
+			usage := input.toUsage(event.Usage.OutputTokens)
+			out = append(out,
+				StreamChunk{FinishReason: anthropicFinishReason(event.Delta.StopReason)},
+				StreamChunk{Usage: &usage},
+			)
+		case "message_stop":
+			return nil
+		case "error":
+			return fmt.Errorf("stream error: %s", event.Error.Message)
+		}
+
+		for _, chunk := range out {
+			chunk.ID, chunk.Model = id, model
+			if !sendChunk(ctx, chunks, chunk) {
+				return nil
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return fmt.Errorf("stream ended before message_stop")
+}
+
+// anthropicModels is the static list of Claude models; Anthropic has no
+// public model listing endpoint
+var anthropicModels = []ModelInfo{
+	{ID: "claude-3-5-sonnet-20241022", ContextWindow: 200000, Capabilities: ModelCapabilities{Chat: true, Streaming: true, Vision: true}},
+	{ID: "claude-3-5-haiku-20241022", ContextWindow: 200000, Capabilities: ModelCapabilities{Chat: true, Streaming: true}},
+	{ID: "claude-3-opus-20240229", ContextWindow: 200000, Capabilities: ModelCapabilities{Chat: true, Streaming: true, Vision: true}},
+	{ID: "claude-3-sonnet-20240229", ContextWindow: 200000, Capabilities: ModelCapabilities{Chat: true, Streaming: true, Vision: true}},
+	{ID: "claude-3-haiku-20240307", ContextWindow: 200000, Capabilities: ModelCapabilities{Chat: true, Streaming: true, Vision: true}},
+}
+
+// Models returns the known Claude models
+func (p *AnthropicProvider) Models(ctx context.Context) ([]ModelInfo, error) {
+	models := make([]ModelInfo, len(anthropicModels))
+	for i, m := range anthropicModels {
+		m.Object = "model"
+		m.OwnedBy = "anthropic"
+		models[i] = m
+	}
+	return models, nil
+}
+
+// checkSeed rejects a request setting a seed when parameters are strict;
+// otherwise the seed is ignored
+func (p *AnthropicProvider) checkSeed(req *ChatRequest) error {
+	if req.Seed != nil && p.strictParameters {
+		return newError(p.Name(), ErrorKindUnsupported, errors.New("seed is not supported"))
+	}
+	return nil
+}
+
+// HealthCheck implements HealthChecker with a one-token completion from
+// the cheapest model, since Models does not call the API
+func (p *AnthropicProvider) HealthCheck(ctx context.Context) error {
+	_, err := p.ChatCompletion(ctx, &ChatRequest{
+		Model:     "claude-3-haiku-20240307",
+		Messages:  []Message{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	})
+	return err
+}
+
+// Embeddings is not supported; Anthropic has no embeddings API
+func (p *AnthropicProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	return nil, newError(p.Name(), ErrorKindUnsupported, errors.New("embeddings are not supported"))
+}
@@ -0,0 +1,418 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnthropicRequestMapsParameters(t *testing.T) {
+	got, err := toAnthropicRequest(&ChatRequest{
+		Model: "claude-3-5-haiku-20241022",
+		Messages: []Message{
+			{Role: "system", Content: "Be brief"},
+			{Role: "user", Content: "Hello"},
+		},
+		Temperature:      1.5,
+		TopP:             0.9,
+		Stop:             StopSequences{"END"},
+		PresencePenalty:  0.5,
+		FrequencyPenalty: 0.5,
+		User:             "user-1",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Be brief", got.System)
+	assert.Equal(t, []anthropicMessage{{Role: "user", Content: "Hello"}}, got.Messages)
+	if assert.NotNil(t, got.Temperature) {
+		assert.Equal(t, 1.0, *got.Temperature)
+	}
+	assert.Equal(t, 0.9, got.TopP)
+	assert.Equal(t, []string{"END"}, got.StopSequences)
+	assert.Equal(t, &anthropicMetadata{UserID: "user-1"}, got.Metadata)
+	assert.Equal(t, 1024, got.MaxTokens)
+}
+
+func TestAnthropicRequestSendsExplicitZeroTemperature(t *testing.T) {
+	got, err := toAnthropicRequest(&ChatRequest{Model: "claude-3-opus-20240229"})
+	assert.NoError(t, err)
+	body, _ := json.Marshal(got)
+	assert.NotContains(t, string(body), `"temperature"`)
+
+	got, err = toAnthropicRequest(&ChatRequest{Model: "claude-3-opus-20240229", TemperatureSet: true})
+	assert.NoError(t, err)
+	body, _ = json.Marshal(got)
+	assert.Contains(t, string(body), `"temperature":0`)
+}
+
+func TestAnthropicChatCompletionSendsMappedRequest(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"model": "claude-3-5-haiku-20241022",
+			"content": [{"type": "text", "text": "Hi"}],
+			"stop_reason": "stop_sequence",
+			"usage": {"input_tokens": 5, "output_tokens": 1}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:     "claude-3-5-haiku-20241022",
+		Messages:  []Message{{Role: "user", Content: "Hello"}},
+		MaxTokens: 50,
+		TopP:      0.5,
+		Stop:      StopSequences{"END", "STOP"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+
+	assert.Equal(t, 0.5, got["top_p"])
+	assert.Equal(t, []interface{}{"END", "STOP"}, got["stop_sequences"])
+	assert.Equal(t, float64(50), got["max_tokens"])
+	assert.NotContains(t, got, "stop")
+	assert.NotContains(t, got, "presence_penalty")
+	assert.NotContains(t, got, "system")
+}
+
+func TestAnthropicRequestTranslatesCacheControl(t *testing.T) {
+	ephemeral := &CacheControl{Type: "ephemeral"}
+	got, err := toAnthropicRequest(&ChatRequest{
+		Model: "claude-3-5-sonnet-20241022",
+		Messages: []Message{
+			{Role: "system", Content: "A long policy document", CacheControl: ephemeral},
+			{Role: "system", Content: "Be brief"},
+			{Role: "user", Content: "Hello", CacheControl: ephemeral},
+			{Role: "assistant", Content: "Hi"},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, got.promptCaching)
+	assert.Equal(t, []anthropicBlock{
+		{Type: "text", Text: "A long policy document", CacheControl: ephemeral},
+		{Type: "text", Text: "Be brief"},
+	}, got.System)
+	assert.Equal(t, []anthropicMessage{
+		{Role: "user", Content: []anthropicBlock{{Type: "text", Text: "Hello", CacheControl: ephemeral}}},
+		{Role: "assistant", Content: "Hi"},
+	}, got.Messages)
+}
+
+func TestAnthropicPromptCachingHeaderAndUsage(t *testing.T) {
+	var beta string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		beta = r.Header.Get("anthropic-beta")
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"content": [{"type": "text", "text": "Hi"}],
+			"usage": {"input_tokens": 5, "output_tokens": 1, "cache_creation_input_tokens": 100, "cache_read_input_tokens": 2000}
+		}`))
+	}))
+	defer server.Close()
+
+	var req ChatRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"model": "claude-3-5-sonnet-20241022",
+		"messages": [{"role": "system", "content": "A long policy document", "cache_control": {"type": "ephemeral"}}, {"role": "user", "content": "Hello"}]
+	}`), &req))
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &req)
+	assert.NoError(t, err)
+	assert.Equal(t, anthropicPromptCachingBeta, beta)
+	assert.Equal(t, Usage{PromptTokens: 2105, CompletionTokens: 1, TotalTokens: 2106, CacheCreationInputTokens: 100, CacheReadInputTokens: 2000, PromptTokensDetails: &PromptTokensDetails{CachedTokens: 2000}}, resp.Usage)
+
+	// Without hints the beta header isn't sent
+	req.Messages[0].CacheControl = nil
+	_, err = p.ChatCompletion(context.Background(), &req)
+	assert.NoError(t, err)
+	assert.Empty(t, beta)
+}
+
+func TestAnthropicHealthCheckSendsOneTokenCompletion(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hi"}], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	assert.NoError(t, p.HealthCheck(context.Background()))
+	assert.Equal(t, float64(1), got["max_tokens"])
+}
+
+func TestAnthropicRequestTranslatesImages(t *testing.T) {
+	got, err := toAnthropicRequest(&ChatRequest{
+		Model: "claude-3-5-sonnet-20241022",
+		Messages: []Message{{Role: "user", Parts: []ContentPart{
+			{Type: ContentPartText, Text: "Compare"},
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "data:image/jpeg;base64,AAAA"}},
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png"}},
+		}}},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []anthropicBlock{
+		{Type: "text", Text: "Compare"},
+		{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: "image/jpeg", Data: "AAAA"}},
+		{Type: "image", Source: &anthropicImageSource{Type: "url", URL: "https://example.com/cat.png"}},
+	}, got.Messages[0].Content)
+}
+
+func TestAnthropicChatCompletionStream(t *testing.T) {
+	var got anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-haiku-20241022","usage":{"input_tokens":5}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	chunks, err := p.ChatCompletionStream(context.Background(), &ChatRequest{
+		Model:    "claude-3-5-haiku-20241022",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.NoError(t, err)
+
+	var received []StreamChunk
+	for chunk := range chunks {
+		assert.NoError(t, chunk.Err)
+		received = append(received, chunk)
+	}
+
+	assert.True(t, got.Stream)
+	assert.Equal(t, []StreamChunk{
+		{ID: "msg_1", Model: "claude-3-5-haiku-20241022", Role: "assistant"},
+		{ID: "msg_1", Model: "claude-3-5-haiku-20241022", Content: "Hello"},
+		{ID: "msg_1", Model: "claude-3-5-haiku-20241022", Content: " there"},
+		{ID: "msg_1", Model: "claude-3-5-haiku-20241022", FinishReason: "stop"},
+		{ID: "msg_1", Model: "claude-3-5-haiku-20241022", Usage: &Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}},
+	}, received)
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-haiku-20241022"}}
+
+event: error
+data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}
+
+`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	chunks, err := p.ChatCompletionStream(context.Background(), &ChatRequest{
+		Model:    "claude-3-5-haiku-20241022",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.NoError(t, err)
+
+	var last StreamChunk
+	for chunk := range chunks {
+		last = chunk
+	}
+	assert.EqualError(t, last.Err, "stream error: Overloaded")
+}
+
+func TestAnthropicRequestTranslatesTools(t *testing.T) {
+	got, err := toAnthropicRequest(&ChatRequest{
+		Model: "claude-3-5-sonnet-20241022",
+		Messages: []Message{
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", ToolCalls: []ToolCall{
+				{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+				{ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Rome"}`}},
+			}},
+			{Role: "tool", ToolCallID: "call_1", Content: "Sunny"},
+			{Role: "tool", ToolCallID: "call_2", Content: "Rainy"},
+		},
+		Tools:      []Tool{{Type: "function", Function: FunctionDefinition{Name: "get_weather", Description: "Current weather"}}},
+		ToolChoice: json.RawMessage(`{"type":"function","function":{"name":"get_weather"}}`),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []anthropicTool{{Name: "get_weather", Description: "Current weather", InputSchema: json.RawMessage(`{"type":"object"}`)}}, got.Tools)
+	assert.Equal(t, &anthropicToolChoice{Type: "tool", Name: "get_weather"}, got.ToolChoice)
+	assert.Len(t, got.Messages, 3)
+	assert.Equal(t, anthropicMessage{Role: "assistant", Content: []anthropicBlock{
+		{Type: "tool_use", ID: "call_1", Name: "get_weather", Input: json.RawMessage(`{"city":"Paris"}`)},
+		{Type: "tool_use", ID: "call_2", Name: "get_weather", Input: json.RawMessage(`{"city":"Rome"}`)},
+	}}, got.Messages[1])
+	assert.Equal(t, anthropicMessage{Role: "user", Content: []anthropicBlock{
+		{Type: "tool_result", ToolUseID: "call_1", Content: "Sunny"},
+		{Type: "tool_result", ToolUseID: "call_2", Content: "Rainy"},
+	}}, got.Messages[2])
+}
+
+func TestAnthropicToolChoice(t *testing.T) {
+	tools := []Tool{{Type: "function", Function: FunctionDefinition{Name: "get_weather"}}}
+	for choice, want := range map[string]*anthropicToolChoice{
+		`"auto"`:     {Type: "auto"},
+		`"required"`: {Type: "any"},
+	} {
+		got, err := toAnthropicRequest(&ChatRequest{Model: "claude-3-5-sonnet-20241022", Tools: tools, ToolChoice: json.RawMessage(choice)})
+		assert.NoError(t, err)
+		assert.Equal(t, want, got.ToolChoice)
+	}
+
+	// "none" leaves Anthropic without tools to call
+	got, err := toAnthropicRequest(&ChatRequest{Model: "claude-3-5-sonnet-20241022", Tools: tools, ToolChoice: json.RawMessage(`"none"`)})
+	assert.NoError(t, err)
+	assert.Empty(t, got.Tools)
+	assert.Nil(t, got.ToolChoice)
+
+	_, err = toAnthropicRequest(&ChatRequest{Model: "claude-3-5-sonnet-20241022", Tools: tools, ToolChoice: json.RawMessage(`"sometimes"`)})
+	assert.Equal(t, ErrorKindInvalidRequest, KindOf(err))
+
+	_, err = toAnthropicRequest(&ChatRequest{Model: "claude-3-5-sonnet-20241022", Tools: []Tool{{Type: "code_interpreter"}}})
+	assert.Equal(t, ErrorKindUnsupported, KindOf(err))
+}
+
+func TestAnthropicSeedIsRejectedOnlyWhenStrict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		assert.NotContains(t, got, "seed")
+		w.Write([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hi"}], "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer server.Close()
+
+	seed := int64(42)
+	req := &ChatRequest{Model: "claude-3-5-haiku-20241022", Messages: []Message{{Role: "user", Content: "Hello"}}, Seed: &seed}
+
+	_, err := NewAnthropicProvider("test-key", WithBaseURL(server.URL)).ChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+
+	_, err = NewAnthropicProvider("test-key", WithBaseURL(server.URL), WithStrictParameters(true)).ChatCompletion(context.Background(), req)
+	assert.Equal(t, ErrorKindUnsupported, KindOf(err))
+	assert.Contains(t, err.Error(), "seed is not supported")
+}
+
+func TestAnthropicRejectsLogprobs(t *testing.T) {
+	_, err := toAnthropicRequest(&ChatRequest{Model: "claude-3-5-sonnet-20241022", Logprobs: true})
+	assert.Equal(t, ErrorKindUnsupported, KindOf(err))
+	assert.Contains(t, err.Error(), "logprobs are not supported")
+}
+
+func TestAnthropicChatCompletionReturnsToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"model": "claude-3-5-sonnet-20241022",
+			"content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 20, "output_tokens": 10}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "claude-3-5-sonnet-20241022",
+		Messages: []Message{{Role: "user", Content: "Weather in Paris?"}},
+		Tools:    []Tool{{Type: "function", Function: FunctionDefinition{Name: "get_weather"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Checking.", resp.Choices[0].Message.Content)
+	assert.Equal(t, []ToolCall{{ID: "toolu_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city": "Paris"}`}}}, resp.Choices[0].Message.ToolCalls)
+}
+
+func TestAnthropicStreamToolCalls(t *testing.T) {
+	stream := `data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-sonnet-20241022"}}
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}
+data: {"type":"message_stop"}
+`
+	chunks := make(chan StreamChunk, 10)
+	assert.NoError(t, readAnthropicStream(context.Background(), strings.NewReader(stream), chunks))
+	close(chunks)
+
+	var calls []ToolCallDelta
+	for chunk := range chunks {
+		calls = append(calls, chunk.ToolCalls...)
+	}
+	assert.Equal(t, []ToolCallDelta{
+		{Index: 0, ID: "toolu_1", Type: "function", Function: FunctionCallDelta{Name: "get_weather"}},
+		{Index: 0, Function: FunctionCallDelta{Arguments: `{"city":`}},
+		{Index: 0, Function: FunctionCallDelta{Arguments: `"Paris"}`}},
+	}, calls)
+}
+
+func TestAnthropicEmulatesNWithParallelRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"model": "claude-3-5-haiku-20241022",
+			"content": [{"type": "text", "text": "Hi"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 5, "output_tokens": 1}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithBaseURL(server.URL))
+	req := &ChatRequest{
+		Model:    "claude-3-5-haiku-20241022",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+		N:        3,
+	}
+	resp, err := p.ChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Len(t, resp.Choices, 3)
+	for i, choice := range resp.Choices {
+		assert.Equal(t, i, choice.Index)
+		assert.Equal(t, "Hi", choice.Message.Content)
+	}
+	assert.Equal(t, Usage{PromptTokens: 15, CompletionTokens: 3, TotalTokens: 18}, resp.Usage)
+
+	_, err = p.ChatCompletionStream(context.Background(), req)
+	assert.Equal(t, ErrorKindUnsupported, KindOf(err))
+}
@@ -0,0 +1,220 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AzureOpenAIProvider implements the Azure OpenAI provider. Azure serves
+// models through named deployments, so each gateway model is mapped to the
+// deployment hosting it. Request and response bodies are OpenAI's.
+type AzureOpenAIProvider struct {
+	apiKey      string
+	endpoint    string
+	apiVersion  string
+	deployments map[string]string
+	client      *retryableClient
+	timeout     time.Duration
+}
+
+// NewAzureOpenAIProvider creates a new Azure OpenAI provider. endpoint is the
+// resource URL (https://{resource}.openai.azure.com) and deployments maps
+// model names to deployment names.
+func NewAzureOpenAIProvider(endpoint, apiKey, apiVersion string, deployments map[string]string, opts ...Option) *AzureOpenAIProvider {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &AzureOpenAIProvider{
+		apiKey:      apiKey,
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		apiVersion:  apiVersion,
+		deployments: deployments,
+		client:      newRetryableClient(newHTTPClient(o.transport), o.retry, o.retryBudget),
+		timeout:     o.timeout,
+	}
+}
+
+// Name returns the provider name
+func (p *AzureOpenAIProvider) Name() string {
+	return "azure"
+}
+
+// BaseURL returns the resource endpoint
+func (p *AzureOpenAIProvider) BaseURL() string {
+	return p.endpoint
+}
+
+// Deployments returns the model names served by this provider
+func (p *AzureOpenAIProvider) Deployments() []string {
+	models := make([]string, 0, len(p.deployments))
+	for model := range p.deployments {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// deploymentURL builds the URL of an operation on the deployment serving model
+func (p *AzureOpenAIProvider) deploymentURL(model, operation string) (string, error) {
+	deployment, ok := p.deployments[model]
+	if !ok {
+		return "", newError(p.Name(), ErrorKindInvalidRequest, fmt.Errorf("no deployment configured for model %s", model))
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+		p.endpoint, url.PathEscape(deployment), operation, url.QueryEscape(p.apiVersion)), nil
+}
+
+// post sends a JSON body to a deployment operation
+func (p *AzureOpenAIProvider) post(ctx context.Context, model, operation string, payload interface{}) (*http.Response, error) {
+	endpoint, err := p.deploymentURL(model, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("api-key", p.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "send request", err)
+	}
+	return resp, nil
+}
+
+// ChatCompletion performs a chat completion
+func (p *AzureOpenAIProvider) ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.post(ctx, req.Model, "chat/completions", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "read response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	var chatResp ChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
+	}
+	chatResp.UpstreamRequestID = upstreamRequestID(resp.Header)
+
+	return &chatResp, nil
+}
+
+// ChatCompletionStream performs a streamed chat completion. Azure uses
+// OpenAI's SSE format, so the stream is parsed the same way.
+func (p *AzureOpenAIProvider) ChatCompletionStream(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, error) {
+	streamReq := *req
+	streamReq.Stream = true
+
+	resp, err := p.post(ctx, req.Model, "chat/completions", streamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	return streamResponse(ctx, resp, readOpenAIStream), nil
+}
+
+// Embeddings creates embedding vectors for the request inputs
+func (p *AzureOpenAIProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.post(ctx, req.Model, "embeddings", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "read response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	var embeddingResp EmbeddingResponse
+	if err := json.Unmarshal(respBody, &embeddingResp); err != nil {
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
+	}
+
+	return &embeddingResp, nil
+}
+
+// HealthCheck implements HealthChecker with a one-token completion from
+// the first deployment, since Models does not call the API
+func (p *AzureOpenAIProvider) HealthCheck(ctx context.Context) error {
+	deployments := p.Deployments()
+	if len(deployments) == 0 {
+		return newError(p.Name(), ErrorKindUnsupported, fmt.Errorf("no deployments configured"))
+	}
+	_, err := p.ChatCompletion(ctx, &ChatRequest{
+		Model:     deployments[0],
+		Messages:  []Message{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	})
+	return err
+}
+
+// Models returns the models with a configured deployment
+func (p *AzureOpenAIProvider) Models(ctx context.Context) ([]ModelInfo, error) {
+	models := make([]ModelInfo, 0, len(p.deployments))
+	for _, id := range p.Deployments() {
+		info := ModelInfo{
+			ID:      id,
+			Object:  "model",
+			OwnedBy: "azure",
+		}
+		for _, cw := range openAIContextWindows {
+			if strings.HasPrefix(id, cw.prefix) {
+				info.ContextWindow = cw.tokens
+				break
+			}
+		}
+		if strings.Contains(id, "embedding") {
+			info.Capabilities.Embeddings = true
+		} else {
+			info.Capabilities.Chat = true
+			info.Capabilities.Streaming = true
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
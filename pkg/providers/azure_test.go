@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureChatCompletionUsesDeployment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/openai/deployments/my-gpt4/chat/completions", r.URL.Path)
+		assert.Equal(t, "2024-02-01", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "test-key", r.Header.Get("api-key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewAzureOpenAIProvider(server.URL+"/", "test-key", "2024-02-01", map[string]string{"gpt-4": "my-gpt4"})
+
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "gpt-4",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+
+	_, err = p.ChatCompletion(context.Background(), &ChatRequest{Model: "gpt-4o"})
+	assert.Error(t, err)
+}
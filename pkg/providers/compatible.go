@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"strings"
+)
+
+// CompatibleConfig configures a provider for a server speaking the OpenAI
+// API, such as vLLM, LocalAI, Together or Groq
+type CompatibleConfig struct {
+	// Name is the provider name models are routed to
+	Name    string
+	BaseURL string
+	APIKey  string
+	// AuthHeader carries the API key; the default, Authorization, sends it
+	// as a bearer token and any other header sends it as is
+	AuthHeader string
+	// ModelPrefix, e.g. "groq/", is stripped from model names before they
+	// are sent upstream, so the gateway can tell the server's models apart
+	ModelPrefix string
+}
+
+// CompatibleProvider implements a provider for an OpenAI-compatible server.
+// Requests and responses are OpenAI's; only the URL, authentication and
+// model names differ.
+type CompatibleProvider struct {
+	*OpenAIProvider
+	modelPrefix string
+}
+
+// NewCompatibleProvider creates a provider for an OpenAI-compatible server
+func NewCompatibleProvider(config CompatibleConfig, opts ...Option) *CompatibleProvider {
+	openai := NewOpenAIProvider(config.APIKey, append([]Option{WithBaseURL(config.BaseURL)}, opts...)...)
+	openai.name = config.Name
+	if config.AuthHeader != "" {
+		openai.authHeader = config.AuthHeader
+	}
+	return &CompatibleProvider{OpenAIProvider: openai, modelPrefix: config.ModelPrefix}
+}
+
+// upstreamModel strips the model prefix
+func (p *CompatibleProvider) upstreamModel(model string) string {
+	return strings.TrimPrefix(model, p.modelPrefix)
+}
+
+// ChatCompletion performs a chat completion. The response reports the
+// model name used by the server.
+func (p *CompatibleProvider) ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	upstreamReq := *req
+	upstreamReq.Model = p.upstreamModel(req.Model)
+	return p.OpenAIProvider.ChatCompletion(ctx, &upstreamReq)
+}
+
+// ChatCompletionStream performs a streamed chat completion
+func (p *CompatibleProvider) ChatCompletionStream(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, error) {
+	upstreamReq := *req
+	upstreamReq.Model = p.upstreamModel(req.Model)
+	return p.OpenAIProvider.ChatCompletionStream(ctx, &upstreamReq)
+}
+
+// Embeddings creates embedding vectors for the request inputs
+func (p *CompatibleProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	upstreamReq := *req
+	upstreamReq.Model = p.upstreamModel(req.Model)
+	return p.OpenAIProvider.Embeddings(ctx, &upstreamReq)
+}
+
+// Models lists the server's models under the model prefix. Models that
+// are not embedding models are assumed to serve chat.
+func (p *CompatibleProvider) Models(ctx context.Context) ([]ModelInfo, error) {
+	models, err := p.OpenAIProvider.Models(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range models {
+		models[i].ID = p.modelPrefix + models[i].ID
+		if !models[i].Capabilities.Embeddings {
+			models[i].Capabilities.Chat = true
+			models[i].Capabilities.Streaming = true
+		}
+	}
+	return models, nil
+}
@@ -0,0 +1,63 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompatibleProvider(t *testing.T) {
+	var got ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-API-Key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(`{"id":"chatcmpl-1","model":"llama-3-70b","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+		case "/v1/models":
+			w.Write([]byte(`{"data":[{"id":"llama-3-70b","owned_by":"meta"},{"id":"nomic-embedding","owned_by":"nomic"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	p := NewCompatibleProvider(CompatibleConfig{
+		Name:        "vllm",
+		BaseURL:     server.URL + "/v1",
+		APIKey:      "secret",
+		AuthHeader:  "X-API-Key",
+		ModelPrefix: "vllm/",
+	})
+	assert.Equal(t, "vllm", p.Name())
+
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "vllm/llama-3-70b",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "llama-3-70b", got.Model, "the prefix is stripped")
+	assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+
+	models, err := p.Models(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "vllm/llama-3-70b", models[0].ID)
+	assert.True(t, models[0].Capabilities.Chat)
+	assert.True(t, models[1].Capabilities.Embeddings)
+	assert.False(t, models[1].Capabilities.Chat)
+}
+
+func TestCompatibleProviderBearerAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer gsk-key", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[]}`))
+	}))
+	defer server.Close()
+
+	p := NewCompatibleProvider(CompatibleConfig{Name: "groq", BaseURL: server.URL, APIKey: "gsk-key"})
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{Model: "llama3-70b-8192"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,176 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind is a machine-readable classification of a provider failure
+type ErrorKind string
+
+// Provider error kinds
+const (
+	ErrorKindTimeout        ErrorKind = "timeout"
+	ErrorKindCanceled       ErrorKind = "canceled"
+	ErrorKindNetwork        ErrorKind = "network"
+	ErrorKindRateLimit      ErrorKind = "rate_limit"
+	ErrorKindAuth           ErrorKind = "auth"
+	ErrorKindInvalidRequest ErrorKind = "invalid_request"
+	ErrorKindServer         ErrorKind = "server_error"
+	ErrorKindDecode         ErrorKind = "decode"
+	ErrorKindUnsupported    ErrorKind = "unsupported"
+	ErrorKindUnknown        ErrorKind = "unknown"
+)
+
+// ProviderError is returned when a provider call fails. StatusCode and Body
+// are set when the API responded with a non-success status, along with
+// RequestID if the API reported one; Err holds the cause of failures that
+// happened before or after that, such as network or decode errors. A
+// successful response that can't be decoded has Kind ErrorKindDecode, with
+// the start of its body in Body and its ContentType.
+type ProviderError struct {
+	Provider    string
+	Kind        ErrorKind
+	StatusCode  int
+	Body        string
+	ContentType string
+	RequestID   string
+	Err         error
+
+	// GatewayRequestID is the X-Request-ID of the gateway request the call
+	// was made for, tying the error to the request's logs and trace
+	GatewayRequestID string
+}
+
+// Error implements the error interface
+func (e *ProviderError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Provider, e.Err)
+	switch {
+	case e.StatusCode != 0:
+		msg = fmt.Sprintf("%s API returned status %d: %s", e.Provider, e.StatusCode, e.Body)
+	case e.Kind == ErrorKindDecode:
+		msg += fmt.Sprintf(" (content type %q, body %q)", e.ContentType, e.Body)
+	}
+	if e.RequestID != "" {
+		msg += " (request ID " + e.RequestID + ")"
+	}
+	if e.GatewayRequestID != "" {
+		msg += " (gateway request ID " + e.GatewayRequestID + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the error
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError builds the error for a non-success API response
+func newStatusError(provider string, resp *http.Response, body []byte) *ProviderError {
+	return &ProviderError{
+		Provider:   provider,
+		Kind:       kindForStatus(resp.StatusCode),
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RequestID:  upstreamRequestID(resp.Header),
+	}
+}
+
+// maxDecodeSnippet bounds the part of an undecodable body kept in its error
+const maxDecodeSnippet = 256
+
+// newDecodeError builds the error for a successful API response whose body
+// can't be decoded, such as a truncated response or an HTML error page
+func newDecodeError(provider string, resp *http.Response, body []byte, err error) *ProviderError {
+	snippet := string(body)
+	if len(snippet) > maxDecodeSnippet {
+		snippet = strings.ToValidUTF8(snippet[:maxDecodeSnippet], "") + "..."
+	}
+	return &ProviderError{
+		Provider:    provider,
+		Kind:        ErrorKindDecode,
+		Body:        snippet,
+		ContentType: resp.Header.Get("Content-Type"),
+		RequestID:   upstreamRequestID(resp.Header),
+		Err:         fmt.Errorf("failed to decode response: %w", err),
+	}
+}
+
+// upstreamRequestID returns the ID the provider assigned to a request, from
+// the x-request-id header of OpenAI and Azure or the request-id header of
+// Anthropic
+func upstreamRequestID(header http.Header) string {
+	if id := header.Get("x-request-id"); id != "" {
+		return id
+	}
+	return header.Get("request-id")
+}
+
+// newError wraps a failed provider call with its kind
+func newError(provider string, kind ErrorKind, err error) *ProviderError {
+	return &ProviderError{Provider: provider, Kind: kind, Err: err}
+}
+
+// newTransportError wraps a failure to send a request or read a response
+func newTransportError(provider, action string, err error) *ProviderError {
+	return newError(provider, KindOf(err), fmt.Errorf("failed to %s: %w", action, err))
+}
+
+// kindForStatus classifies an HTTP status code
+func kindForStatus(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorKindAuth
+	case statusCode == http.StatusRequestTimeout:
+		return ErrorKindTimeout
+	case statusCode >= 500:
+		return ErrorKindServer
+	case statusCode >= 400:
+		return ErrorKindInvalidRequest
+	}
+	return ErrorKindUnknown
+}
+
+// KindOf classifies an error returned by a provider
+func KindOf(err error) ErrorKind {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		if providerErr.Kind != "" {
+			return providerErr.Kind
+		}
+		if providerErr.StatusCode != 0 {
+			return kindForStatus(providerErr.StatusCode)
+		}
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorKindTimeout
+		}
+		return ErrorKindNetwork
+	}
+	return ErrorKindUnknown
+}
+
+// IsRetryable reports whether a failed provider call may succeed if sent
+// again or to another provider. Server errors, upstream rate limiting,
+// timeouts and network failures are retryable; other client errors are not.
+func IsRetryable(err error) bool {
+	switch KindOf(err) {
+	case ErrorKindServer, ErrorKindRateLimit, ErrorKindTimeout, ErrorKindNetwork:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	assert.Equal(t, ErrorKindRateLimit, KindOf(&ProviderError{StatusCode: 429}))
+	assert.Equal(t, ErrorKindAuth, KindOf(&ProviderError{StatusCode: 401}))
+	assert.Equal(t, ErrorKindInvalidRequest, KindOf(&ProviderError{StatusCode: 400}))
+	assert.Equal(t, ErrorKindServer, KindOf(&ProviderError{StatusCode: 503}))
+	assert.Equal(t, ErrorKindDecode, KindOf(newError("openai", ErrorKindDecode, errors.New("bad json"))))
+	assert.Equal(t, ErrorKindTimeout, KindOf(context.DeadlineExceeded))
+	assert.Equal(t, ErrorKindUnknown, KindOf(errors.New("boom")))
+}
+
+func TestProviderErrorMessageIncludesRequestIDs(t *testing.T) {
+	err := &ProviderError{Provider: "openai", StatusCode: 500, Body: "oops", RequestID: "req_123", GatewayRequestID: "gw-1"}
+	assert.Equal(t, "openai API returned status 500: oops (request ID req_123) (gateway request ID gw-1)", err.Error())
+
+	err = &ProviderError{Provider: "openai", Err: errors.New("connection refused"), GatewayRequestID: "gw-1"}
+	assert.Equal(t, "openai: connection refused (gateway request ID gw-1)", err.Error())
+}
+
+func TestProviderErrorKinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`not json`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithRetryConfig(testRetryConfig()))
+	p.baseURL = server.URL
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{Model: "gpt-4"})
+	assert.Equal(t, ErrorKindDecode, KindOf(err))
+	assert.False(t, IsRetryable(err))
+
+	p = NewOpenAIProvider("test-key", WithRetryConfig(testRetryConfig()), WithTimeout(time.Millisecond))
+	p.baseURL = "http://127.0.0.1:1"
+	_, err = p.ChatCompletion(context.Background(), &ChatRequest{Model: "gpt-4"})
+	assert.Contains(t, []ErrorKind{ErrorKindNetwork, ErrorKindTimeout}, KindOf(err))
+	assert.True(t, IsRetryable(err))
+}
+
+func TestUndecodableResponse(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("Bad gateway ", 100) + "</body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("x-request-id", "req_123")
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL), WithRetryConfig(testRetryConfig()))
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{Model: "gpt-4"})
+
+	var providerErr *ProviderError
+	if assert.ErrorAs(t, err, &providerErr) {
+		assert.Equal(t, ErrorKindDecode, providerErr.Kind)
+		assert.Equal(t, "text/html", providerErr.ContentType)
+		assert.Equal(t, page[:maxDecodeSnippet]+"...", providerErr.Body, "the body is truncated")
+		assert.Contains(t, err.Error(), `content type "text/html", body "<html><body>Bad gateway`)
+		assert.Contains(t, err.Error(), "(request ID req_123)")
+	}
+}
+
+func TestUpstreamRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		provider string
+		header   string
+		newP     func(url string) Provider
+	}{
+		{"openai", "x-request-id", func(url string) Provider { return NewOpenAIProvider("test-key", WithBaseURL(url)) }},
+		{"anthropic", "request-id", func(url string) Provider { return NewAnthropicProvider("test-key", WithBaseURL(url)) }},
+	} {
+		t.Run(tc.provider, func(t *testing.T) {
+			status := http.StatusOK
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(tc.header, "req_123")
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(`{"id":"1","choices":[],"content":[]}`))
+				} else {
+					w.Write([]byte(`{"error":{"message":"bad"}}`))
+				}
+			}))
+			defer server.Close()
+			p := tc.newP(server.URL)
+			req := &ChatRequest{Model: "m", Messages: []Message{{Role: "user", Content: "Hi"}}}
+
+			resp, err := p.ChatCompletion(context.Background(), req)
+			assert.NoError(t, err)
+			assert.Equal(t, "req_123", resp.UpstreamRequestID)
+
+			status = http.StatusBadRequest
+			_, err = p.ChatCompletion(context.Background(), req)
+			var providerErr *ProviderError
+			assert.ErrorAs(t, err, &providerErr)
+			assert.Equal(t, "req_123", providerErr.RequestID)
+			assert.Contains(t, err.Error(), "(request ID req_123)")
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GeminiProvider implements the Google Gemini provider
+type GeminiProvider struct {
+	apiKey  string
+	baseURL string
+	client  *retryableClient
+	timeout time.Duration
+}
+
+// NewGeminiProvider creates a new Gemini provider
+func NewGeminiProvider(apiKey string, opts ...Option) *GeminiProvider {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &GeminiProvider{
+		apiKey:  apiKey,
+		baseURL: o.baseURLOr("https://generativelanguage.googleapis.com/v1beta"),
+		client:  newRetryableClient(newHTTPClient(o.transport), o.retry, o.retryBudget),
+		timeout: o.timeout,
+	}
+}
+
+// Name returns the provider name
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+// BaseURL returns the base URL of the API
+func (p *GeminiProvider) BaseURL() string {
+	return p.baseURL
+}
+
+// geminiPart represents a part of Gemini content
+type geminiPart struct {
+	Text       string      `json:"text,omitempty"`
+	InlineData *geminiBlob `json:"inlineData,omitempty"`
+}
+
+// geminiBlob holds inline base64 data such as an image
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// geminiContent represents a single turn of a Gemini conversation
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiRequest represents Gemini's generateContent request format
+type geminiRequest struct {
+	Contents          []geminiContent `json:"contents"`
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	GenerationConfig  struct {
+		Temperature      *float64 `json:"temperature,omitempty"`
+		TopP             float64  `json:"topP,omitempty"`
+		MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+		StopSequences    []string `json:"stopSequences,omitempty"`
+		PresencePenalty  float64  `json:"presencePenalty,omitempty"`
+		FrequencyPenalty float64  `json:"frequencyPenalty,omitempty"`
+		CandidateCount   int      `json:"candidateCount,omitempty"`
+		Seed             *int64   `json:"seed,omitempty"`
+	} `json:"generationConfig"`
+}
+
+// geminiResponse represents Gemini's generateContent response format
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+		Index        int           `json:"index"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// ChatCompletion performs a chat completion using Gemini's generateContent API
+func (p *GeminiProvider) ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// Convert to Gemini format
+	geminiReq, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshal request
+	body, err := json.Marshal(geminiReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	url := fmt.Sprintf("%s/models/%s:generateContent", p.baseURL, req.Model)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	// Send request
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "send request", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "read response", err)
+	}
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	// Parse Gemini response
+	var geminiResp geminiResponse
+	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
+	}
+
+	// Convert to standard format
+	choices := make([]Choice, 0, len(geminiResp.Candidates))
+	for _, candidate := range geminiResp.Candidates {
+		var text strings.Builder
+		for _, part := range candidate.Content.Parts {
+			text.WriteString(part.Text)
+		}
+		choices = append(choices, Choice{
+			Index: candidate.Index,
+			Message: Message{
+				Role:    "assistant",
+				Content: text.String(),
+			},
+			FinishReason: geminiFinishReason(candidate.FinishReason),
+		})
+	}
+
+	chatResp := &ChatResponse{
+		ID:      fmt.Sprintf("gemini-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: choices,
+		Usage: Usage{
+			PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+		},
+		UpstreamRequestID: upstreamRequestID(resp.Header),
+	}
+
+	return chatResp, nil
+}
+
+// toGeminiRequest converts a chat request to Gemini's format. System
+// messages become the system instruction and the assistant role is renamed
+// to "model". Tool calling is not supported.
+func toGeminiRequest(req *ChatRequest) (geminiRequest, error) {
+	var geminiReq geminiRequest
+	var system []geminiPart
+
+	if len(req.Tools) > 0 {
+		return geminiRequest{}, newError("gemini", ErrorKindUnsupported, errors.New("tool calling is not supported"))
+	}
+	if req.Logprobs || req.TopLogprobs > 0 {
+		return geminiRequest{}, newError("gemini", ErrorKindUnsupported, errors.New("logprobs are not supported"))
+	}
+	for _, msg := range req.Messages {
+		if msg.Role == "tool" || len(msg.ToolCalls) > 0 {
+			return geminiRequest{}, newError("gemini", ErrorKindUnsupported, errors.New("tool calling is not supported"))
+		}
+		parts, err := geminiParts(msg)
+		if err != nil {
+			return geminiRequest{}, err
+		}
+		switch msg.Role {
+		case "system":
+			system = append(system, parts...)
+		case "assistant":
+			geminiReq.Contents = append(geminiReq.Contents, geminiContent{Role: "model", Parts: parts})
+		default:
+			geminiReq.Contents = append(geminiReq.Contents, geminiContent{Role: "user", Parts: parts})
+		}
+	}
+
+	if len(system) > 0 {
+		geminiReq.SystemInstruction = &geminiContent{Parts: system}
+	}
+	geminiReq.GenerationConfig.Temperature = req.temperature()
+	geminiReq.GenerationConfig.TopP = req.TopP
+	geminiReq.GenerationConfig.MaxOutputTokens = req.MaxTokens
+	geminiReq.GenerationConfig.StopSequences = req.Stop
+	geminiReq.GenerationConfig.PresencePenalty = req.PresencePenalty
+	geminiReq.GenerationConfig.FrequencyPenalty = req.FrequencyPenalty
+	geminiReq.GenerationConfig.CandidateCount = req.N
+	geminiReq.GenerationConfig.Seed = req.Seed
+
+	return geminiReq, nil
+}
+
+// geminiParts converts message content to Gemini parts. Images must be
+// sent as data URLs, which become inline data; Gemini cannot fetch
+// arbitrary image URLs.
+func geminiParts(msg Message) ([]geminiPart, error) {
+	if msg.Parts == nil {
+		return []geminiPart{{Text: msg.Content}}, nil
+	}
+
+	parts := make([]geminiPart, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		switch {
+		case part.Type == ContentPartText:
+			parts = append(parts, geminiPart{Text: part.Text})
+		case part.Type == ContentPartImageURL && part.ImageURL != nil:
+			mimeType, data, ok := parseDataURL(part.ImageURL.URL)
+			if !ok {
+				return nil, newError("gemini", ErrorKindInvalidRequest, errors.New("images must be sent as base64 data URLs"))
+			}
+			parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: mimeType, Data: data}})
+		}
+	}
+	return parts, nil
+}
+
+// geminiFinishReason maps Gemini finish reasons to OpenAI's
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT":
+		return "content_filter"
+	}
+	return strings.ToLower(reason)
+}
+
+// geminiModels is the static list of Gemini models
+var geminiModels = []ModelInfo{
+	{ID: "gemini-1.5-pro", ContextWindow: 2097152, Capabilities: ModelCapabilities{Chat: true, Vision: true}},
+	{ID: "gemini-1.5-flash", ContextWindow: 1048576, Capabilities: ModelCapabilities{Chat: true, Vision: true}},
+	{ID: "gemini-2.0-flash", ContextWindow: 1048576, Capabilities: ModelCapabilities{Chat: true, Vision: true}},
+}
+
+// Models returns the known Gemini models
+func (p *GeminiProvider) Models(ctx context.Context) ([]ModelInfo, error) {
+	models := make([]ModelInfo, len(geminiModels))
+	for i, m := range geminiModels {
+		m.Object = "model"
+		m.OwnedBy = "google"
+		models[i] = m
+	}
+	return models, nil
+}
+
+// HealthCheck implements HealthChecker with a one-token completion from
+// the cheapest model, since Models does not call the API
+func (p *GeminiProvider) HealthCheck(ctx context.Context) error {
+	_, err := p.ChatCompletion(ctx, &ChatRequest{
+		Model:     "gemini-1.5-flash",
+		Messages:  []Message{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	})
+	return err
+}
+
+// Embeddings is not supported by the Gemini provider
+func (p *GeminiProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	return nil, newError(p.Name(), ErrorKindUnsupported, errors.New("embeddings are not supported"))
+}
@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeminiChatCompletion(t *testing.T) {
+	var got geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models/gemini-1.5-flash:generateContent", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-goog-api-key"))
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{
+			"candidates": [{"content": {"role": "model", "parts": [{"text": "Hi "}, {"text": "there"}]}, "finishReason": "MAX_TOKENS"}],
+			"usageMetadata": {"promptTokenCount": 7, "candidatesTokenCount": 2, "totalTokenCount": 9}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key")
+	p.baseURL = server.URL
+
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model: "gemini-1.5-flash",
+		Messages: []Message{
+			{Role: "system", Content: "Be brief"},
+			{Role: "user", Content: "Hello"},
+			{Role: "assistant", Content: "Hi"},
+			{Role: "user", Content: "Again"},
+		},
+		MaxTokens: 2,
+	})
+	assert.NoError(t, err)
+
+	assert.NotNil(t, got.SystemInstruction)
+	assert.Equal(t, "Be brief", got.SystemInstruction.Parts[0].Text)
+	assert.Len(t, got.Contents, 3)
+	assert.Equal(t, "model", got.Contents[1].Role)
+	assert.Equal(t, 2, got.GenerationConfig.MaxOutputTokens)
+
+	assert.Equal(t, "Hi there", resp.Choices[0].Message.Content)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9}, resp.Usage)
+}
+
+func TestGeminiRequestInlinesImages(t *testing.T) {
+	got, err := toGeminiRequest(&ChatRequest{
+		Model: "gemini-1.5-flash",
+		Messages: []Message{{Role: "user", Parts: []ContentPart{
+			{Type: ContentPartText, Text: "Describe"},
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "data:image/png;base64,AAAA"}},
+		}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []geminiPart{
+		{Text: "Describe"},
+		{InlineData: &geminiBlob{MimeType: "image/png", Data: "AAAA"}},
+	}, got.Contents[0].Parts)
+
+	_, err = toGeminiRequest(&ChatRequest{
+		Model: "gemini-1.5-flash",
+		Messages: []Message{{Role: "user", Parts: []ContentPart{
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png"}},
+		}}},
+	})
+	assert.Equal(t, ErrorKindInvalidRequest, KindOf(err))
+}
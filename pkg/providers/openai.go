@@ -1,79 +1,404 @@
 package providers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
 // OpenAIProvider implements the OpenAI provider
 type OpenAIProvider struct {
-	apiKey  string
-	baseURL string
-	client  *http.Client
+	name       string
+	apiKey     string
+	authHeader string
+	baseURL    string
+	client     *retryableClient
+	timeout    time.Duration
+
+	// reasoningModels are the prefixes of reasoning model names
+	reasoningModels []string
+}
+
+// DefaultReasoningModels returns the prefixes of OpenAI's reasoning models
+func DefaultReasoningModels() []string {
+	return []string{"o1", "o3", "o4"}
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
-func NewOpenAIProvider(apiKey string) *OpenAIProvider {
+func NewOpenAIProvider(apiKey string, opts ...Option) *OpenAIProvider {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return &OpenAIProvider{
-		apiKey:  apiKey,
-		baseURL: "https://api.openai.com/v1",
-		client: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		name:       "openai",
+		apiKey:     apiKey,
+		authHeader: "Authorization",
+		baseURL:    o.baseURLOr("https://api.openai.com/v1"),
+		client:     newRetryableClient(newHTTPClient(o.transport), o.retry, o.retryBudget),
+		timeout:    o.timeout,
+
+		reasoningModels: o.reasoningModels,
 	}
 }
 
 // Name returns the provider name
 func (p *OpenAIProvider) Name() string {
-	return "openai"
+	return p.name
+}
+
+// BaseURL returns the base URL of the API
+func (p *OpenAIProvider) BaseURL() string {
+	return p.baseURL
+}
+
+// setAuth authenticates a request with the API key, as a bearer token in
+// the Authorization header or as is in any other header. Without a key, as
+// for self-hosted servers, requests are sent unauthenticated.
+func (p *OpenAIProvider) setAuth(httpReq *http.Request) {
+	switch {
+	case p.apiKey == "":
+	case http.CanonicalHeaderKey(p.authHeader) == "Authorization":
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	default:
+		httpReq.Header.Set(p.authHeader, p.apiKey)
+	}
+}
+
+// openAIReasoningRequest is a request to a reasoning model, which takes
+// max_completion_tokens instead of max_tokens. It embeds the request
+// without ChatRequest.MarshalJSON, which would otherwise be promoted and
+// drop max_completion_tokens.
+type openAIReasoningRequest struct {
+	chatRequestFields
+	MaxCompletionTokens int `json:"max_completion_tokens,omitempty"`
+}
+
+// chatRequestFields is a ChatRequest without its JSON methods
+type chatRequestFields ChatRequest
+
+// isReasoningModel reports whether a model is a reasoning model
+func (p *OpenAIProvider) isReasoningModel(model string) bool {
+	for _, prefix := range p.reasoningModels {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalRequest encodes a chat request. Reasoning models reject
+// max_tokens and temperature, so max_tokens is sent as
+// max_completion_tokens and temperature is dropped.
+func (p *OpenAIProvider) marshalRequest(req *ChatRequest) ([]byte, error) {
+	if !p.isReasoningModel(req.Model) {
+		return json.Marshal(req)
+	}
+	reasoningReq := openAIReasoningRequest{chatRequestFields: chatRequestFields(*req), MaxCompletionTokens: req.MaxTokens}
+	reasoningReq.MaxTokens = 0
+	reasoningReq.Temperature, reasoningReq.TemperatureSet = 0, false
+	return json.Marshal(reasoningReq)
 }
 
 // ChatCompletion performs a chat completion
-func (p *OpenAIProvider) ChatCompletion(req *ChatRequest) (*ChatResponse, error) {
+func (p *OpenAIProvider) ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
 	// Prepare request body
-	body, err := json.Marshal(req)
+	body, err := p.marshalRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", p.baseURL+"/chat/completions", bytes.NewBuffer(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setAuth(httpReq)
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	// Send request
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, newTransportError(p.Name(), "send request", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, newTransportError(p.Name(), "read response", err)
 	}
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newStatusError(p.Name(), resp, respBody)
 	}
 
 	// Parse response
 	var chatResp ChatResponse
 	if err := json.Unmarshal(respBody, &chatResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
 	}
+	chatResp.UpstreamRequestID = upstreamRequestID(resp.Header)
 
 	return &chatResp, nil
 }
 
+// Embeddings creates embedding vectors for the request inputs
+func (p *OpenAIProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/embeddings", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	p.setAuth(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "send request", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "read response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	var embeddingResp EmbeddingResponse
+	if err := json.Unmarshal(respBody, &embeddingResp); err != nil {
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
+	}
+
+	return &embeddingResp, nil
+}
+
+// openAIContextWindows maps model prefixes to their context window size.
+// Longer prefixes must come first so the most specific match wins.
+var openAIContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o-mini", 128000},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"text-embedding-", 8191},
+}
+
+// Models lists the models available to the configured API key
+func (p *OpenAIProvider) Models(ctx context.Context) ([]ModelInfo, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	p.setAuth(httpReq)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "send request", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "read response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	var listResp struct {
+		Data []struct {
+			ID      string `json:"id"`
+			OwnedBy string `json:"owned_by"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &listResp); err != nil {
+		return nil, newDecodeError(p.Name(), resp, respBody, err)
+	}
+
+	models := make([]ModelInfo, 0, len(listResp.Data))
+	for _, m := range listResp.Data {
+		info := ModelInfo{
+			ID:      m.ID,
+			Object:  "model",
+			OwnedBy: m.OwnedBy,
+		}
+		for _, cw := range openAIContextWindows {
+			if strings.HasPrefix(m.ID, cw.prefix) {
+				info.ContextWindow = cw.tokens
+				break
+			}
+		}
+		if strings.Contains(m.ID, "embedding") {
+			info.Capabilities.Embeddings = true
+		} else if strings.HasPrefix(m.ID, "gpt-") {
+			info.Capabilities.Chat = true
+			info.Capabilities.Streaming = true
+			info.Capabilities.Vision = strings.HasPrefix(m.ID, "gpt-4o") || strings.HasPrefix(m.ID, "gpt-4-turbo")
+		}
+		models = append(models, info)
+	}
+
+	return models, nil
+}
+
+// ChatCompletionStream performs a streamed chat completion. Chunks are
+// delivered on the returned channel, which is closed once the stream ends.
+// A failure mid-stream is delivered as a final chunk with Err set. Cancelling
+// ctx aborts the stream.
+func (p *OpenAIProvider) ChatCompletionStream(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, error) {
+	// Force streaming on a copy of the request, asking for the usage chunk
+	streamReq := *req
+	streamReq.Stream = true
+	streamReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	body, err := p.marshalRequest(&streamReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	p.setAuth(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(p.Name(), "send request", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newStatusError(p.Name(), resp, respBody)
+	}
+
+	return streamResponse(ctx, resp, readOpenAIStream), nil
+}
+
+// readOpenAIStream parses OpenAI's SSE "data:" lines and sends a chunk per
+// choice, plus one for the usage if reported, until the [DONE] sentinel is
+// received
+func readOpenAIStream(ctx context.Context, r io.Reader, chunks chan<- StreamChunk) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// Skip blank separators, comments and other SSE fields
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var event struct {
+			ChatStreamChunk
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if event.Error != nil {
+			return fmt.Errorf("stream error: %s", event.Error.Message)
+		}
+
+		for _, choice := range event.Choices {
+			chunk := StreamChunk{
+				ID:           event.ID,
+				Model:        event.Model,
+				Index:        choice.Index,
+				Role:         choice.Delta.Role,
+				Content:      choice.Delta.Content,
+				ToolCalls:    choice.Delta.ToolCalls,
+				FinishReason: choice.FinishReason,
+			}
+			if !sendChunk(ctx, chunks, chunk) {
+				return nil
+			}
+		}
+		if event.Usage != nil {
+			if !sendChunk(ctx, chunks, StreamChunk{ID: event.ID, Model: event.Model, Usage: event.Usage}) {
+				return nil
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return fmt.Errorf("stream ended before [DONE]")
+}
+
+// streamResponse reads a streamed response body with read on a new
+// goroutine. The upstream request ID, if any, is sent first; a read failure
+// is sent as a final chunk with Err set.
+func streamResponse(ctx context.Context, resp *http.Response, read func(context.Context, io.Reader, chan<- StreamChunk) error) <-chan StreamChunk {
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer resp.Body.Close()
+
+		if id := upstreamRequestID(resp.Header); id != "" {
+			if !sendChunk(ctx, chunks, StreamChunk{RequestID: id}) {
+				return
+			}
+		}
+		if err := read(ctx, resp.Body, chunks); err != nil {
+			sendChunk(ctx, chunks, StreamChunk{Err: err})
+		}
+	}()
+	return chunks
+}
+
+// sendChunk delivers a chunk unless ctx is cancelled first, so an abandoned
+// stream never blocks its reader goroutine
+func sendChunk(ctx context.Context, chunks chan<- StreamChunk, chunk StreamChunk) bool {
+	select {
+	case chunks <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
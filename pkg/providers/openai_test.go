@@ -0,0 +1,262 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIToolCallingRoundTrip(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{
+			"id": "chatcmpl-1",
+			"model": "gpt-4",
+			"choices": [{
+				"index": 0,
+				"message": {
+					"role": "assistant",
+					"content": null,
+					"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]
+				},
+				"finish_reason": "tool_calls"
+			}]
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "gpt-4",
+		Messages: []Message{{Role: "user", Content: "Weather in Paris?"}},
+		Tools: []Tool{{Type: "function", Function: FunctionDefinition{
+			Name:       "get_weather",
+			Parameters: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		}}},
+		ToolChoice: json.RawMessage(`"auto"`),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "auto", got["tool_choice"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":       "get_weather",
+			"parameters": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}},
+		},
+	}}, got["tools"])
+
+	assert.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+	assert.Equal(t, []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}, resp.Choices[0].Message.ToolCalls)
+
+	// The tool result is sent back in a follow-up request
+	_, err = p.ChatCompletion(context.Background(), &ChatRequest{
+		Model: "gpt-4",
+		Messages: []Message{
+			{Role: "user", Content: "Weather in Paris?"},
+			resp.Choices[0].Message,
+			{Role: "tool", ToolCallID: "call_1", Content: "Sunny"},
+		},
+	})
+	assert.NoError(t, err)
+
+	data, _ := json.Marshal(got["messages"])
+	assert.JSONEq(t, `[
+		{"role": "user", "content": "Weather in Paris?"},
+		{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+		{"role": "tool", "tool_call_id": "call_1", "content": "Sunny"}
+	]`, string(data))
+}
+
+func TestOpenAIReturnsAllChoices(t *testing.T) {
+	var got ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4","choices":[
+			{"index":0,"message":{"role":"assistant","content":"a"},"finish_reason":"stop"},
+			{"index":1,"message":{"role":"assistant","content":"b"},"finish_reason":"stop"},
+			{"index":2,"message":{"role":"assistant","content":"c"},"finish_reason":"stop"}
+		]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "gpt-4",
+		Messages: []Message{{Role: "user", Content: "Pick a letter"}},
+		N:        3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.N)
+	assert.Len(t, resp.Choices, 3)
+	for i, choice := range resp.Choices {
+		assert.Equal(t, i, choice.Index)
+	}
+}
+
+func TestOpenAILogprobsRoundTrip(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4","choices":[{"index":0,
+			"message":{"role":"assistant","content":"Yes"},"finish_reason":"stop",
+			"logprobs":{"content":[{"token":"Yes","logprob":-0.01,"bytes":[89,101,115],
+				"top_logprobs":[{"token":"Yes","logprob":-0.01,"bytes":[89,101,115]},{"token":"No","logprob":-4.6,"bytes":[78,111]}]}]}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:       "gpt-4",
+		Messages:    []Message{{Role: "user", Content: "Yes or no?"}},
+		Logprobs:    true,
+		TopLogprobs: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, true, got["logprobs"])
+	assert.Equal(t, float64(2), got["top_logprobs"])
+
+	logprobs := resp.Choices[0].Logprobs
+	if assert.NotNil(t, logprobs) && assert.Len(t, logprobs.Content, 1) {
+		token := logprobs.Content[0]
+		assert.Equal(t, "Yes", token.Token)
+		assert.Equal(t, -0.01, token.Logprob)
+		assert.Equal(t, []int{89, 101, 115}, token.Bytes)
+		assert.Len(t, token.TopLogprobs, 2)
+		assert.Equal(t, "No", token.TopLogprobs[1].Token)
+	}
+
+	// Requests without logprobs don't send them, and get none back
+	data, err := json.Marshal(&ChatRequest{Model: "gpt-4"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "logprobs")
+	data, err = json.Marshal(Choice{})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "logprobs")
+}
+
+func TestOpenAIForwardsSeedAndReturnsFingerprint(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"id":"chatcmpl-1","system_fingerprint":"fp_44709d6fcb","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	seed := int64(0)
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "gpt-4",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+		Seed:     &seed,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), got["seed"])
+	assert.Equal(t, "fp_44709d6fcb", resp.SystemFingerprint)
+}
+
+func TestOpenAIParsesUsageDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":2006,"completion_tokens":300,"total_tokens":2306,"prompt_tokens_details":{"cached_tokens":1920},"completion_tokens_details":{"reasoning_tokens":256}}}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{Model: "gpt-4o", Messages: []Message{{Role: "user", Content: "Hello"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2006, resp.Usage.PromptTokens)
+	assert.Equal(t, 1920, resp.Usage.CachedTokens())
+	assert.Equal(t, 256, resp.Usage.ReasoningTokens())
+
+	// Usage without details has none
+	assert.Zero(t, Usage{PromptTokens: 10}.CachedTokens())
+}
+
+func TestOpenAIReasoningModelParameters(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	req := &ChatRequest{
+		Model:       "o1-mini",
+		Messages:    []Message{{Role: "user", Content: "Hello"}},
+		MaxTokens:   500,
+		Temperature: 0.7,
+		TopP:        0.9,
+	}
+	_, err := p.ChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(500), got["max_completion_tokens"])
+	assert.NotContains(t, got, "max_tokens")
+	assert.NotContains(t, got, "temperature")
+	assert.Equal(t, 0.9, got["top_p"])
+	assert.Equal(t, 500, req.MaxTokens)
+
+	// Other models keep max_tokens and temperature
+	req.Model = "gpt-4o"
+	_, err = p.ChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(500), got["max_tokens"])
+	assert.Equal(t, 0.7, got["temperature"])
+	assert.NotContains(t, got, "max_completion_tokens")
+
+	// The reasoning models are configurable
+	p = NewOpenAIProvider("test-key", WithBaseURL(server.URL), WithReasoningModels([]string{"gpt-4o"}))
+	_, err = p.ChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(500), got["max_completion_tokens"])
+
+	// An explicit zero temperature is still dropped for reasoning models
+	req.Temperature, req.TemperatureSet = 0, true
+	_, err = p.ChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.NotContains(t, got, "temperature")
+	assert.Equal(t, float64(500), got["max_completion_tokens"])
+}
+
+func TestOpenAIBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Empty(t, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer server.Close()
+
+	// A self-hosted server, configured with a trailing slash
+	p := NewOpenAIProvider("", WithBaseURL(server.URL+"/v1/"))
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "llama-3-8b",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+}
+
+func TestOpenAIForwardsStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, []interface{}{"END", "\n\n"}, body["stop"])
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL))
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "gpt-4",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+		Stop:     StopSequences{"END", "\n\n"},
+	})
+	assert.NoError(t, err)
+}
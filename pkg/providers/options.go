@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Option configures a provider at construction
+type Option func(*options)
+
+// options holds the settings shared by all providers
+type options struct {
+	retry            RetryConfig
+	retryBudget      *RetryBudget
+	timeout          time.Duration
+	baseURL          string
+	strictParameters bool
+	transport        http.RoundTripper
+	reasoningModels  []string
+}
+
+// defaultOptions returns the settings used when no options are given
+func defaultOptions() options {
+	return options{
+		retry:           DefaultRetryConfig(),
+		timeout:         60 * time.Second,
+		transport:       defaultTransport,
+		reasoningModels: DefaultReasoningModels(),
+	}
+}
+
+// WithRetryConfig sets how transient provider failures are retried
+func WithRetryConfig(config RetryConfig) Option {
+	return func(o *options) {
+		o.retry = config
+	}
+}
+
+// WithRetryBudget caps the retries of the provider by a budget, normally
+// shared by all providers
+func WithRetryBudget(budget *RetryBudget) Option {
+	return func(o *options) {
+		o.retryBudget = budget
+	}
+}
+
+// WithTimeout sets the deadline of a non-streaming provider call, retries
+// included. Streaming calls are bounded by their context only, since long
+// generations can legitimately take minutes. Zero disables the timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithBaseURL overrides the API base URL, e.g. to go through a proxy or
+// an API-compatible server. A trailing slash is ignored.
+func WithBaseURL(url string) Option {
+	return func(o *options) {
+		o.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithStrictParameters makes providers reject requests setting parameters
+// they cannot honor, such as a seed, rather than ignore them
+func WithStrictParameters(strict bool) Option {
+	return func(o *options) {
+		o.strictParameters = strict
+	}
+}
+
+// WithTransport sets the transport provider calls are made over, such as
+// one created by NewTransport with tuned pooling
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithReasoningModels sets the prefixes of the names of OpenAI reasoning
+// models, whose requests take max_completion_tokens and no temperature
+func WithReasoningModels(prefixes []string) Option {
+	return func(o *options) {
+		o.reasoningModels = prefixes
+	}
+}
+
+// baseURLOr returns the configured base URL, or def if none is set
+func (o options) baseURLOr(def string) string {
+	if o.baseURL != "" {
+		return o.baseURL
+	}
+	return def
+}
+
+// withTimeout derives a context bounded by the provider timeout
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// newHTTPClient creates the HTTP client used for provider calls. Outbound
+// requests get a client span under the caller's span, and the trace context
+// is propagated to the provider.
+func newHTTPClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: otelhttp.NewTransport(transport),
+	}
+}
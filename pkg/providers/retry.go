@@ -0,0 +1,225 @@
+package providers
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryConfig controls how failed provider requests are retried
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry; it doubles on each retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts
+	MaxBackoff time.Duration
+	// MaxElapsedTime caps the total time spent retrying
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryConfig returns the retry settings used when none are configured
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		MaxElapsedTime: 30 * time.Second,
+	}
+}
+
+// RetryBudget caps the retries of the providers sharing it, like gRPC's
+// retry throttling. Each retry spends a token from a bucket refilled at a
+// fixed rate; once it is empty failed calls are not retried, so an
+// upstream outage fails requests fast instead of multiplying the traffic
+// sent to the provider.
+type RetryBudget struct {
+	capacity   float64
+	tokens     float64
+	refillRate float64
+	lastRefill time.Time
+	observe    func(allowed bool, remaining float64)
+	mu         sync.Mutex
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// NewRetryBudget creates a retry budget of capacity retries, refilled at
+// refillRate retries per second
+func NewRetryBudget(capacity int, refillRate float64) *RetryBudget {
+	return &RetryBudget{
+		capacity:   float64(capacity),
+		tokens:     float64(capacity),
+		refillRate: refillRate,
+		lastRefill: time.Now(),
+		now:        time.Now,
+	}
+}
+
+// Observe sets a function called with the outcome of every retry asked
+// for and the retries left, e.g. to export them as metrics
+func (b *RetryBudget) Observe(fn func(allowed bool, remaining float64)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.observe = fn
+}
+
+// Remaining returns the number of retries left in the budget
+func (b *RetryBudget) Remaining() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens
+}
+
+// allow spends a retry from the budget, reporting whether one was left. A
+// nil budget allows every retry.
+func (b *RetryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	b.refill()
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	observe, remaining := b.observe, b.tokens
+	b.mu.Unlock()
+
+	if observe != nil {
+		observe(allowed, remaining)
+	}
+	return allowed
+}
+
+// refill adds the retries accrued since the last refill
+func (b *RetryBudget) refill() {
+	now := b.now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.lastRefill).Seconds()*b.refillRate)
+	b.lastRefill = now
+}
+
+// retryableClient wraps an http.Client and retries transient failures
+// (network errors, 429, 500, 502, 503, 504) with exponential backoff and
+// jitter, as long as the retry budget, if any, allows
+type retryableClient struct {
+	client *http.Client
+	config RetryConfig
+	budget *RetryBudget
+}
+
+// newRetryableClient creates a new retrying HTTP client
+func newRetryableClient(client *http.Client, config RetryConfig, budget *RetryBudget) *retryableClient {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &retryableClient{
+		client: client,
+		config: config,
+		budget: budget,
+	}
+}
+
+// Do sends the request, retrying transient failures. The last response or
+// error is returned once attempts or elapsed time are exhausted.
+func (rc *retryableClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	backoff := rc.config.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := rc.client.Do(req)
+		if !shouldRetry(resp, err) || attempt >= rc.config.MaxAttempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := jitter(backoff)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+		}
+
+		// Give up if waiting would exceed the elapsed time budget, or if
+		// the retry budget is spent
+		if rc.config.MaxElapsedTime > 0 && time.Since(start)+wait > rc.config.MaxElapsedTime {
+			return resp, err
+		}
+		if !rc.budget.allow() {
+			return resp, err
+		}
+
+		// Rewind the body for the next attempt
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req.Body = body
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		backoff *= 2
+		if rc.config.MaxBackoff > 0 && backoff > rc.config.MaxBackoff {
+			backoff = rc.config.MaxBackoff
+		}
+	}
+}
+
+// shouldRetry reports whether a request outcome is transient
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// jitter returns a random duration in [d/2, d)
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		MaxElapsedTime: time.Second,
+	}
+}
+
+func TestRetryFailsTwiceThenSucceeds(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithRetryConfig(testRetryConfig()))
+	p.baseURL = server.URL
+
+	resp, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "gpt-4",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "chatcmpl-1", resp.ID)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider("test-key", WithRetryConfig(testRetryConfig()))
+	p.baseURL = server.URL
+
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{
+		Model:    "claude-3-haiku-20240307",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestRetryDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("test-key", WithRetryConfig(testRetryConfig()))
+	p.baseURL = server.URL
+
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{Model: "gpt-4"})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryBudgetCapsRetriesDuringOutage(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	budget := NewRetryBudget(2, 1)
+	now := time.Now()
+	budget.now = func() time.Time { return now }
+	var shed int
+	budget.Observe(func(allowed bool, remaining float64) {
+		if !allowed {
+			shed++
+		}
+	})
+	p := NewOpenAIProvider("test-key", WithRetryConfig(testRetryConfig()), WithRetryBudget(budget))
+	p.baseURL = server.URL
+	send := func() {
+		_, err := p.ChatCompletion(context.Background(), &ChatRequest{
+			Model:    "gpt-4",
+			Messages: []Message{{Role: "user", Content: "Hello"}},
+		})
+		assert.Error(t, err)
+	}
+
+	// The first call spends the budget on its two retries; the rest fail
+	// after one attempt instead of three
+	for i := 0; i < 5; i++ {
+		send()
+	}
+	assert.Equal(t, int32(5+2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 4, shed)
+	assert.Equal(t, 0.0, budget.Remaining())
+
+	// The budget refills over time
+	now = now.Add(time.Second)
+	atomic.StoreInt32(&calls, 0)
+	send()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	wait, ok := parseRetryAfter("2")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
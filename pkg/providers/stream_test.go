@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Equivalent streams of "Hello there", as sent by OpenAI and Anthropic
+const (
+	openAIStreamBody = `data: {"id":"resp_1","object":"chat.completion.chunk","model":"test-model","choices":[{"index":0,"delta":{"role":"assistant"}}]}
+
+data: {"id":"resp_1","object":"chat.completion.chunk","model":"test-model","choices":[{"index":0,"delta":{"content":"Hello"}}]}
+
+data: {"id":"resp_1","object":"chat.completion.chunk","model":"test-model","choices":[{"index":0,"delta":{"content":" there"}}]}
+
+data: {"id":"resp_1","object":"chat.completion.chunk","model":"test-model","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}
+
+data: {"id":"resp_1","object":"chat.completion.chunk","model":"test-model","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}
+
+data: [DONE]
+
+`
+	anthropicStreamBody = `event: message_start
+data: {"type":"message_start","message":{"id":"resp_1","model":"test-model","usage":{"input_tokens":5,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+)
+
+// collectStream runs a stream decoder over body and returns the chunks it sends
+func collectStream(t *testing.T, read func(context.Context, io.Reader, chan<- StreamChunk) error, body string) []StreamChunk {
+	chunks := make(chan StreamChunk)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		errs <- read(context.Background(), strings.NewReader(body), chunks)
+	}()
+
+	var received []StreamChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	assert.NoError(t, <-errs)
+	return received
+}
+
+func TestStreamDecodersProduceIdenticalChunks(t *testing.T) {
+	openAI := collectStream(t, readOpenAIStream, openAIStreamBody)
+	anthropic := collectStream(t, readAnthropicStream, anthropicStreamBody)
+
+	assert.Equal(t, []StreamChunk{
+		{ID: "resp_1", Model: "test-model", Role: "assistant"},
+		{ID: "resp_1", Model: "test-model", Content: "Hello"},
+		{ID: "resp_1", Model: "test-model", Content: " there"},
+		{ID: "resp_1", Model: "test-model", FinishReason: "length"},
+		{ID: "resp_1", Model: "test-model", Usage: &Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}},
+	}, openAI)
+	assert.Equal(t, openAI, anthropic)
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowServer blocks every request until the client goes away or done is closed
+func slowServer(done chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+}
+
+func TestCancelledContextAbortsProviderCall(t *testing.T) {
+	done := make(chan struct{})
+	server := slowServer(done)
+	defer server.Close()
+	defer close(done)
+
+	p := NewOpenAIProvider("test-key")
+	p.baseURL = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := p.ChatCompletion(ctx, &ChatRequest{Model: "gpt-4"})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWithTimeoutBoundsProviderCall(t *testing.T) {
+	done := make(chan struct{})
+	server := slowServer(done)
+	defer server.Close()
+	defer close(done)
+
+	p := NewAnthropicProvider("test-key", WithTimeout(50*time.Millisecond))
+	p.baseURL = server.URL
+
+	start := time.Now()
+	_, err := p.ChatCompletion(context.Background(), &ChatRequest{Model: "claude-3-haiku-20240307"})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	// Per-message framing overhead of the OpenAI chat format
+	tokensPerMessage = 3
+	// Every reply is primed with <|start|>assistant<|message|>
+	tokensPerReply = 3
+
+	// charsPerToken is the heuristic used for models without a public
+	// tokenizer, such as Claude
+	charsPerToken = 3.5
+)
+
+var (
+	encodings   = make(map[string]*tiktoken.Tiktoken)
+	encodingsMu sync.Mutex
+)
+
+func init() {
+	// Use the embedded BPE ranks instead of downloading them at runtime
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// CountTokens counts the prompt tokens of a list of messages for a model.
+// OpenAI models are counted exactly with their BPE encoding; other models
+// use a character-based heuristic.
+func CountTokens(model string, messages []Message) (int, error) {
+	if strings.HasPrefix(model, "claude-") {
+		return countTokensHeuristic(messages), nil
+	}
+
+	encoding, err := encodingForModel(model)
+	if err != nil {
+		return 0, err
+	}
+
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += tokensPerMessage
+		tokens += len(encoding.EncodeOrdinary(msg.Role))
+		tokens += len(encoding.EncodeOrdinary(msg.Content))
+	}
+	return tokens, nil
+}
+
+// CountTextTokens counts the tokens of a piece of text, such as a
+// completion, for a model. Like CountTokens, it is exact for OpenAI models
+// and a heuristic for others.
+func CountTextTokens(model, text string) (int, error) {
+	if strings.HasPrefix(model, "claude-") {
+		return int(math.Ceil(float64(len(text)) / charsPerToken)), nil
+	}
+
+	encoding, err := encodingForModel(model)
+	if err != nil {
+		return 0, err
+	}
+	return len(encoding.EncodeOrdinary(text)), nil
+}
+
+// countTokensHeuristic estimates tokens from the number of characters
+func countTokensHeuristic(messages []Message) int {
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += tokensPerMessage
+		tokens += int(math.Ceil(float64(len(msg.Role)+len(msg.Content)) / charsPerToken))
+	}
+	return tokens
+}
+
+// encodingForModel returns the cached BPE encoding of a model, defaulting
+// to cl100k_base for unknown models
+func encodingForModel(model string) (*tiktoken.Tiktoken, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if encoding, ok := encodings[model]; ok {
+		return encoding, nil
+	}
+
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding("cl100k_base")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load encoding: %w", err)
+		}
+	}
+
+	encodings[model] = encoding
+	return encoding, nil
+}
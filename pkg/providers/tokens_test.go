@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountTokensOpenAI(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "Hello world"},
+	}
+
+	// 3 (reply priming) + 3 (message framing) + 1 ("user") + 2 ("Hello world")
+	tokens, err := CountTokens("gpt-4", messages)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, tokens)
+}
+
+func TestCountTokensAnthropicHeuristic(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "Hello world"},
+	}
+
+	// 3 + 3 + ceil(15 / 3.5)
+	tokens, err := CountTokens("claude-3-haiku-20240307", messages)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, tokens)
+}
+
+func TestCountTextTokens(t *testing.T) {
+	tokens, err := CountTextTokens("gpt-4", "Hello world")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tokens)
+
+	// ceil(11 / 3.5)
+	tokens, err = CountTextTokens("claude-3-haiku-20240307", "Hello world")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, tokens)
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the connection pool of provider calls
+type TransportConfig struct {
+	// MaxIdleConnsPerHost is the number of keep-alive connections kept open
+	// to each provider host between requests. Go's default of 2 makes
+	// concurrent calls close and reopen connections, paying a TCP and TLS
+	// handshake each time.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost caps the connections to each host, idle or not; calls
+	// over the cap wait for a connection. Zero means no cap.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open
+	IdleConnTimeout time.Duration
+}
+
+// DefaultTransportConfig returns the pool settings used when none are
+// configured
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// NewTransport creates a transport pooling connections to provider hosts,
+// negotiating HTTP/2 with hosts that support it. Providers should share
+// one transport so they share its pool.
+func NewTransport(config TransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// The per-host limit bounds the pool; a global one would make providers
+	// compete for idle connections
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = config.MaxConnsPerHost
+	transport.IdleConnTimeout = config.IdleConnTimeout
+	transport.ForceAttemptHTTP2 = true
+	return transport
+}
+
+// defaultTransport is shared by providers created without WithTransport
+var defaultTransport = NewTransport(DefaultTransportConfig())
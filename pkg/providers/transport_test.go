@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingServer is a mock OpenAI server counting the connections opened
+// to it
+func countingServer() (*httptest.Server, *atomic.Int64) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	return server, &conns
+}
+
+// completeConcurrently sends rounds of concurrent chat completions
+func completeConcurrently(t testing.TB, p Provider, concurrency, rounds int) {
+	req := &ChatRequest{Model: "gpt-4", Messages: []Message{{Role: "user", Content: "Hello"}}}
+	for i := 0; i < rounds; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < concurrency; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := p.ChatCompletion(context.Background(), req)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+	server, conns := countingServer()
+	defer server.Close()
+
+	transport := NewTransport(DefaultTransportConfig())
+	defer transport.CloseIdleConnections()
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL), WithTransport(transport))
+
+	// Connections opened by the first round are kept for the later ones
+	completeConcurrently(t, p, 10, 5)
+	assert.LessOrEqual(t, conns.Load(), int64(10))
+}
+
+func TestNewTransportAppliesConfig(t *testing.T) {
+	transport := NewTransport(TransportConfig{MaxIdleConnsPerHost: 32, MaxConnsPerHost: 64, IdleConnTimeout: 0})
+	assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 64, transport.MaxConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+}
+
+// benchmarkTransport measures concurrent completions against a local mock
+// server, reporting the connections opened per call
+func benchmarkTransport(b *testing.B, transport *http.Transport) {
+	server, conns := countingServer()
+	defer server.Close()
+	defer transport.CloseIdleConnections()
+
+	p := NewOpenAIProvider("test-key", WithBaseURL(server.URL), WithTransport(transport))
+	b.ResetTimer()
+	completeConcurrently(b, p, 16, b.N)
+	b.ReportMetric(float64(conns.Load())/float64(16*b.N), "conns/op")
+}
+
+// BenchmarkUntunedTransport uses Go's default pool, which keeps two idle
+// connections per host
+func BenchmarkUntunedTransport(b *testing.B) {
+	benchmarkTransport(b, http.DefaultTransport.(*http.Transport).Clone())
+}
+
+func BenchmarkTunedTransport(b *testing.B) {
+	benchmarkTransport(b, NewTransport(DefaultTransportConfig()))
+}
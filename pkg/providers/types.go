@@ -1,18 +1,251 @@
 package providers
 
-// Message represents a chat message
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Message represents a chat message. Content may be sent as a string or as
+// an array of content parts; for the latter Parts holds the parts and
+// Content their concatenated text.
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string
+	Content string
+	Parts   []ContentPart
+
+	// ToolCalls holds the tools an assistant message calls
+	ToolCalls []ToolCall
+	// ToolCallID is the call a "tool" message holds the result of
+	ToolCallID string
+
+	// CacheControl asks the provider to cache the prompt up to and
+	// including this message. Only Anthropic supports it; it is not sent
+	// to OpenAI-format providers.
+	CacheControl *CacheControl
+}
+
+// CacheControl is a prompt caching hint, as in Anthropic's cache_control
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// Content part types
+const (
+	ContentPartText     = "text"
+	ContentPartImageURL = "image_url"
+)
+
+// ContentPart is one part of a multi-part message
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image by URL or as a base64 data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Tool is a function the model may call
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a callable function; Parameters is its JSON
+// schema
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a call of a tool by the model
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the called function and holds its arguments as a JSON
+// string
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// messageJSON is the wire format of a message
+type messageJSON struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw messageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = Message{Role: raw.Role, ToolCalls: raw.ToolCalls, ToolCallID: raw.ToolCallID, CacheControl: raw.CacheControl}
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Content, &m.Content); err == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw.Content, &m.Parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of content parts")
+	}
+	var text []string
+	for _, part := range m.Parts {
+		if part.Type == ContentPartText {
+			text = append(text, part.Text)
+		}
+	}
+	m.Content = strings.Join(text, "\n")
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. An assistant message that only
+// calls tools has null content. CacheControl is left out, since OpenAI
+// does not accept it.
+func (m Message) MarshalJSON() ([]byte, error) {
+	var content interface{} = m.Content
+	switch {
+	case m.Parts != nil:
+		content = m.Parts
+	case m.Content == "" && len(m.ToolCalls) > 0:
+		content = nil
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(messageJSON{Role: m.Role, Content: raw, ToolCalls: m.ToolCalls, ToolCallID: m.ToolCallID})
+}
+
+// parseDataURL splits a base64 data URL into its media type and data
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mediaType, ok = strings.CutSuffix(header, ";base64")
+	return mediaType, data, ok
 }
 
 // ChatRequest represents a chat completion request
 type ChatRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature,omitempty"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Stream      bool      `json:"stream,omitempty"`
+	Model            string         `json:"model"`
+	Messages         []Message      `json:"messages"`
+	Temperature      float64        `json:"temperature,omitempty"`
+	TopP             float64        `json:"top_p,omitempty"`
+	MaxTokens        int            `json:"max_tokens,omitempty"`
+	Stop             StopSequences  `json:"stop,omitempty"`
+	PresencePenalty  float64        `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64        `json:"frequency_penalty,omitempty"`
+	User             string         `json:"user,omitempty"`
+	Stream           bool           `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions `json:"stream_options,omitempty"`
+
+	// N is the number of choices to generate; zero means one
+	N int `json:"n,omitempty"`
+
+	// Tools the model may call. ToolChoice is "none", "auto", "required"
+	// or an object naming a function, kept as raw JSON.
+	Tools      []Tool          `json:"tools,omitempty"`
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+
+	// Logprobs asks for the log probability of each output token, and
+	// TopLogprobs for that many of the likeliest tokens at each position
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs int  `json:"top_logprobs,omitempty"`
+
+	// Seed asks for deterministic sampling, so repeated requests with the
+	// same seed and parameters return the same result where the provider
+	// supports it
+	Seed *int64 `json:"seed,omitempty"`
+
+	// TemperatureSet reports whether the request sent a temperature, so an
+	// explicit zero can be told apart from none
+	TemperatureSet bool `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	type plain ChatRequest
+	var raw struct {
+		plain
+		Temperature *float64 `json:"temperature"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = ChatRequest(raw.plain)
+	if raw.Temperature != nil {
+		r.Temperature, r.TemperatureSet = *raw.Temperature, true
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, sending an explicit zero
+// temperature rather than omitting it
+func (r ChatRequest) MarshalJSON() ([]byte, error) {
+	type plain ChatRequest
+	return json.Marshal(struct {
+		plain
+		Temperature *float64 `json:"temperature,omitempty"`
+	}{plain(r), r.temperature()})
+}
+
+// temperature returns the temperature to send, or nil if the request has
+// none so the provider's default applies
+func (r *ChatRequest) temperature() *float64 {
+	if !r.TemperatureSet && r.Temperature == 0 {
+		return nil
+	}
+	temperature := r.Temperature
+	return &temperature
+}
+
+// StreamOptions configures a streamed completion
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// StopSequences holds the sequences that end generation; it accepts either
+// a single string or an array of strings
+type StopSequences []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = many
+	return nil
 }
 
 // ChatResponse represents a chat completion response
@@ -23,13 +256,46 @@ type ChatResponse struct {
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   Usage    `json:"usage"`
+
+	// SystemFingerprint identifies the backend configuration that served
+	// the request; seeded results are only reproducible while it is the
+	// same
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// UpstreamRequestID is the ID the provider assigned to the request, for
+	// support tickets; it is not part of the response body
+	UpstreamRequestID string `json:"-"`
 }
 
 // Choice represents a single completion choice
 type Choice struct {
-	Index        int     `json:"index"`
-	Message      Message `json:"message"`
-	FinishReason string  `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Message      Message         `json:"message"`
+	FinishReason string          `json:"finish_reason"`
+	Logprobs     *ChoiceLogprobs `json:"logprobs,omitempty"`
+}
+
+// ChoiceLogprobs holds the log probabilities of a choice's output tokens,
+// returned when a request sets logprobs
+type ChoiceLogprobs struct {
+	Content []TokenLogprob `json:"content"`
+}
+
+// TokenLogprob is the log probability of an output token, along with the
+// likeliest tokens at its position when top_logprobs is set. Bytes is the
+// token's UTF-8 encoding, for tokens that split characters.
+type TokenLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes"`
+	TopLogprobs []TopLogprob `json:"top_logprobs"`
+}
+
+// TopLogprob is one of the likeliest tokens at a position
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes"`
 }
 
 // Usage represents token usage
@@ -37,11 +303,200 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// Prompt tokens written to and read from Anthropic's prompt cache.
+	// Both are included in PromptTokens.
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails breaks down the prompt tokens, as in OpenAI's usage
+type PromptTokensDetails struct {
+	// CachedTokens were read from the provider's prompt cache, which is
+	// billed at a discount
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CompletionTokensDetails breaks down the completion tokens, as in OpenAI's
+// usage
+type CompletionTokensDetails struct {
+	// ReasoningTokens were spent by a reasoning model before answering
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// CachedTokens returns the prompt tokens read from the prompt cache
+func (u Usage) CachedTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// ReasoningTokens returns the completion tokens spent on reasoning
+func (u Usage) ReasoningTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
+}
+
+// StreamChunk is a provider-agnostic piece of a streamed chat completion.
+// Providers translate their stream events into StreamChunks, which the
+// router relays to clients in OpenAI's chunk format.
+type StreamChunk struct {
+	ID           string
+	Model        string
+	Index        int
+	Role         string
+	Content      string
+	ToolCalls    []ToolCallDelta
+	FinishReason string
+
+	// Usage is set on a chunk of its own when the provider reports token
+	// counts; such a chunk carries no delta
+	Usage *Usage
+
+	// RequestID is set on a chunk of its own, sent first, when the provider
+	// reports the ID it assigned to the request; such a chunk carries no
+	// delta
+	RequestID string
+
+	// Err is set on the final chunk when the stream failed mid-way
+	Err error
+}
+
+// ChatStreamChunk represents a single chunk of a streamed chat completion in
+// OpenAI's format
+type ChatStreamChunk struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
+
+// StreamChoice represents a single choice within a stream chunk
+type StreamChoice struct {
+	Index        int    `json:"index"`
+	Delta        Delta  `json:"delta"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// Delta represents the incremental message content of a stream chunk
+type Delta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta is a piece of a streamed tool call. The first piece of a
+// call carries its ID, type and function name; the arguments arrive in
+// fragments to be concatenated. Index identifies the call within the
+// message.
+type ToolCallDelta struct {
+	Index    int               `json:"index"`
+	ID       string            `json:"id,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Function FunctionCallDelta `json:"function"`
+}
+
+// FunctionCallDelta is a piece of a streamed function call
+type FunctionCallDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// EmbeddingInput holds embedding inputs; it accepts either a single string
+// or an array of strings
+type EmbeddingInput []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (in *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*in = EmbeddingInput{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("input must be a string or an array of strings")
+	}
+	*in = many
+	return nil
+}
+
+// EmbeddingRequest represents an embeddings request
+type EmbeddingRequest struct {
+	Model string         `json:"model"`
+	Input EmbeddingInput `json:"input"`
+}
+
+// EmbeddingResponse represents an embeddings response
+type EmbeddingResponse struct {
+	Object string         `json:"object"`
+	Data   []Embedding    `json:"data"`
+	Model  string         `json:"model"`
+	Usage  EmbeddingUsage `json:"usage"`
+}
+
+// Embedding represents the vector of a single input
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// EmbeddingUsage represents token usage of an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ModelInfo describes a model served by a provider
+type ModelInfo struct {
+	ID            string            `json:"id"`
+	Object        string            `json:"object"`
+	OwnedBy       string            `json:"owned_by"`
+	ContextWindow int               `json:"context_window,omitempty"`
+	Capabilities  ModelCapabilities `json:"capabilities"`
+}
+
+// ModelCapabilities flags what a model can be used for
+type ModelCapabilities struct {
+	Chat       bool `json:"chat"`
+	Streaming  bool `json:"streaming"`
+	Embeddings bool `json:"embeddings"`
+	Vision     bool `json:"vision"`
 }
 
 // Provider is the interface all LLM providers must implement
 type Provider interface {
 	Name() string
-	ChatCompletion(req *ChatRequest) (*ChatResponse, error)
+	ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+	Models(ctx context.Context) ([]ModelInfo, error)
+	Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// HealthChecker is implemented by providers whose Models does not call
+// their API, to be probed with some other cheap request instead
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
 }
 
+// EndpointProvider is implemented by providers calling an HTTP API, to
+// report the base URL it is called at
+type EndpointProvider interface {
+	Provider
+	BaseURL() string
+}
+
+// StreamingProvider is implemented by providers that support streamed completions
+type StreamingProvider interface {
+	Provider
+	ChatCompletionStream(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, error)
+}
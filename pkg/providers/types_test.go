@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddingInputAcceptsStringOrArray(t *testing.T) {
+	var single EmbeddingRequest
+	err := json.Unmarshal([]byte(`{"model":"text-embedding-3-small","input":"hello"}`), &single)
+	assert.NoError(t, err)
+	assert.Equal(t, EmbeddingInput{"hello"}, single.Input)
+
+	var many EmbeddingRequest
+	err = json.Unmarshal([]byte(`{"model":"text-embedding-3-small","input":["a","b"]}`), &many)
+	assert.NoError(t, err)
+	assert.Equal(t, EmbeddingInput{"a", "b"}, many.Input)
+
+	var invalid EmbeddingRequest
+	err = json.Unmarshal([]byte(`{"model":"text-embedding-3-small","input":42}`), &invalid)
+	assert.Error(t, err)
+}
+
+func TestStopAcceptsStringOrArray(t *testing.T) {
+	var single ChatRequest
+	err := json.Unmarshal([]byte(`{"model":"gpt-4","stop":"END"}`), &single)
+	assert.NoError(t, err)
+	assert.Equal(t, StopSequences{"END"}, single.Stop)
+
+	var many ChatRequest
+	err = json.Unmarshal([]byte(`{"model":"gpt-4","stop":["END","\n\n"]}`), &many)
+	assert.NoError(t, err)
+	assert.Equal(t, StopSequences{"END", "\n\n"}, many.Stop)
+
+	var invalid ChatRequest
+	err = json.Unmarshal([]byte(`{"model":"gpt-4","stop":42}`), &invalid)
+	assert.Error(t, err)
+}
+
+func TestChatRequestNotesExplicitTemperature(t *testing.T) {
+	var unset ChatRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`), &unset))
+	assert.False(t, unset.TemperatureSet)
+	assert.Equal(t, "Hi", unset.Messages[0].Content)
+
+	var zero ChatRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"model":"gpt-4","temperature":0}`), &zero))
+	assert.True(t, zero.TemperatureSet)
+	assert.Equal(t, 0.0, zero.Temperature)
+
+	// The explicit zero is sent on, and no temperature stays omitted
+	body, err := json.Marshal(zero)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"model":"gpt-4","messages":null,"temperature":0}`, string(body))
+
+	body, err = json.Marshal(unset)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "temperature")
+}
+
+func TestMessageContentRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+	}{
+		{"string", `{"role":"user","content":"Hello"}`},
+		{"tool calls", `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}`},
+		{"tool result", `{"role":"tool","content":"Sunny","tool_call_id":"call_1"}`},
+		{"parts", `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}}]}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var msg Message
+			assert.NoError(t, json.Unmarshal([]byte(tc.json), &msg))
+
+			data, err := json.Marshal(msg)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.json, string(data))
+		})
+	}
+}
+
+func TestMessagePartsText(t *testing.T) {
+	var msg Message
+	err := json.Unmarshal([]byte(`{"role":"user","content":[{"type":"text","text":"a"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},{"type":"text","text":"b"}]}`), &msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb", msg.Content)
+	assert.Len(t, msg.Parts, 3)
+	assert.Equal(t, "data:image/png;base64,AAAA", msg.Parts[1].ImageURL.URL)
+
+	var invalid Message
+	err = json.Unmarshal([]byte(`{"role":"user","content":42}`), &invalid)
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Limiter decides whether a user's request may proceed. RateLimiter (token
+// bucket) and SlidingWindowLimiter implement it.
+type Limiter interface {
+	// Allow checks if a request from user is allowed and consumes tokens
+	Allow(userID string, tokens int64) bool
+	// AllowModel checks if a request from user for a model is allowed and
+	// consumes tokens from that user/model pair's limit
+	AllowModel(userID, model string, tokens int64) bool
+	// Stats returns the current limit state of a user
+	Stats(userID string) map[string]interface{}
+}
+
+// Priority is the lane a request is limited in. Batch requests may only
+// use the part of a limit above a reserve kept for interactive requests, so
+// bulk traffic can't starve interactive traffic from the same user.
+type Priority int
+
+// Priorities, from highest to lowest
+const (
+	PriorityInteractive Priority = iota
+	PriorityBatch
+)
+
+// ParsePriority parses a priority name, "interactive" or "batch". An empty
+// name is interactive.
+func ParsePriority(name string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "interactive":
+		return PriorityInteractive, nil
+	case "batch":
+		return PriorityBatch, nil
+	}
+	return PriorityInteractive, fmt.Errorf("unknown priority %q, expected interactive or batch", name)
+}
+
+// PriorityLimiter is implemented by limiters with priority lanes
+type PriorityLimiter interface {
+	// AllowWithPriority is Allow in the given lane
+	AllowWithPriority(userID string, tokens int64, priority Priority) bool
+	// AllowModelWithPriority is AllowModel in the given lane
+	AllowModelWithPriority(userID, model string, tokens int64, priority Priority) bool
+}
+
+// reserved returns the part of capacity kept for interactive requests from
+// requests of priority
+func reserved(capacity int64, reserve float64, priority Priority) int64 {
+	if priority != PriorityBatch {
+		return 0
+	}
+	return int64(math.Ceil(float64(capacity) * reserve))
+}
+
+// Thresholds are the soft and hard limits of a user. Hard replaces the
+// limiter's default limit. Requests taking the usage beyond Soft are still
+// allowed, but flagged so the user can be warned. RefillRate replaces the
+// rate token buckets refill at, which otherwise scales with Hard; sliding
+// windows ignore it. Zero keeps the defaults.
+type Thresholds struct {
+	Soft       int64
+	Hard       int64
+	RefillRate float64
+}
+
+// Decision is how a request stands against a limit
+type Decision struct {
+	// Allowed reports whether the request was allowed and charged
+	Allowed bool
+	// Remaining is what is left of the hard limit after the request, or
+	// how far the request would have gone over it if negative
+	Remaining int64
+	// Limit is the hard limit
+	Limit int64
+	// SoftExceeded reports whether an allowed request took the usage
+	// beyond the soft limit
+	SoftExceeded bool
+}
+
+// Decider is implemented by limiters with soft limits, reporting how a
+// request stands against them rather than only whether it is allowed
+type Decider interface {
+	// DecideModel is AllowModelWithPriority, reporting the decision
+	DecideModel(userID, model string, tokens int64, priority Priority) Decision
+	// SetThresholds sets the default soft limit, zero disabling it, and
+	// replaces the thresholds of individual users
+	SetThresholds(defaultSoft int64, users map[string]Thresholds)
+}
+
+// decision returns the decision on a request leaving remaining of limit,
+// which was allowed if at least floor remains, given the soft limit
+func decision(remaining, limit, floor, soft int64) Decision {
+	allowed := remaining >= floor
+	return Decision{
+		Allowed:      allowed,
+		Remaining:    remaining,
+		Limit:        limit,
+		SoftExceeded: allowed && soft > 0 && limit-remaining > soft,
+	}
+}
+
+// Waiter is implemented by limiters that can block until a request is
+// allowed rather than rejecting it
+type Waiter interface {
+	// Wait blocks until a request from user is allowed and consumes tokens.
+	// It fails if the context ends first, or early if the wait would
+	// outlast the context's deadline.
+	Wait(ctx context.Context, userID string, tokens int64) error
+	// WaitModel is Wait against the user/model pair's limit, in the given
+	// priority lane, reporting the decision once allowed
+	WaitModel(ctx context.Context, userID, model string, tokens int64, priority Priority) (Decision, error)
+}
+
+// Adjuster is implemented by limiters whose charge for a request can be
+// corrected once its actual cost is known
+type Adjuster interface {
+	// AdjustModel consumes delta more tokens from the user/model pair's
+	// limit, or gives -delta tokens back if delta is negative. It never
+	// rejects: a limit charged beyond what remains goes into debt, which
+	// delays the user's later requests.
+	AdjustModel(userID, model string, delta int64)
+}
+
+// Resetter is implemented by limiters whose state of a user can be cleared
+type Resetter interface {
+	// Reset restores every limit of user, including per-model limits, to
+	// full capacity
+	Reset(userID string)
+}
+
+var (
+	_ Limiter = (*RateLimiter)(nil)
+	_ Limiter = (*SlidingWindowLimiter)(nil)
+	_ Waiter  = (*RateLimiter)(nil)
+
+	_ PriorityLimiter = (*RateLimiter)(nil)
+	_ PriorityLimiter = (*SlidingWindowLimiter)(nil)
+
+	_ Resetter = (*RateLimiter)(nil)
+	_ Resetter = (*SlidingWindowLimiter)(nil)
+
+	_ Decider = (*RateLimiter)(nil)
+	_ Decider = (*SlidingWindowLimiter)(nil)
+)
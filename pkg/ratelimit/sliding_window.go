@@ -0,0 +1,230 @@
+package ratelimit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slidingWindow counts tokens in the current and previous fixed windows
+type slidingWindow struct {
+	start    time.Time
+	current  int64
+	previous int64
+}
+
+// SlidingWindowLimiter limits each user to a number of tokens per rolling
+// window. Unlike the token bucket, it never allows a burst above the limit
+// within any window-sized span.
+//
+// It uses the two-window approximation: the count of the previous fixed
+// window is weighted by how much of it still overlaps the rolling window.
+type SlidingWindowLimiter struct {
+	limit   int64
+	window  time.Duration
+	windows map[string]*slidingWindow
+	mu      sync.Mutex
+
+	// Fraction of the limit batch requests can't use
+	batchReserve float64
+
+	// Soft limits, and per-user soft and hard limits
+	defaultSoft int64
+	thresholds  map[string]Thresholds
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// NewSlidingWindowLimiter creates a new sliding window limiter
+//
+// limit: Maximum number of tokens per window
+// window: Length of the rolling window
+func NewSlidingWindowLimiter(limit int64, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		limit:      limit,
+		window:     window,
+		windows:    make(map[string]*slidingWindow),
+		thresholds: make(map[string]Thresholds),
+		now:        time.Now,
+	}
+}
+
+// SetLimit changes the limit and window length. Tokens already counted in
+// the current windows count against the new limit.
+func (sl *SlidingWindowLimiter) SetLimit(limit int64, window time.Duration) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.limit = limit
+	sl.window = window
+}
+
+// SetBatchReserve keeps fraction of the limit for interactive requests;
+// batch requests are rejected once only the reserve is left
+func (sl *SlidingWindowLimiter) SetBatchReserve(fraction float64) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.batchReserve = fraction
+}
+
+// SetThresholds sets the default soft limit, zero disabling it, and
+// replaces the soft and hard limits of individual users. A user's hard
+// limit replaces the limit per window.
+func (sl *SlidingWindowLimiter) SetThresholds(defaultSoft int64, users map[string]Thresholds) {
+	thresholds := make(map[string]Thresholds, len(users))
+	for userID, t := range users {
+		thresholds[userID] = t
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.defaultSoft = defaultSoft
+	sl.thresholds = thresholds
+}
+
+// Reset forgets the counts of a user and of each user/model pair of the
+// user
+func (sl *SlidingWindowLimiter) Reset(userID string) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	for key := range sl.windows {
+		if key == userID || strings.HasPrefix(key, userID+":") {
+			delete(sl.windows, key)
+		}
+	}
+}
+
+// Allow checks if request from user is allowed
+func (sl *SlidingWindowLimiter) Allow(userID string, tokens int64) bool {
+	return sl.decide(userID, userID, tokens, PriorityInteractive).Allowed
+}
+
+// AllowModel checks if a request from user for a model is allowed. Each
+// user/model pair is counted separately.
+func (sl *SlidingWindowLimiter) AllowModel(userID, model string, tokens int64) bool {
+	return sl.decide(userID, userID+":"+model, tokens, PriorityInteractive).Allowed
+}
+
+// AllowWithPriority checks if request from user is allowed in a priority
+// lane
+func (sl *SlidingWindowLimiter) AllowWithPriority(userID string, tokens int64, priority Priority) bool {
+	return sl.decide(userID, userID, tokens, priority).Allowed
+}
+
+// AllowModelWithPriority checks if a request from user for a model is
+// allowed in a priority lane
+func (sl *SlidingWindowLimiter) AllowModelWithPriority(userID, model string, tokens int64, priority Priority) bool {
+	return sl.decide(userID, userID+":"+model, tokens, priority).Allowed
+}
+
+// DecideModel checks if a request from user for a model is allowed in a
+// priority lane, and whether it goes beyond the user's soft limit
+func (sl *SlidingWindowLimiter) DecideModel(userID, model string, tokens int64, priority Priority) Decision {
+	return sl.decide(userID, userID+":"+model, tokens, priority)
+}
+
+// AdjustModel corrects the count of a user/model pair's current window; see
+// Adjuster. The count never goes below zero.
+func (sl *SlidingWindowLimiter) AdjustModel(userID, model string, delta int64) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	key := userID + ":" + model
+	sl.estimate(key, sl.now())
+	sl.windows[key].current = max(sl.windows[key].current+delta, 0)
+}
+
+// Stats returns stats for a user: the user's limit, the tokens available
+// in the user's most used window, and the available tokens of each of the
+// user's model windows. A user without windows is reported as unused; none
+// are created.
+func (sl *SlidingWindowLimiter) Stats(userID string) map[string]interface{} {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	limit, soft := sl.userLimits(userID)
+	available := limit
+	models := make(map[string]map[string]int64)
+	now := sl.now()
+	for key := range sl.windows {
+		model, scoped := strings.CutPrefix(key, userID+":")
+		if key != userID && !scoped {
+			continue
+		}
+		windowAvailable := max(limit-int64(math.Ceil(sl.estimate(key, now))), 0)
+		available = min(available, windowAvailable)
+		if scoped {
+			models[model] = map[string]int64{"available": windowAvailable, "capacity": limit}
+		}
+	}
+	stats := map[string]interface{}{
+		"available": available,
+		"capacity":  limit,
+	}
+	if len(models) > 0 {
+		stats["models"] = models
+	}
+	if soft > 0 {
+		stats["soft_limit"] = soft
+	}
+	return stats
+}
+
+// decide consumes tokens from the window of key, counting against the
+// limits of userID, if the estimated count of the rolling window stays
+// within the limit, less the reserve of priority
+func (sl *SlidingWindowLimiter) decide(userID, key string, tokens int64, priority Priority) Decision {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	limit, soft := sl.userLimits(userID)
+	count := sl.estimate(key, sl.now()) + float64(tokens)
+	d := decision(limit-int64(math.Ceil(count)), limit, reserved(limit, sl.batchReserve, priority), soft)
+	if d.Allowed {
+		sl.windows[key].current += tokens
+	}
+	return d
+}
+
+// userLimits returns the hard and soft limits of a user. Must be called
+// with sl.mu held.
+func (sl *SlidingWindowLimiter) userLimits(userID string) (int64, int64) {
+	t := sl.thresholds[userID]
+	limit, soft := sl.limit, sl.defaultSoft
+	if t.Hard > 0 {
+		limit = t.Hard
+	}
+	if t.Soft > 0 {
+		soft = t.Soft
+	}
+	return limit, soft
+}
+
+// estimate advances the window of key to now and returns the estimated
+// count of the rolling window. Must be called with sl.mu held.
+func (sl *SlidingWindowLimiter) estimate(key string, now time.Time) float64 {
+	start := now.Truncate(sl.window)
+
+	w, exists := sl.windows[key]
+	if !exists {
+		w = &slidingWindow{start: start}
+		sl.windows[key] = w
+	}
+
+	// Advance to the current fixed window
+	if elapsed := start.Sub(w.start); elapsed > 0 {
+		if elapsed == sl.window {
+			w.previous = w.current
+		} else {
+			w.previous = 0
+		}
+		w.current = 0
+		w.start = start
+	}
+
+	// Weight the previous window by its overlap with the rolling window
+	overlap := 1 - float64(now.Sub(start))/float64(sl.window)
+	return float64(w.previous)*overlap + float64(w.current)
+}
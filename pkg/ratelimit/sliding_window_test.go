@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowWeightsPreviousWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	sl := NewSlidingWindowLimiter(10, time.Minute)
+	sl.now = func() time.Time { return now }
+
+	// Use the whole limit at the very end of the first window
+	now = now.Add(59 * time.Second)
+	for i := 0; i < 10; i++ {
+		assert.True(t, sl.Allow("user", 1))
+	}
+	assert.False(t, sl.Allow("user", 1))
+
+	// Just past the boundary, the previous window still counts almost fully
+	now = now.Add(2 * time.Second)
+	assert.False(t, sl.Allow("user", 1))
+
+	// Halfway through, half of the previous window's count remains
+	now = time.Unix(90, 0)
+	for i := 0; i < 5; i++ {
+		assert.True(t, sl.Allow("user", 1))
+	}
+	assert.False(t, sl.Allow("user", 1))
+
+	// Two windows later, nothing remains
+	now = time.Unix(180, 0)
+	assert.True(t, sl.Allow("user", 10))
+}
+
+func TestBurstTokenBucketVersusSlidingWindow(t *testing.T) {
+	// Both allow 5 requests up front
+	bucket := NewRateLimiter(5, 50)
+	window := NewSlidingWindowLimiter(5, time.Second)
+	for i := 0; i < 5; i++ {
+		assert.True(t, bucket.Allow("user", 1))
+		assert.True(t, window.Allow("user", 1))
+	}
+
+	// The token bucket refills continuously and allows more traffic within
+	// the same second; the sliding window holds the line
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, bucket.Allow("user", 1))
+	assert.False(t, window.Allow("user", 1))
+}
+
+func TestSlidingWindowStats(t *testing.T) {
+	sl := NewSlidingWindowLimiter(10, time.Minute)
+	sl.Allow("user", 3)
+
+	stats := sl.Stats("user")
+	assert.Equal(t, int64(7), stats["available"])
+	assert.Equal(t, int64(10), stats["capacity"])
+}
+
+func TestSlidingWindowStatsReportModelWindows(t *testing.T) {
+	sl := NewSlidingWindowLimiter(10, time.Minute)
+	assert.Equal(t, int64(10), sl.Stats("user")["available"])
+	assert.Empty(t, sl.windows)
+
+	sl.AllowModel("user", "gpt-4", 6)
+	sl.AllowModel("user", "claude-3-haiku", 2)
+	sl.AllowModel("user-2", "gpt-4", 9)
+	stats := sl.Stats("user")
+	assert.Equal(t, int64(4), stats["available"])
+	assert.Equal(t, map[string]map[string]int64{
+		"gpt-4":          {"available": 4, "capacity": 10},
+		"claude-3-haiku": {"available": 8, "capacity": 10},
+	}, stats["models"])
+	assert.Len(t, sl.windows, 3)
+}
+
+func TestSlidingWindowBatchReserve(t *testing.T) {
+	sl := NewSlidingWindowLimiter(10, time.Minute)
+	sl.SetBatchReserve(0.5)
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, sl.AllowWithPriority("user", 1, PriorityBatch))
+	}
+	assert.False(t, sl.AllowWithPriority("user", 1, PriorityBatch))
+	assert.True(t, sl.AllowWithPriority("user", 5, PriorityInteractive))
+}
+
+func TestSlidingWindowReset(t *testing.T) {
+	sl := NewSlidingWindowLimiter(1, time.Minute)
+	assert.True(t, sl.Allow("user", 1))
+	assert.True(t, sl.AllowModel("user", "gpt-4", 1))
+	assert.True(t, sl.Allow("other", 1))
+
+	sl.Reset("user")
+
+	assert.True(t, sl.Allow("user", 1))
+	assert.True(t, sl.AllowModel("user", "gpt-4", 1))
+	assert.False(t, sl.Allow("other", 1))
+}
+
+func TestSlidingWindowAdjustModel(t *testing.T) {
+	sl := NewSlidingWindowLimiter(100, time.Minute)
+	sl.now = func() time.Time { return time.Unix(0, 0) }
+	assert.True(t, sl.AllowModel("user", "gpt-4", 10))
+
+	sl.AdjustModel("user", "gpt-4", 85)
+	assert.True(t, sl.AllowModel("user", "gpt-4", 5))
+	assert.False(t, sl.AllowModel("user", "gpt-4", 1))
+
+	// Refunds never take the count below zero
+	sl.AdjustModel("user", "gpt-4", -500)
+	assert.True(t, sl.AllowModel("user", "gpt-4", 100))
+}
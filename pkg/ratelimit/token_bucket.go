@@ -1,17 +1,27 @@
 package ratelimit
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
 )
 
+// ErrWaitExceeded is returned by Wait when the tokens would not be
+// available before the context's deadline
+var ErrWaitExceeded = errors.New("rate limit wait would exceed deadline")
+
 // TokenBucket implements token bucket rate limiting algorithm
 type TokenBucket struct {
 	capacity   int64
 	tokens     int64
 	refillRate float64
 	lastRefill time.Time
+	lastAccess time.Time
 	mu         sync.Mutex
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
 }
 
 // NewTokenBucket creates a new token bucket rate limiter
@@ -19,11 +29,19 @@ type TokenBucket struct {
 // capacity: Maximum number of tokens
 // refillRate: Tokens added per second
 func NewTokenBucket(capacity int64, refillRate float64) *TokenBucket {
+	return newTokenBucket(capacity, refillRate, time.Now)
+}
+
+// newTokenBucket creates a token bucket reading the time from now
+func newTokenBucket(capacity int64, refillRate float64, now func() time.Time) *TokenBucket {
+	start := now()
 	return &TokenBucket{
 		capacity:   capacity,
 		tokens:     capacity,
 		refillRate: refillRate,
-		lastRefill: time.Now(),
+		lastRefill: start,
+		lastAccess: start,
+		now:        now,
 	}
 }
 
@@ -32,24 +50,94 @@ func NewTokenBucket(capacity int64, refillRate float64) *TokenBucket {
 // tokens: Number of tokens to consume
 // Returns true if allowed, false if rate limit exceeded
 func (tb *TokenBucket) Allow(tokens int64) bool {
+	return tb.allow(tokens, 0, PriorityInteractive)
+}
+
+// allow consumes tokens if at least the reserve of priority remains
+// afterwards
+func (tb *TokenBucket) allow(tokens int64, reserve float64, priority Priority) bool {
+	return tb.decide(tokens, reserve, priority, 0).Allowed
+}
+
+// decide is allow reporting the decision against the soft limit
+func (tb *TokenBucket) decide(tokens int64, reserve float64, priority Priority, soft int64) Decision {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
+	tb.lastAccess = tb.now()
+
 	// Refill tokens based on elapsed time
 	tb.refill()
 
 	// Check if enough tokens available
-	if tb.tokens >= tokens {
+	d := decision(tb.tokens-tokens, tb.capacity, reserved(tb.capacity, reserve, priority), soft)
+	if d.Allowed {
 		tb.tokens -= tokens
-		return true
 	}
+	return d
+}
 
-	return false
+// Wait blocks until tokens are available and consumes them. It returns
+// ErrWaitExceeded without waiting if the tokens would not refill before the
+// context's deadline, and the context's error if it is cancelled first.
+func (tb *TokenBucket) Wait(ctx context.Context, tokens int64) error {
+	_, err := tb.wait(ctx, tokens, 0, PriorityInteractive, 0)
+	return err
+}
+
+// wait is Wait keeping the reserve of priority, reporting the decision
+// against the soft limit once allowed
+func (tb *TokenBucket) wait(ctx context.Context, tokens int64, reserve float64, priority Priority, soft int64) (Decision, error) {
+	for {
+		tb.mu.Lock()
+		tb.lastAccess = tb.now()
+		tb.refill()
+		floor := reserved(tb.capacity, reserve, priority)
+		if d := decision(tb.tokens-tokens, tb.capacity, floor, soft); d.Allowed {
+			tb.tokens -= tokens
+			tb.mu.Unlock()
+			return d, nil
+		}
+		if tokens+floor > tb.capacity || tb.refillRate <= 0 {
+			tb.mu.Unlock()
+			return Decision{}, ErrWaitExceeded
+		}
+
+		// Tokens accrue continuously from lastRefill, even though refill
+		// only adds whole tokens
+		needed := float64(tokens + floor - tb.tokens)
+		refilled := time.Duration(needed / tb.refillRate * float64(time.Second))
+		delay := tb.lastRefill.Add(refilled).Sub(tb.now())
+		tb.mu.Unlock()
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return Decision{}, ErrWaitExceeded
+		}
+
+		timer := time.NewTimer(max(delay, time.Millisecond))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return Decision{}, ctx.Err()
+		}
+	}
+}
+
+// adjust consumes delta more tokens, or returns -delta tokens if negative.
+// Tokens may go negative but never above the capacity.
+func (tb *TokenBucket) adjust(delta int64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.lastAccess = tb.now()
+	tb.refill()
+	tb.tokens = min(tb.tokens-delta, tb.capacity)
 }
 
 // refill adds tokens based on elapsed time
 func (tb *TokenBucket) refill() {
-	now := time.Now()
+	now := tb.now()
 	elapsed := now.Sub(tb.lastRefill).Seconds()
 
 	// Calculate tokens to add
@@ -72,35 +160,298 @@ func (tb *TokenBucket) Available() int64 {
 	return tb.tokens
 }
 
+// Capacity returns the maximum number of tokens
+func (tb *TokenBucket) Capacity() int64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.capacity
+}
+
+// setLimit changes the capacity and refill rate. Tokens above the new
+// capacity are dropped.
+func (tb *TokenBucket) setLimit(capacity int64, refillRate float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	tb.capacity = capacity
+	tb.refillRate = refillRate
+	if tb.tokens > capacity {
+		tb.tokens = capacity
+	}
+}
+
+// idle reports whether the bucket is full and hasn't been used for ttl
+func (tb *TokenBucket) idle(ttl time.Duration) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	return tb.tokens >= tb.capacity && tb.now().Sub(tb.lastAccess) >= ttl
+}
+
+// limit holds the capacity and refill rate of a bucket
+type limit struct {
+	capacity   int64
+	refillRate float64
+}
+
+// bucketKey identifies the bucket of a user, optionally scoped to a model
+type bucketKey struct {
+	user  string
+	model string
+}
+
 // RateLimiter manages rate limits for multiple users
 type RateLimiter struct {
-	buckets map[string]*TokenBucket
+	buckets map[bucketKey]*TokenBucket
 	mu      sync.RWMutex
 
 	// Default limits
 	defaultCapacity   int64
 	defaultRefillRate float64
+
+	// Per-model limit overrides
+	modelLimits map[string]limit
+
+	// Soft limits, and per-user soft and hard limits and refill rates
+	defaultSoft int64
+	thresholds  map[string]Thresholds
+
+	// Fraction of each bucket batch requests can't use
+	batchReserve float64
+
+	// Stops the eviction sweeper
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(capacity int64, refillRate float64) *RateLimiter {
 	return &RateLimiter{
-		buckets:           make(map[string]*TokenBucket),
+		buckets:           make(map[bucketKey]*TokenBucket),
 		defaultCapacity:   capacity,
 		defaultRefillRate: refillRate,
+		modelLimits:       make(map[string]limit),
+		thresholds:        make(map[string]Thresholds),
+		stop:              make(chan struct{}),
+		now:               time.Now,
 	}
 }
 
+// StartEviction starts a background sweeper that runs every interval and
+// removes buckets that are full and unused for longer than idleTTL, so
+// memory stays bounded with many distinct users. A removed bucket is
+// recreated full on the user's next request, so eviction never changes
+// rate limiting decisions. Call Close to stop the sweeper.
+func (rl *RateLimiter) StartEviction(interval, idleTTL time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				rl.evictIdle(idleTTL)
+			case <-rl.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the eviction sweeper
+func (rl *RateLimiter) Close() {
+	rl.stopOnce.Do(func() {
+		close(rl.stop)
+	})
+}
+
+// evictIdle removes buckets idle for at least idleTTL
+func (rl *RateLimiter) evictIdle(idleTTL time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, bucket := range rl.buckets {
+		if bucket.idle(idleTTL) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Reset deletes the buckets of a user; they are recreated full on the
+// user's next request
+func (rl *RateLimiter) Reset(userID string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key := range rl.buckets {
+		if key.user == userID {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// SetDefaultLimit changes the default limits. Existing buckets without a
+// model override switch to the new limits immediately.
+func (rl *RateLimiter) SetDefaultLimit(capacity int64, refillRate float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.defaultCapacity = capacity
+	rl.defaultRefillRate = refillRate
+	rl.applyLimits()
+}
+
+// SetThresholds sets the default soft limit, zero disabling it, and
+// replaces the limits of individual users. A user's hard limit replaces the
+// default capacity, with the refill rate scaled to match, so the bucket
+// takes as long to refill, unless the user has a refill rate of their own.
+// Existing buckets without a model override switch to the new limits
+// immediately.
+func (rl *RateLimiter) SetThresholds(defaultSoft int64, users map[string]Thresholds) {
+	thresholds := make(map[string]Thresholds, len(users))
+	for userID, t := range users {
+		thresholds[userID] = t
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.defaultSoft = defaultSoft
+	rl.thresholds = thresholds
+	rl.applyLimits()
+}
+
+// SetUserLimit provisions the capacity and refill rate of a user, such as
+// an enterprise customer with more headroom than the defaults, keeping the
+// user's soft limit. The user's existing buckets without a model override
+// are resized immediately. Zero keeps the default.
+func (rl *RateLimiter) SetUserLimit(userID string, capacity int64, refillRate float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	t := rl.thresholds[userID]
+	t.Hard, t.RefillRate = capacity, refillRate
+	rl.thresholds[userID] = t
+	rl.applyLimits()
+}
+
+// applyLimits sets the limits of existing buckets without a model override
+// to those of their users. Must be called with rl.mu held.
+func (rl *RateLimiter) applyLimits() {
+	for key, bucket := range rl.buckets {
+		if _, overridden := rl.modelLimits[key.model]; key.model == "" || !overridden {
+			l := rl.userLimit(key.user)
+			bucket.setLimit(l.capacity, l.refillRate)
+		}
+	}
+}
+
+// userLimit returns the limits of a user's buckets without a model
+// override. Must be called with rl.mu held.
+func (rl *RateLimiter) userLimit(userID string) limit {
+	t := rl.thresholds[userID]
+	l := limit{capacity: rl.defaultCapacity, refillRate: rl.defaultRefillRate}
+	if t.Hard > 0 {
+		l.capacity = t.Hard
+		if rl.defaultCapacity > 0 {
+			l.refillRate = rl.defaultRefillRate * float64(t.Hard) / float64(rl.defaultCapacity)
+		}
+	}
+	if t.RefillRate > 0 {
+		l.refillRate = t.RefillRate
+	}
+	return l
+}
+
+// softLimit returns the soft limit of a user, zero if there is none
+func (rl *RateLimiter) softLimit(userID string) int64 {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	if soft := rl.thresholds[userID].Soft; soft > 0 {
+		return soft
+	}
+	return rl.defaultSoft
+}
+
+// SetBatchReserve keeps fraction of every bucket's capacity for
+// interactive requests; batch requests are rejected once only the reserve
+// is left
+func (rl *RateLimiter) SetBatchReserve(fraction float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.batchReserve = fraction
+}
+
+// SetModelLimit overrides the default limits for a model. Only buckets
+// created after the call pick up the new limit.
+func (rl *RateLimiter) SetModelLimit(model string, capacity int64, refillRate float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.modelLimits[model] = limit{capacity: capacity, refillRate: refillRate}
+}
+
 // Allow checks if request from user is allowed
 func (rl *RateLimiter) Allow(userID string, tokens int64) bool {
-	bucket := rl.getBucket(userID)
+	bucket := rl.getBucket(userID, "")
 	return bucket.Allow(tokens)
 }
 
-// getBucket gets or creates a bucket for a user
-func (rl *RateLimiter) getBucket(userID string) *TokenBucket {
+// AllowModel checks if a request from user for a model is allowed. Each
+// user/model pair has its own bucket, using the model's limit if one is set
+// and the default limits otherwise.
+func (rl *RateLimiter) AllowModel(userID, model string, tokens int64) bool {
+	bucket := rl.getBucket(userID, model)
+	return bucket.Allow(tokens)
+}
+
+// AllowWithPriority checks if request from user is allowed in a priority
+// lane
+func (rl *RateLimiter) AllowWithPriority(userID string, tokens int64, priority Priority) bool {
+	return rl.getBucket(userID, "").allow(tokens, rl.reserve(), priority)
+}
+
+// AllowModelWithPriority checks if a request from user for a model is
+// allowed in a priority lane
+func (rl *RateLimiter) AllowModelWithPriority(userID, model string, tokens int64, priority Priority) bool {
+	return rl.getBucket(userID, model).allow(tokens, rl.reserve(), priority)
+}
+
+// Wait blocks until request from user is allowed; see TokenBucket.Wait
+func (rl *RateLimiter) Wait(ctx context.Context, userID string, tokens int64) error {
+	return rl.getBucket(userID, "").Wait(ctx, tokens)
+}
+
+// WaitModel blocks until a request from user for a model is allowed in a
+// priority lane
+func (rl *RateLimiter) WaitModel(ctx context.Context, userID, model string, tokens int64, priority Priority) (Decision, error) {
+	return rl.getBucket(userID, model).wait(ctx, tokens, rl.reserve(), priority, rl.softLimit(userID))
+}
+
+// DecideModel checks if a request from user for a model is allowed in a
+// priority lane, and whether it goes beyond the user's soft limit
+func (rl *RateLimiter) DecideModel(userID, model string, tokens int64, priority Priority) Decision {
+	return rl.getBucket(userID, model).decide(tokens, rl.reserve(), priority, rl.softLimit(userID))
+}
+
+// AdjustModel corrects the charge of a user/model pair's bucket; see
+// Adjuster
+func (rl *RateLimiter) AdjustModel(userID, model string, delta int64) {
+	rl.getBucket(userID, model).adjust(delta)
+}
+
+// reserve returns the batch reserve fraction
+func (rl *RateLimiter) reserve() float64 {
 	rl.mu.RLock()
-	bucket, exists := rl.buckets[userID]
+	defer rl.mu.RUnlock()
+	return rl.batchReserve
+}
+
+// getBucket gets or creates a bucket for a user, optionally scoped to a model
+func (rl *RateLimiter) getBucket(userID, model string) *TokenBucket {
+	key := bucketKey{user: userID, model: model}
+
+	rl.mu.RLock()
+	bucket, exists := rl.buckets[key]
 	rl.mu.RUnlock()
 
 	if exists {
@@ -112,21 +463,50 @@ func (rl *RateLimiter) getBucket(userID string) *TokenBucket {
 	defer rl.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if bucket, exists := rl.buckets[userID]; exists {
+	if bucket, exists := rl.buckets[key]; exists {
 		return bucket
 	}
 
-	bucket = NewTokenBucket(rl.defaultCapacity, rl.defaultRefillRate)
-	rl.buckets[userID] = bucket
+	l := rl.userLimit(userID)
+	if override, ok := rl.modelLimits[model]; ok && model != "" {
+		l = override
+	}
+
+	bucket = newTokenBucket(l.capacity, l.refillRate, rl.now)
+	rl.buckets[key] = bucket
 	return bucket
 }
 
-// Stats returns stats for a user
+// Stats returns stats for a user: the user's capacity, the tokens
+// available in the user's most depleted bucket, and the available tokens
+// and capacity of each of the user's model buckets. A user without
+// buckets is reported as full; none are created.
 func (rl *RateLimiter) Stats(userID string) map[string]interface{} {
-	bucket := rl.getBucket(userID)
-	return map[string]interface{}{
-		"available": bucket.Available(),
-		"capacity":  bucket.capacity,
+	rl.mu.RLock()
+	capacity := rl.userLimit(userID).capacity
+	available := capacity
+	models := make(map[string]map[string]int64)
+	for key, bucket := range rl.buckets {
+		if key.user != userID {
+			continue
+		}
+		bucketAvailable := bucket.Available()
+		available = min(available, bucketAvailable)
+		if key.model != "" {
+			models[key.model] = map[string]int64{"available": bucketAvailable, "capacity": bucket.Capacity()}
+		}
 	}
-}
+	rl.mu.RUnlock()
 
+	stats := map[string]interface{}{
+		"available": available,
+		"capacity":  capacity,
+	}
+	if len(models) > 0 {
+		stats["models"] = models
+	}
+	if soft := rl.softLimit(userID); soft > 0 {
+		stats["soft_limit"] = soft
+	}
+	return stats
+}
@@ -0,0 +1,252 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowModelUsesModelLimit(t *testing.T) {
+	rl := NewRateLimiter(5, 0)
+	rl.SetModelLimit("gpt-4", 1, 0)
+
+	assert.True(t, rl.AllowModel("user", "gpt-4", 1))
+	assert.False(t, rl.AllowModel("user", "gpt-4", 1))
+
+	// Other models fall back to the default limit and have their own bucket
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.AllowModel("user", "gpt-3.5-turbo", 1))
+	}
+	assert.False(t, rl.AllowModel("user", "gpt-3.5-turbo", 1))
+}
+
+func TestEvictIdleBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := NewRateLimiter(5, 1)
+	rl.now = func() time.Time { return now }
+
+	assert.True(t, rl.Allow("idle", 1))
+	assert.True(t, rl.Allow("active", 1))
+
+	// Both buckets have refilled; only "active" was used recently
+	now = now.Add(10 * time.Minute)
+	assert.True(t, rl.Allow("active", 1))
+
+	rl.evictIdle(5 * time.Minute)
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	assert.NotContains(t, rl.buckets, bucketKey{user: "idle"})
+	assert.Contains(t, rl.buckets, bucketKey{user: "active"})
+}
+
+func TestStartEvictionStopsOnClose(t *testing.T) {
+	rl := NewRateLimiter(5, 1000)
+	rl.Allow("user", 1)
+	rl.StartEviction(time.Millisecond, 0)
+	defer rl.Close()
+
+	// With a zero TTL the bucket is evicted as soon as it refills
+	assert.Eventually(t, func() bool {
+		rl.mu.RLock()
+		defer rl.mu.RUnlock()
+		return len(rl.buckets) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSetDefaultLimitUpdatesExistingBuckets(t *testing.T) {
+	rl := NewRateLimiter(10, 0.001)
+	rl.SetModelLimit("gpt-4", 10, 0.001)
+	assert.True(t, rl.Allow("user-1", 1))
+	assert.True(t, rl.AllowModel("user-1", "gpt-4", 1))
+
+	rl.SetDefaultLimit(3, 0.001)
+
+	// The default bucket is clamped to the new capacity
+	assert.True(t, rl.Allow("user-1", 3))
+	assert.False(t, rl.Allow("user-1", 1))
+	assert.Equal(t, int64(3), rl.Stats("user-1")["capacity"])
+
+	// Model overrides keep their own limit
+	assert.True(t, rl.AllowModel("user-1", "gpt-4", 9))
+}
+
+func TestWaitBlocksUntilRefill(t *testing.T) {
+	tb := NewTokenBucket(1, 20)
+	assert.True(t, tb.Allow(1))
+
+	start := time.Now()
+	assert.NoError(t, tb.Wait(context.Background(), 1))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.Equal(t, int64(0), tb.Available())
+}
+
+func TestWaitRejectsBeyondDeadline(t *testing.T) {
+	tb := NewTokenBucket(1, 0.1)
+	assert.True(t, tb.Allow(1))
+
+	// The next token is 10s away, so Wait fails without sleeping
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, tb.Wait(ctx, 1), ErrWaitExceeded)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.ErrorIs(t, tb.Wait(context.Background(), 2), ErrWaitExceeded, "more tokens than the capacity never become available")
+}
+
+func TestWaitStopsOnCancel(t *testing.T) {
+	tb := NewTokenBucket(1, 0.1)
+	assert.True(t, tb.Allow(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	assert.ErrorIs(t, tb.Wait(ctx, 1), context.Canceled)
+}
+
+func TestBatchTrafficKeepsInteractiveReserve(t *testing.T) {
+	rl := NewRateLimiter(10, 0.001)
+	rl.SetBatchReserve(0.3)
+
+	// Saturating batch traffic stops at the reserve
+	batch := 0
+	for rl.AllowModelWithPriority("user", "gpt-4", 1, PriorityBatch) {
+		batch++
+	}
+	assert.Equal(t, 7, batch)
+
+	// Interactive requests can still use the reserve
+	for i := 0; i < 3; i++ {
+		assert.True(t, rl.AllowModelWithPriority("user", "gpt-4", 1, PriorityInteractive))
+	}
+	assert.False(t, rl.AllowModelWithPriority("user", "gpt-4", 1, PriorityInteractive))
+}
+
+func TestParsePriority(t *testing.T) {
+	for name, want := range map[string]Priority{"": PriorityInteractive, "interactive": PriorityInteractive, "Batch": PriorityBatch} {
+		priority, err := ParsePriority(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, priority)
+	}
+
+	_, err := ParsePriority("urgent")
+	assert.Error(t, err)
+}
+
+func TestResetRefillsUserBuckets(t *testing.T) {
+	rl := NewRateLimiter(2, 0.001)
+	assert.True(t, rl.Allow("user-1", 2))
+	assert.True(t, rl.AllowModel("user-1", "gpt-4", 2))
+	assert.True(t, rl.Allow("user-2", 2))
+
+	rl.Reset("user-1")
+
+	assert.Equal(t, int64(2), rl.Stats("user-1")["available"])
+	assert.True(t, rl.AllowModel("user-1", "gpt-4", 2))
+	assert.Equal(t, int64(0), rl.Stats("user-2")["available"], "other users keep their state")
+}
+
+func TestAdjustModelCorrectsCharge(t *testing.T) {
+	rl := NewRateLimiter(100, 0.001)
+	assert.True(t, rl.AllowModel("user", "gpt-4", 10))
+
+	// Charging more than remains leaves the bucket in debt
+	rl.AdjustModel("user", "gpt-4", 140)
+	assert.False(t, rl.AllowModel("user", "gpt-4", 1))
+
+	// Refunds never fill the bucket above its capacity
+	rl.AdjustModel("user", "gpt-4", -500)
+	assert.True(t, rl.AllowModel("user", "gpt-4", 100))
+	assert.False(t, rl.AllowModel("user", "gpt-4", 1))
+}
+
+func TestSoftAndHardLimits(t *testing.T) {
+	for name, limiter := range map[string]Decider{
+		"token bucket":   NewRateLimiter(10, 0),
+		"sliding window": NewSlidingWindowLimiter(10, time.Hour),
+	} {
+		limiter.SetThresholds(6, map[string]Thresholds{"vip": {Soft: 15, Hard: 20}})
+
+		// Up to the soft limit requests pass silently, then with a warning
+		// until the hard limit rejects them
+		for i := 1; i <= 6; i++ {
+			assert.Equal(t, Decision{Allowed: true, Remaining: int64(10 - i), Limit: 10}, limiter.DecideModel("user", "gpt-4", 1, PriorityInteractive), name)
+		}
+		assert.Equal(t, Decision{Allowed: true, Remaining: 3, Limit: 10, SoftExceeded: true}, limiter.DecideModel("user", "gpt-4", 1, PriorityInteractive), name)
+		assert.Equal(t, Decision{Allowed: true, Remaining: 0, Limit: 10, SoftExceeded: true}, limiter.DecideModel("user", "gpt-4", 3, PriorityInteractive), name)
+		assert.Equal(t, Decision{Allowed: false, Remaining: -2, Limit: 10}, limiter.DecideModel("user", "gpt-4", 2, PriorityInteractive), name)
+
+		// Users can have their own thresholds
+		assert.Equal(t, Decision{Allowed: true, Remaining: 5, Limit: 20}, limiter.DecideModel("vip", "gpt-4", 15, PriorityInteractive), name)
+		assert.Equal(t, Decision{Allowed: true, Remaining: 4, Limit: 20, SoftExceeded: true}, limiter.DecideModel("vip", "gpt-4", 1, PriorityInteractive), name)
+	}
+}
+
+func TestProvisionedUserGetsMoreHeadroom(t *testing.T) {
+	rl := NewRateLimiter(10, 1)
+	rl.SetUserLimit("enterprise", 100, 10)
+
+	allowed := func(userID string) int {
+		n := 0
+		for i := 0; i < 50; i++ {
+			if rl.Allow(userID, 1) {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 10, allowed("free"))
+	assert.Equal(t, 50, allowed("enterprise"))
+}
+
+func TestStatsReportModelBuckets(t *testing.T) {
+	rl := NewRateLimiter(5, 0.001)
+
+	// Stats of an unknown user don't create a bucket
+	assert.Equal(t, int64(5), rl.Stats("user-1")["available"])
+	assert.Empty(t, rl.buckets)
+
+	assert.True(t, rl.AllowModel("user-1", "gpt-4", 4))
+	assert.True(t, rl.AllowModel("user-1", "claude-3-haiku", 1))
+	stats := rl.Stats("user-1")
+	assert.Equal(t, int64(1), stats["available"], "the most depleted bucket")
+	assert.Equal(t, int64(5), stats["capacity"])
+	assert.Equal(t, map[string]map[string]int64{
+		"gpt-4":          {"available": 1, "capacity": 5},
+		"claude-3-haiku": {"available": 4, "capacity": 5},
+	}, stats["models"])
+	assert.Len(t, rl.buckets, 2)
+}
+
+func TestSetUserLimitResizesExistingBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := NewRateLimiter(10, 1)
+	rl.now = func() time.Time { return now }
+	rl.SetThresholds(0, map[string]Thresholds{"enterprise": {Soft: 5}})
+	assert.True(t, rl.Allow("enterprise", 10))
+
+	rl.SetUserLimit("enterprise", 100, 50)
+	stats := rl.Stats("enterprise")
+	assert.Equal(t, int64(100), stats["capacity"])
+	assert.Equal(t, int64(5), stats["soft_limit"])
+
+	// The provisioned refill rate replaces the scaled one
+	now = now.Add(time.Second)
+	assert.Equal(t, int64(50), rl.Stats("enterprise")["available"])
+}
+
+func TestSetThresholdsScalesRefillRate(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := NewRateLimiter(10, 1)
+	rl.now = func() time.Time { return now }
+	assert.True(t, rl.Allow("vip", 10))
+
+	// The bucket of a user with a hard limit refills as fast relative to
+	// its capacity as the default one
+	rl.SetThresholds(0, map[string]Thresholds{"vip": {Hard: 20}})
+	assert.Equal(t, int64(20), rl.Stats("vip")["capacity"])
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, int64(20), rl.Stats("vip")["available"])
+}
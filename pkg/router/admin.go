@@ -0,0 +1,202 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// HandleRateLimitStats returns the rate limit state of the user in the
+// :user path parameter
+func (r *Router) HandleRateLimitStats(c *gin.Context) {
+	userID := c.Param("user")
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"stats":   r.rateLimiter.Stats(userID),
+	})
+}
+
+// HandleRateLimitOffenders lists the users rate limited most often, up to
+// the limit query parameter (default 10)
+func (r *Router) HandleRateLimitOffenders(c *gin.Context) {
+	limit := 10
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+		limit = n
+	}
+	c.JSON(http.StatusOK, gin.H{"offenders": middleware.TopRateLimitOffenders(limit)})
+}
+
+// HandleRateLimitReset restores every rate limit of the user in the :user
+// path parameter to full capacity
+func (r *Router) HandleRateLimitReset(c *gin.Context) {
+	resetter, ok := r.rateLimiter.(ratelimit.Resetter)
+	if !ok {
+		respondError(c, http.StatusNotImplemented, errors.New("rate limiter does not support reset"))
+		return
+	}
+
+	userID := c.Param("user")
+	resetter.Reset(userID)
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"stats":   r.rateLimiter.Stats(userID),
+	})
+}
+
+// HandleListProviders lists the registered providers and whether they are
+// enabled
+func (r *Router) HandleListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": r.ProviderStatuses()})
+}
+
+// HandleProviderHealth returns the health of every provider as last
+// probed in the background
+func (r *Router) HandleProviderHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": r.ProviderHealths()})
+}
+
+// HandleProviderEnable enables the provider in the :name path parameter
+func (r *Router) HandleProviderEnable(c *gin.Context) {
+	r.setProviderEnabled(c, true)
+}
+
+// HandleProviderDisable disables the provider in the :name path parameter
+// until it is enabled again
+func (r *Router) HandleProviderDisable(c *gin.Context) {
+	r.setProviderEnabled(c, false)
+}
+
+// setProviderEnabled enables or disables the provider in the :name path
+// parameter
+func (r *Router) setProviderEnabled(c *gin.Context, enabled bool) {
+	name := c.Param("name")
+	if err := r.SetProviderEnabled(name, enabled); err != nil {
+		respondError(c, http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": name, "enabled": enabled})
+}
+
+// HandleCacheDelete purges cached responses, either the one under the key
+// query parameter or every one whose key starts with the prefix query
+// parameter. It returns the number of deleted entries. Keys and prefixes
+// outside the cache's namespaces are rejected.
+func (r *Router) HandleCacheDelete(c *gin.Context) {
+	key, prefix := c.Query("key"), c.Query("prefix")
+	if (key == "") == (prefix == "") {
+		respondError(c, http.StatusBadRequest, errors.New("exactly one of key and prefix is required"))
+		return
+	}
+	if !inCacheNamespace(key + prefix) {
+		respondError(c, http.StatusBadRequest, errors.New("key or prefix must start with chat:, embeddings: or user:<id>:"))
+		return
+	}
+
+	if key != "" {
+		r.deleteCacheKey(c, key)
+		return
+	}
+	r.deleteCachePrefix(c, prefix)
+}
+
+// HandleUserCacheDelete purges the responses cached for the user in the :id
+// path parameter with a per-user cache. Responses shared across users are
+// kept.
+func (r *Router) HandleUserCacheDelete(c *gin.Context) {
+	r.deleteCachePrefix(c, userCachePrefix(c.Param("id")))
+}
+
+// HandleModelCacheDelete purges the chat and embeddings responses cached
+// for the model in the :model path parameter. Responses cached per user are
+// keyed by user first, so only shared ones are purged.
+func (r *Router) HandleModelCacheDelete(c *gin.Context) {
+	model := c.Param("model")
+	r.deleteCachePrefix(c, cacheKeyPrefix("chat", model), cacheKeyPrefix("embeddings", model))
+}
+
+// cacheKinds are the key prefixes of the kinds of cached response, which
+// follow the user prefix with a per-user cache
+var cacheKinds = []string{"chat:", "embeddings:"}
+
+// inCacheNamespace reports whether a key or key prefix lies within the
+// cached responses. The cache may share its Redis database with the usage
+// counters, which must not be purged through the cache endpoints.
+func inCacheNamespace(key string) bool {
+	if rest, ok := strings.CutPrefix(key, "user:"); ok {
+		userID, rest, ok := strings.Cut(rest, ":")
+		if !ok || userID == "" {
+			return false
+		}
+		if rest == "" {
+			return true
+		}
+		key = rest
+	}
+	for _, kind := range cacheKinds {
+		if strings.HasPrefix(key, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteCacheKey deletes one cache entry and responds with the count
+func (r *Router) deleteCacheKey(c *gin.Context, key string) {
+	if r.cache == nil {
+		respondError(c, http.StatusServiceUnavailable, errors.New("cache disabled"))
+		return
+	}
+
+	// Delete doesn't report whether the key existed
+	deleted := 0
+	var value json.RawMessage
+	if err := r.cache.Get(c.Request.Context(), key, &value); err == nil {
+		deleted = 1
+	}
+	if err := r.cache.Delete(c.Request.Context(), key); err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	// A chat response's stale copy goes with it
+	_ = r.cache.Delete(c.Request.Context(), key+staleKeySuffix)
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// deleteCachePrefix deletes the cache entries with any of the key prefixes
+// and responds with the count
+func (r *Router) deleteCachePrefix(c *gin.Context, prefixes ...string) {
+	if r.cache == nil {
+		respondError(c, http.StatusServiceUnavailable, errors.New("cache disabled"))
+		return
+	}
+	deleter, ok := r.cache.(cache.PrefixDeleter)
+	if !ok {
+		respondError(c, http.StatusNotImplemented, errors.New("cache does not support prefix deletion"))
+		return
+	}
+
+	total := 0
+	for _, prefix := range prefixes {
+		deleted, err := deleter.DeleteByPrefix(c.Request.Context(), prefix)
+		total += deleted
+		if err != nil {
+			resp := middleware.NewErrorResponse(http.StatusInternalServerError, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": resp.Error, "deleted": total})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": total})
+}
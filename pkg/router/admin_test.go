@@ -0,0 +1,179 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+func TestRateLimitAdminEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(5, 0.001))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	engine.GET("/admin/ratelimit/:user", r.HandleRateLimitStats)
+	engine.POST("/admin/ratelimit/:user/reset", r.HandleRateLimitReset)
+	available := func(method, path string) float64 {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			UserID string                 `json:"user_id"`
+			Stats  map[string]interface{} `json:"stats"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "user-1", body.UserID)
+		return body.Stats["available"].(float64)
+	}
+
+	// Use up the user's quota through the API
+	for i := 0; i < 6; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "user-1")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if i < 5 {
+			assert.Equal(t, http.StatusOK, w.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		}
+	}
+
+	assert.Equal(t, float64(0), available("GET", "/admin/ratelimit/user-1"))
+	assert.Equal(t, float64(5), available("POST", "/admin/ratelimit/user-1/reset"))
+}
+
+func TestRateLimitResetUnsupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, denyLimiter{})
+
+	engine := gin.New()
+	engine.POST("/admin/ratelimit/:user/reset", r.HandleRateLimitReset)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("POST", "/admin/ratelimit/user-1/reset", nil))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestRateLimitOffendersEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, denyLimiter{})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	engine.GET("/admin/ratelimit", r.HandleRateLimitOffenders)
+
+	// Rejected requests are counted for the user
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "offender")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/admin/ratelimit?limit=1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Offenders []middleware.Offender `json:"offenders"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, []middleware.Offender{{UserID: "offender", Count: 100}}, body.Offenders)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/admin/ratelimit?limit=none", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCacheDeleteEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := cache.NewInMemoryCache(0, time.Minute)
+	r := NewRouter(store, nil)
+	keys := []string{
+		"chat:a", "chat:b", "embeddings:a", "user:u1:chat:a", "user:u2:chat:a",
+		cacheKeyPrefix("chat", "gpt-4") + "1", cacheKeyPrefix("embeddings", "gpt-4") + "2", cacheKeyPrefix("chat", "gpt-4o") + "3",
+	}
+	for _, key := range keys {
+		assert.NoError(t, store.Set(ctx, key, key))
+	}
+
+	engine := gin.New()
+	engine.DELETE("/admin/cache", r.HandleCacheDelete)
+	engine.DELETE("/admin/cache/user/:id", r.HandleUserCacheDelete)
+	engine.DELETE("/admin/cache/model/:model", r.HandleModelCacheDelete)
+	deleted := func(path string) int {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("DELETE", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Deleted int `json:"deleted"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Deleted
+	}
+
+	assert.Equal(t, 1, deleted("/admin/cache?key=chat:a"))
+	assert.Equal(t, 0, deleted("/admin/cache?key=chat:a"))
+	assert.Equal(t, 2, deleted("/admin/cache/model/gpt-4"))
+	assert.Equal(t, 2, deleted("/admin/cache?prefix=chat:"))
+	assert.Equal(t, 1, deleted("/admin/cache/user/u1"))
+	assert.Equal(t, 2, store.Len())
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/cache", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCacheDeleteRejectsKeysOutsideTheCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := cache.NewInMemoryCache(0, time.Minute)
+	r := NewRouter(store, nil)
+	keys := []string{"usage:u1:day:2024-01-01", "usage:u1:month:2024-01", "chat:a", "user:u1:chat:a"}
+	for _, key := range keys {
+		assert.NoError(t, store.Set(ctx, key, key))
+	}
+
+	engine := gin.New()
+	engine.DELETE("/admin/cache", r.HandleCacheDelete)
+	for _, query := range []string{"prefix=u", "prefix=usage:", "prefix=user:", "prefix=user:u1", "key=usage:u1:day:2024-01-01"} {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/cache?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	assert.Equal(t, len(keys), store.Len())
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/cache?prefix=user:u1:", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, len(keys)-1, store.Len())
+}
+
+func TestCacheDeleteWithoutCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, nil)
+
+	engine := gin.New()
+	engine.DELETE("/admin/cache", r.HandleCacheDelete)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/cache?prefix=chat:", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
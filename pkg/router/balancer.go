@@ -0,0 +1,95 @@
+package router
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// weightedProvider is a provider backend with its selection weight.
+// Regional backends have a region and a probe instead, and are selected by
+// region and latency.
+type weightedProvider struct {
+	provider providers.Provider
+	weight   int
+	region   string
+	probe    *regionProbe
+}
+
+// latency returns the backend's last probed latency, or zero if unknown
+func (b weightedProvider) latency() time.Duration {
+	if b.probe == nil {
+		return 0
+	}
+	return time.Duration(b.probe.latency.Load())
+}
+
+// RegisterWeightedProvider adds a backend under a logical provider name.
+// Requests for that name are spread across its backends by weighted random
+// selection, e.g. weights 70 and 30 send ~70% of traffic to the first.
+// Weights below 1 are treated as 1.
+func (r *Router) RegisterWeightedProvider(name string, provider providers.Provider, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	r.providersMu.Lock()
+	defer r.providersMu.Unlock()
+	r.providers[name] = append(r.providers[name], weightedProvider{provider: provider, weight: weight})
+}
+
+// SetRandSource replaces the random source used for weighted selection,
+// allowing deterministic selection in tests
+func (r *Router) SetRandSource(src rand.Source) {
+	r.randMu.Lock()
+	defer r.randMu.Unlock()
+	r.rand = rand.New(src)
+}
+
+// getProvider returns a backend registered under the given name, picking
+// one by weight when several are registered. Disabled providers are not
+// returned.
+func (r *Router) getProvider(name string) (providers.Provider, bool) {
+	backend, ok := r.getBackend(name)
+	return backend.provider, ok
+}
+
+// getBackend is getProvider returning the backend with its region. Regional
+// providers pick a backend by region and latency instead of weight.
+func (r *Router) getBackend(name string) (weightedProvider, bool) {
+	r.providersMu.RLock()
+	backends := r.providers[name]
+	if r.disabledProviders[name] {
+		backends = nil
+	}
+	r.providersMu.RUnlock()
+
+	switch len(backends) {
+	case 0:
+		return weightedProvider{}, false
+	case 1:
+		return backends[0], true
+	}
+	for _, b := range backends {
+		if b.probe != nil {
+			return r.selectRegional(backends), true
+		}
+	}
+
+	total := 0
+	for _, b := range backends {
+		total += b.weight
+	}
+
+	r.randMu.Lock()
+	n := r.rand.Intn(total)
+	r.randMu.Unlock()
+
+	for _, b := range backends {
+		if n < b.weight {
+			return b, true
+		}
+		n -= b.weight
+	}
+	return backends[len(backends)-1], true
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
+)
+
+// defaultCompletionEstimate is the number of completion tokens assumed when
+// a request doesn't set max_tokens
+const defaultCompletionEstimate = 1024
+
+// SetBudgetLimit rejects requests that would exceed the user's monthly spend
+// cap. The request cost is estimated before dispatch; the actual cost is
+// recorded by the usage tracker afterwards.
+func (r *Router) SetBudgetLimit(budget *usage.BudgetLimit) {
+	r.budget = budget
+}
+
+// estimateTokens conservatively estimates the prompt and completion tokens of
+// a request. The prompt is counted with the model's tokenizer (or ~3
+// characters per token if that fails) and each of the n completions is
+// assumed to use the full max_tokens, so a single large request can't
+// overshoot the budget.
+func estimateTokens(req *providers.ChatRequest) (int, int) {
+	prompt, err := providers.CountTokens(req.Model, req.Messages)
+	if err != nil {
+		prompt = 3
+		for _, msg := range req.Messages {
+			prompt += 4 + (len(msg.Role)+len(msg.Content))/3 + 1
+		}
+	}
+
+	completion := req.MaxTokens
+	if completion <= 0 {
+		completion = defaultCompletionEstimate
+	}
+	return prompt, completion * max(req.N, 1)
+}
+
+// estimateCompletionTokens estimates the tokens of the choices of a
+// response, counting their content and tool calls with the model's
+// tokenizer, or ~3 characters per token if that fails
+func estimateCompletionTokens(model string, choices []providers.Choice) int {
+	var text strings.Builder
+	for _, choice := range choices {
+		text.WriteString(choice.Message.Content)
+		for _, call := range choice.Message.ToolCalls {
+			text.WriteString(call.Function.Name)
+			text.WriteString(call.Function.Arguments)
+		}
+	}
+
+	tokens, err := providers.CountTextTokens(model, text.String())
+	if err != nil {
+		tokens = (text.Len() + 2) / 3
+	}
+	return tokens
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+func TestBudgetEstimateCountsEveryChoice(t *testing.T) {
+	req := providers.ChatRequest{Model: "gpt-4", MaxTokens: 100, Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	prompt, completion := estimateTokens(&req)
+	assert.Equal(t, 100, completion)
+
+	// Each of n choices may use max_tokens
+	req.N = 5
+	nPrompt, nCompletion := estimateTokens(&req)
+	assert.Equal(t, prompt, nPrompt)
+	assert.Equal(t, 500, nCompletion)
+
+	// as may each default-sized one
+	req.MaxTokens = 0
+	_, nCompletion = estimateTokens(&req)
+	assert.Equal(t, 5*defaultCompletionEstimate, nCompletion)
+}
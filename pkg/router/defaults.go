@@ -0,0 +1,46 @@
+package router
+
+import (
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// ProviderDefaults are parameters filled into the chat completion requests
+// of a provider that don't set them, so clients can send minimal requests
+type ProviderDefaults struct {
+	// MaxTokens is used when a request sets no max_tokens; zero leaves it
+	// to the provider
+	MaxTokens int
+
+	// Temperature is used when a request sends no temperature; nil leaves
+	// it to the provider
+	Temperature *float64
+
+	// ModelAliases map aliases to models of the provider, such as "fast"
+	// for "gpt-4o-mini"; they are resolved like those of SetModelAlias
+	ModelAliases map[string]string
+}
+
+// SetProviderDefaults sets the default parameters of the requests routed to
+// the named provider, replacing any set before, and registers its model
+// aliases
+func (r *Router) SetProviderDefaults(providerName string, defaults ProviderDefaults) {
+	r.providerDefaults[providerName] = defaults
+	for alias, model := range defaults.ModelAliases {
+		r.SetModelAlias(alias, model)
+	}
+}
+
+// applyProviderDefaults fills the defaults of the provider serving the
+// request's model into the fields the request leaves unset
+func (r *Router) applyProviderDefaults(req *providers.ChatRequest) {
+	defaults, ok := r.providerDefaults[r.getProviderFromModel(req.Model)]
+	if !ok {
+		return
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = defaults.MaxTokens
+	}
+	if !req.TemperatureSet && defaults.Temperature != nil {
+		req.Temperature, req.TemperatureSet = *defaults.Temperature, true
+	}
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// recordingProvider keeps the last request it was sent
+type recordingProvider struct {
+	stubProvider
+	last *providers.ChatRequest
+}
+
+func (p *recordingProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.last = req
+	return p.stubProvider.ChatCompletion(ctx, req)
+}
+
+func TestProviderDefaults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	temperature := 0.7
+	for _, tc := range []struct {
+		name        string
+		body        string
+		model       string
+		maxTokens   int
+		temperature float64
+	}{
+		{"unset fields get the defaults", `{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`, "gpt-4", 4096, 0.7},
+		{"explicit values are kept", `{"model":"gpt-4","max_tokens":50,"temperature":0,"messages":[{"role":"user","content":"Hi"}]}`, "gpt-4", 50, 0},
+		{"aliases resolve to the provider's model", `{"model":"fast","messages":[{"role":"user","content":"Hi"}]}`, "gpt-4o-mini", 4096, 0.7},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &recordingProvider{stubProvider: stubProvider{name: "openai"}}
+			r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+			r.RegisterProvider("openai", provider)
+			r.SetProviderDefaults("openai", ProviderDefaults{
+				MaxTokens:    4096,
+				Temperature:  &temperature,
+				ModelAliases: map[string]string{"fast": "gpt-4o-mini"},
+			})
+
+			engine := gin.New()
+			engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tc.body))
+			req.Header.Set("X-User-ID", "test-user")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			if assert.NotNil(t, provider.last) {
+				assert.Equal(t, tc.model, provider.last.Model)
+				assert.Equal(t, tc.maxTokens, provider.last.MaxTokens)
+				assert.Equal(t, tc.temperature, provider.last.Temperature)
+			}
+		})
+	}
+}
+
+func TestProviderDefaultsOnlyApplyToTheirProvider(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.SetProviderDefaults("anthropic", ProviderDefaults{MaxTokens: 1024})
+
+	req := &providers.ChatRequest{Model: "gpt-4"}
+	r.applyProviderDefaults(req)
+	assert.Equal(t, 0, req.MaxTokens)
+
+	req = &providers.ChatRequest{Model: "claude-3-opus-20240229"}
+	r.applyProviderDefaults(req)
+	assert.Equal(t, 1024, req.MaxTokens)
+}
+
+func TestProviderDefaultsSendExplicitZeroTemperature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var sent map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sent = nil
+		json.NewDecoder(req.Body).Decode(&sent)
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	temperature := 0.7
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", providers.NewOpenAIProvider("test-key", providers.WithBaseURL(upstream.URL)))
+	r.SetProviderDefaults("openai", ProviderDefaults{Temperature: &temperature})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","temperature":0,"messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Contains(t, sent, "temperature") {
+		assert.Equal(t, 0.0, sent["temperature"])
+	}
+}
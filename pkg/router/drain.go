@@ -0,0 +1,93 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamTracker counts in-flight streams so shutdown can wait for them.
+// Once draining begins no new stream may start.
+type streamTracker struct {
+	mu       sync.Mutex
+	active   int
+	draining bool
+	idle     chan struct{} // closed once draining with no active streams
+}
+
+// acquire registers a new stream; it fails once draining has begun
+func (t *streamTracker) acquire() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.active++
+	return true
+}
+
+// release unregisters a finished stream
+func (t *streamTracker) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.draining && t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// drain stops new streams and waits for the active ones to finish
+func (t *streamTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.draining {
+		t.draining = true
+		t.idle = make(chan struct{})
+		if t.active == 0 {
+			close(t.idle)
+		}
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain puts the router in draining mode, in which new completion and
+// embedding requests are refused with 503, and waits for in-flight streams
+// to finish. It returns ctx's error if streams are still active when ctx is
+// done.
+func (r *Router) Drain(ctx context.Context) error {
+	return r.streams.drain(ctx)
+}
+
+// Draining reports whether Drain has been called
+func (r *Router) Draining() bool {
+	r.streams.mu.Lock()
+	defer r.streams.mu.Unlock()
+	return r.streams.draining
+}
+
+// ActiveStreams returns the number of in-flight streams
+func (r *Router) ActiveStreams() int {
+	r.streams.mu.Lock()
+	defer r.streams.mu.Unlock()
+	return r.streams.active
+}
+
+// refuseWhileDraining responds 503 and returns true if the router is draining
+func (r *Router) refuseWhileDraining(c *gin.Context) bool {
+	if !r.Draining() {
+		return false
+	}
+	c.Header("Connection", "close")
+	respondError(c, http.StatusServiceUnavailable, errors.New("server is shutting down"))
+	return true
+}
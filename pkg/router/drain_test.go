@@ -0,0 +1,99 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// blockingStreamProvider streams one chunk, then holds the stream open until
+// release is closed
+type blockingStreamProvider struct {
+	stubProvider
+	release chan struct{}
+}
+
+func (b *blockingStreamProvider) ChatCompletionStream(ctx context.Context, req *providers.ChatRequest) (<-chan providers.StreamChunk, error) {
+	chunks := make(chan providers.StreamChunk)
+	go func() {
+		defer close(chunks)
+		chunks <- providers.StreamChunk{ID: "stream-1", Model: req.Model, Role: "assistant"}
+		<-b.release
+		chunks <- providers.StreamChunk{ID: "stream-1", Model: req.Model, Content: "done", FinishReason: "stop"}
+	}()
+	return chunks, nil
+}
+
+func TestDrainWaitsForInFlightStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &blockingStreamProvider{stubProvider: stubProvider{name: "openai"}, release: make(chan struct{})}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	post := func(body string) *http.Response {
+		req, _ := http.NewRequest("POST", server.URL+"/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-User-ID", "user-1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	streamed := make(chan string)
+	go func() {
+		resp := post(`{"model":"gpt-4","stream":true,"temperature":0.7,"messages":[{"role":"user","content":"Hi"}]}`)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		streamed <- string(body)
+	}()
+	assert.Eventually(t, func() bool { return r.ActiveStreams() == 1 }, time.Second, 5*time.Millisecond)
+
+	drained := make(chan error)
+	go func() { drained <- r.Drain(context.Background()) }()
+	assert.Eventually(t, r.Draining, time.Second, 5*time.Millisecond)
+
+	// New requests are refused while the stream is still running
+	resp := post(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, StatusDraining, r.ReadinessCheck(context.Background())["router"])
+
+	select {
+	case <-drained:
+		t.Fatal("Drain returned before the stream finished")
+	default:
+	}
+
+	close(provider.release)
+	assert.NoError(t, <-drained)
+	body := <-streamed
+	assert.Contains(t, body, `"content":"done"`)
+	assert.Contains(t, body, "[DONE]")
+}
+
+func TestDrainTimesOut(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	assert.True(t, r.streams.acquire())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, r.Drain(ctx), context.DeadlineExceeded)
+	assert.False(t, r.streams.acquire())
+
+	r.streams.release()
+	assert.NoError(t, r.Drain(context.Background()))
+}
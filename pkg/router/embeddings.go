@@ -0,0 +1,125 @@
+package router
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// EmbeddingBatching controls how embeddings requests with many inputs are
+// split into provider calls
+type EmbeddingBatching struct {
+	// BatchSize is the most inputs sent to the provider in one call; zero
+	// sends every input in one call
+	BatchSize int
+	// MaxConcurrency bounds the provider calls in flight for one request
+	MaxConcurrency int
+}
+
+// DefaultEmbeddingBatching returns the batching used when none is
+// configured
+func DefaultEmbeddingBatching() EmbeddingBatching {
+	return EmbeddingBatching{
+		BatchSize:      100,
+		MaxConcurrency: 4,
+	}
+}
+
+// SetEmbeddingBatching replaces the embeddings batching settings
+func (r *Router) SetEmbeddingBatching(batching EmbeddingBatching) {
+	r.embeddingBatching = batching
+}
+
+// EmbeddingError reports the inputs of a batch that failed
+type EmbeddingError struct {
+	Indices []int  `json:"indices"`
+	Error   string `json:"error"`
+}
+
+// embeddingBatchResponse is an embeddings response that may be missing the
+// embeddings of failed batches; Errors lists their input indices
+type embeddingBatchResponse struct {
+	*providers.EmbeddingResponse
+	Errors []EmbeddingError `json:"errors,omitempty"`
+}
+
+// embedBatched embeds the inputs of req in batches, calling the provider
+// for at most MaxConcurrency batches at a time. The embeddings keep the
+// indices of their inputs. Failed batches are reported as EmbeddingErrors;
+// if every batch fails the first error is returned instead.
+func (r *Router) embedBatched(ctx context.Context, provider providers.Provider, req *providers.EmbeddingRequest) (*providers.EmbeddingResponse, []EmbeddingError, error) {
+	size := r.embeddingBatching.BatchSize
+	if size <= 0 || size > len(req.Input) {
+		size = len(req.Input)
+	}
+	batches := (len(req.Input) + size - 1) / size
+	workers := r.embeddingBatching.MaxConcurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	workers = min(workers, batches)
+
+	results := make([]*providers.EmbeddingResponse, batches)
+	errs := make([]error, batches)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := i * size
+				end := min(start+size, len(req.Input))
+				results[i], errs[i] = provider.Embeddings(ctx, &providers.EmbeddingRequest{
+					Model: req.Model,
+					Input: req.Input[start:end],
+				})
+				errs[i] = tagRequestID(ctx, errs[i])
+			}
+		}()
+	}
+	for i := 0; i < batches; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	merged := &providers.EmbeddingResponse{Object: "list", Model: req.Model}
+	var failures []EmbeddingError
+	var firstErr error
+	for i, resp := range results {
+		start := i * size
+		end := min(start+size, len(req.Input))
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			failure := EmbeddingError{Error: errs[i].Error()}
+			for index := start; index < end; index++ {
+				failure.Indices = append(failure.Indices, index)
+			}
+			failures = append(failures, failure)
+			continue
+		}
+
+		if resp.Model != "" {
+			merged.Model = resp.Model
+		}
+		for _, embedding := range resp.Data {
+			embedding.Index += start
+			merged.Data = append(merged.Data, embedding)
+		}
+		merged.Usage.PromptTokens += resp.Usage.PromptTokens
+		merged.Usage.TotalTokens += resp.Usage.TotalTokens
+	}
+	if len(failures) == batches {
+		return nil, nil, firstErr
+	}
+
+	sort.Slice(merged.Data, func(i, j int) bool {
+		return merged.Data[i].Index < merged.Data[j].Index
+	})
+	return merged, failures, nil
+}
@@ -0,0 +1,144 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// embeddingProvider embeds each input "input-N" as the vector [N]. Later
+// batches answer sooner so batches complete out of order, and inputs listed
+// in fail make their batch fail.
+type embeddingProvider struct {
+	stubProvider
+	fail map[string]bool
+
+	mu          sync.Mutex
+	active      int
+	maxActive   int
+	batchInputs []int
+}
+
+func (p *embeddingProvider) Embeddings(ctx context.Context, req *providers.EmbeddingRequest) (*providers.EmbeddingResponse, error) {
+	p.mu.Lock()
+	p.active++
+	p.maxActive = max(p.maxActive, p.active)
+	p.batchInputs = append(p.batchInputs, len(req.Input))
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.active--
+		p.mu.Unlock()
+	}()
+
+	resp := &providers.EmbeddingResponse{Object: "list", Model: req.Model}
+	for i, input := range req.Input {
+		if p.fail[input] {
+			return nil, &providers.ProviderError{Provider: "openai", StatusCode: http.StatusBadGateway, Body: "upstream failed"}
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(input, "input-"))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			time.Sleep(time.Duration(1000-n) * time.Microsecond)
+		}
+		resp.Data = append(resp.Data, providers.Embedding{Object: "embedding", Index: i, Embedding: []float64{float64(n)}})
+		resp.Usage.PromptTokens++
+		resp.Usage.TotalTokens++
+	}
+	return resp, nil
+}
+
+// postEmbeddings sends count inputs to the embeddings handler
+func postEmbeddings(t *testing.T, r *Router, count int) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/v1/embeddings", r.HandleEmbeddings)
+
+	inputs := make([]string, count)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("input-%d", i)
+	}
+	body, err := json.Marshal(map[string]interface{}{"model": "text-embedding-3-small", "input": inputs})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(string(body)))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmbeddingsBatchesPreserveOrder(t *testing.T) {
+	provider := &embeddingProvider{stubProvider: stubProvider{name: "openai"}}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+	r.SetEmbeddingBatching(EmbeddingBatching{BatchSize: 10, MaxConcurrency: 3})
+
+	w := postEmbeddings(t, r, 95)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp embeddingBatchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Errors)
+	assert.Len(t, resp.Data, 95)
+	for i, embedding := range resp.Data {
+		assert.Equal(t, i, embedding.Index)
+		assert.Equal(t, []float64{float64(i)}, embedding.Embedding)
+	}
+	assert.Equal(t, 95, resp.Usage.PromptTokens)
+
+	assert.Len(t, provider.batchInputs, 10)
+	assert.LessOrEqual(t, provider.maxActive, 3)
+}
+
+func TestEmbeddingsReportFailedBatches(t *testing.T) {
+	provider := &embeddingProvider{
+		stubProvider: stubProvider{name: "openai"},
+		fail:         map[string]bool{"input-12": true},
+	}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+	r.SetEmbeddingBatching(EmbeddingBatching{BatchSize: 10, MaxConcurrency: 2})
+
+	w := postEmbeddings(t, r, 25)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp embeddingBatchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Data, 15)
+	assert.Equal(t, 9, resp.Data[9].Index)
+	assert.Equal(t, 20, resp.Data[10].Index)
+
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, []int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, resp.Errors[0].Indices)
+	assert.Contains(t, resp.Errors[0].Error, "upstream failed")
+}
+
+func TestEmbeddingsFailWhenEveryBatchFails(t *testing.T) {
+	provider := &embeddingProvider{
+		stubProvider: stubProvider{name: "openai"},
+		fail:         map[string]bool{"input-0": true},
+	}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+
+	w := postEmbeddings(t, r, 5)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "upstream failed")
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// upstreamRequestIDHeader carries the ID the provider assigned to a request,
+// which its support needs to look the request up
+const upstreamRequestIDHeader = "X-Upstream-Request-Id"
+
+// setUpstreamRequestID reports the provider's request ID, if known
+func setUpstreamRequestID(c *gin.Context, id string) {
+	if id != "" {
+		c.Header(upstreamRequestIDHeader, id)
+	}
+}
+
+// tagRequestID records the gateway request ID of ctx on a provider error.
+// It must be called where the error is created for a single request, before
+// it can be shared with coalesced requests.
+func tagRequestID(ctx context.Context, err error) error {
+	var providerErr *providers.ProviderError
+	if errors.As(err, &providerErr) && providerErr.GatewayRequestID == "" {
+		providerErr.GatewayRequestID = middleware.RequestIDFromContext(ctx)
+	}
+	return err
+}
+
+// respondError responds with an error in OpenAI's error envelope. The
+// kind of a provider failure is reported as the code, along with its
+// upstream request ID; requests rejected by a filter have the code
+// content_filter.
+func respondError(c *gin.Context, status int, err error) {
+	var providerErr *providers.ProviderError
+	if errors.As(err, &providerErr) {
+		setUpstreamRequestID(c, providerErr.RequestID)
+	}
+	c.AbortWithStatusJSON(status, errorResponse(status, err))
+}
+
+// errorResponse builds the error envelope of err, also sent as the error
+// event or frame of a failed stream
+func errorResponse(status int, err error) middleware.ErrorResponse {
+	resp := middleware.NewErrorResponse(status, err.Error())
+	var filterErr *FilterError
+	switch kind := providers.KindOf(err); {
+	case errors.As(err, &filterErr):
+		resp.Error.Code = "content_filter"
+	case kind != providers.ErrorKindUnknown:
+		resp.Error.Code = string(kind)
+	}
+	return resp
+}
+
+// statusForError maps a provider failure to the status returned to the
+// client. Upstream client errors (400, 401, 429, ...) are propagated since
+// the client can act on them; upstream server errors, network failures and
+// malformed responses become 502 Bad Gateway, and timeouts 504.
+func statusForError(err error) int {
+	var filterErr *FilterError
+	if errors.As(err, &filterErr) {
+		if filterErr.Status != 0 {
+			return filterErr.Status
+		}
+		return http.StatusUnprocessableEntity
+	}
+
+	var providerErr *providers.ProviderError
+	if errors.As(err, &providerErr) && providerErr.StatusCode != 0 {
+		if providerErr.StatusCode >= 400 && providerErr.StatusCode < 500 {
+			return providerErr.StatusCode
+		}
+		return http.StatusBadGateway
+	}
+
+	switch providers.KindOf(err) {
+	case providers.ErrorKindInvalidRequest, providers.ErrorKindUnsupported:
+		return http.StatusBadRequest
+	case providers.ErrorKindTimeout:
+		return http.StatusGatewayTimeout
+	case providers.ErrorKindServer, providers.ErrorKindNetwork, providers.ErrorKindDecode:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// postChat sends a chat request and decodes the error envelope of the
+// response
+func postChat(t *testing.T, r *Router, body string) (int, middleware.APIError) {
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	var resp middleware.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp.Error
+}
+
+func TestErrorsUseOpenAIEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	chat := `{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`
+
+	// Rate limited
+	r := NewRouter(nil, denyLimiter{})
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	status, apiErr := postChat(t, r, chat)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, middleware.APIError{Message: "user rate limit exceeded", Type: "rate_limit_error", Code: "rate_limit_exceeded"}, apiErr)
+
+	// Bad request
+	r = NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	status, apiErr = postChat(t, r, `{"messages":[{"role":"user","content":"Hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_request_error", apiErr.Type)
+	assert.Contains(t, apiErr.Message, "model is required")
+
+	// A provider failure is coded by its kind
+	r.RegisterProvider("openai", &stubProvider{name: "openai", err: &providers.ProviderError{Provider: "openai", StatusCode: 503}})
+	status, apiErr = postChat(t, r, chat)
+	assert.Equal(t, http.StatusBadGateway, status)
+	assert.Equal(t, "server_error", apiErr.Type)
+	assert.Equal(t, string(providers.ErrorKindServer), apiErr.Code)
+}
@@ -0,0 +1,164 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// ResponseFilter post-processes chat completions before they are cached and
+// returned, e.g. to moderate or redact them. Filter returns the response to
+// use, which may be resp itself, or an error to reject the response.
+type ResponseFilter interface {
+	Filter(ctx context.Context, resp *providers.ChatResponse) (*providers.ChatResponse, error)
+}
+
+// RequestFilter screens chat completion requests before they are
+// dispatched, e.g. against prompt injection. It may modify req in place,
+// or return an error to reject it.
+type RequestFilter interface {
+	Filter(ctx context.Context, req *providers.ChatRequest) error
+}
+
+// FilterError reports a request or response rejected by a filter; clients
+// get Status, 422 Unprocessable Entity by default, with the reason
+type FilterError struct {
+	Reason string
+	Status int
+}
+
+// Error implements the error interface
+func (e *FilterError) Error() string {
+	return "rejected by filter: " + e.Reason
+}
+
+// AddRequestFilter appends a filter to the chain run over every chat
+// completion request. Filters run in the order they were added and the
+// first rejection wins.
+func (r *Router) AddRequestFilter(filter RequestFilter) {
+	r.requestFilters = append(r.requestFilters, filter)
+}
+
+// filterRequest runs req through the request filters
+func (r *Router) filterRequest(ctx context.Context, req *providers.ChatRequest) error {
+	for _, filter := range r.requestFilters {
+		if err := filter.Filter(ctx, req); err != nil {
+			return asFilterError(err)
+		}
+	}
+	return nil
+}
+
+// AddResponseFilter appends a filter to the chain run over every response
+// served by a provider. Filters run in the order they were added.
+func (r *Router) AddResponseFilter(filter ResponseFilter) {
+	r.responseFilters = append(r.responseFilters, filter)
+}
+
+// filterResponse runs resp through the response filters
+func (r *Router) filterResponse(ctx context.Context, resp *providers.ChatResponse) (*providers.ChatResponse, error) {
+	for _, filter := range r.responseFilters {
+		filtered, err := filter.Filter(ctx, resp)
+		if err != nil {
+			return nil, asFilterError(err)
+		}
+		resp = filtered
+	}
+	return resp, nil
+}
+
+// asFilterError wraps errors other than FilterErrors into one, so every
+// rejection by a filter gets a filter status
+func asFilterError(err error) error {
+	var filterErr *FilterError
+	if errors.As(err, &filterErr) {
+		return err
+	}
+	return &FilterError{Reason: err.Error()}
+}
+
+// BannedPhraseFilter is a RequestFilter rejecting requests whose messages
+// contain any of its phrases, compared case-insensitively
+type BannedPhraseFilter struct {
+	phrases []string
+}
+
+// NewBannedPhraseFilter creates a filter banning the given phrases
+func NewBannedPhraseFilter(phrases []string) *BannedPhraseFilter {
+	f := &BannedPhraseFilter{}
+	for _, phrase := range phrases {
+		if phrase != "" {
+			f.phrases = append(f.phrases, strings.ToLower(phrase))
+		}
+	}
+	return f
+}
+
+// Filter rejects req with a 400 if a message contains a banned phrase. The
+// phrase is not echoed back, so probing the list takes more than one
+// request per guess.
+func (f *BannedPhraseFilter) Filter(ctx context.Context, req *providers.ChatRequest) error {
+	for i, msg := range req.Messages {
+		content := strings.ToLower(msg.Content)
+		for _, phrase := range f.phrases {
+			if strings.Contains(content, phrase) {
+				return &FilterError{Reason: fmt.Sprintf("messages[%d] contains a banned phrase", i), Status: http.StatusBadRequest}
+			}
+		}
+	}
+	return nil
+}
+
+// RedactionFilter is a ResponseFilter replacing every match of its patterns
+// in message content, e.g. email addresses or card numbers, with a fixed
+// replacement
+type RedactionFilter struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// NewRedactionFilter compiles the patterns of a redaction filter
+func NewRedactionFilter(patterns []string, replacement string) (*RedactionFilter, error) {
+	f := &RedactionFilter{replacement: replacement}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+// Filter redacts the content of every choice. The response is copied, so a
+// response shared with other callers is left untouched.
+func (f *RedactionFilter) Filter(ctx context.Context, resp *providers.ChatResponse) (*providers.ChatResponse, error) {
+	redacted := *resp
+	redacted.Choices = make([]providers.Choice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choice.Message.Content = f.redact(choice.Message.Content)
+		if choice.Message.Parts != nil {
+			parts := make([]providers.ContentPart, len(choice.Message.Parts))
+			for j, part := range choice.Message.Parts {
+				part.Text = f.redact(part.Text)
+				parts[j] = part
+			}
+			choice.Message.Parts = parts
+		}
+		redacted.Choices[i] = choice
+	}
+	return &redacted, nil
+}
+
+// redact replaces the matches of every pattern in s
+func (f *RedactionFilter) redact(s string) string {
+	for _, re := range f.patterns {
+		s = re.ReplaceAllString(s, f.replacement)
+	}
+	return s
+}
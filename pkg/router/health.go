@@ -0,0 +1,82 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// Dependency statuses reported by ReadinessCheck. Any other value is an
+// error description.
+const (
+	StatusOK       = "ok"
+	StatusDisabled = "disabled"
+	StatusDraining = "draining"
+)
+
+// readinessTimeout bounds each dependency probe
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck probes the router's dependencies and returns the status of
+// each: the response cache (disabled when the router runs without one,
+// pinged when it is remote) and the registered providers, which are not
+// ready once every enabled one fails its health probe. A draining router
+// also reports itself as such.
+func (r *Router) ReadinessCheck(ctx context.Context) map[string]string {
+	checks := make(map[string]string)
+
+	if r.Draining() {
+		checks["router"] = StatusDraining
+	}
+
+	switch backend := r.cache.(type) {
+	case nil:
+		checks["cache"] = StatusDisabled
+	case cache.Pinger:
+		pingCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		defer cancel()
+		if err := backend.Ping(pingCtx); err != nil {
+			checks["cache"] = err.Error()
+		} else {
+			checks["cache"] = StatusOK
+		}
+	default:
+		checks["cache"] = StatusOK
+	}
+
+	enabled := r.enabledProviders()
+	switch {
+	case len(enabled) == 0:
+		checks["providers"] = "no providers enabled"
+	case r.allProvidersDown(enabled):
+		checks["providers"] = "every provider failed its health probe"
+	default:
+		checks["providers"] = StatusOK
+	}
+
+	return checks
+}
+
+// allProvidersDown reports whether every provider failed its last health
+// probe
+func (r *Router) allProvidersDown(enabled map[string]providers.Provider) bool {
+	for name := range enabled {
+		if !r.providerDown(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready reports whether every dependency in a ReadinessCheck report is ok
+// or disabled
+func Ready(checks map[string]string) bool {
+	for _, status := range checks {
+		if status != StatusOK && status != StatusDisabled {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// userIDHeader names the header clients identify themselves with when no
+// auth middleware has identified them
+const userIDHeader = "X-User-ID"
+
+// UserIDResolver extracts the identity of the caller of a request, e.g.
+// from a JWT claim or a client certificate. An empty ID means the caller
+// could not be identified.
+type UserIDResolver interface {
+	ResolveUserID(c *gin.Context) string
+}
+
+// UserIDResolverFunc adapts a function to a UserIDResolver
+type UserIDResolverFunc func(c *gin.Context) string
+
+// ResolveUserID implements UserIDResolver
+func (f UserIDResolverFunc) ResolveUserID(c *gin.Context) string {
+	return f(c)
+}
+
+// DefaultUserIDResolver prefers the user ID set in the context by the auth
+// middleware, falling back to the X-User-ID header
+var DefaultUserIDResolver UserIDResolver = UserIDResolverFunc(func(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return userID
+	}
+	return c.GetHeader(userIDHeader)
+})
+
+// apiKeyID returns the APIKeyID of the API key or token a request was
+// authenticated with, set by the auth middleware; empty if there was none
+func apiKeyID(c *gin.Context) string {
+	return c.GetString("api_key_id")
+}
+
+// SetUserIDResolver sets how callers are identified; nil restores
+// DefaultUserIDResolver
+func (r *Router) SetUserIDResolver(resolver UserIDResolver) {
+	if resolver == nil {
+		resolver = DefaultUserIDResolver
+	}
+	r.userIDResolver = resolver
+}
+
+// userID returns the identity of the caller of a request
+func (r *Router) userID(c *gin.Context) string {
+	return r.userIDResolver.ResolveUserID(c)
+}
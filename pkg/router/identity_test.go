@@ -0,0 +1,80 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// keyLimiter allows every request, recording the users it was asked about
+type keyLimiter struct {
+	mu    sync.Mutex
+	users []string
+}
+
+func (l *keyLimiter) Allow(userID string, tokens int64) bool {
+	return l.AllowModel(userID, "", tokens)
+}
+
+func (l *keyLimiter) AllowModel(userID, model string, tokens int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.users = append(l.users, userID)
+	return true
+}
+
+func (l *keyLimiter) Stats(userID string) map[string]interface{} { return nil }
+
+// sendAs sends a chat request through a middleware that sets authUser as
+// the context user ID, with header as the X-User-ID header
+func sendAs(r *Router, authUser, header string) int {
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		if authUser != "" {
+			c.Set("user_id", authUser)
+		}
+		c.Next()
+	}, r.HandleChatCompletion)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+	if header != "" {
+		req.Header.Set("X-User-ID", header)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRouterUsesAuthUserID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := &keyLimiter{}
+	r := NewRouter(nil, limiter)
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+
+	// The auth middleware's ID wins over the header
+	assert.Equal(t, http.StatusOK, sendAs(r, "auth-user", "header-user"))
+	// Without auth the header is used
+	assert.Equal(t, http.StatusOK, sendAs(r, "", "header-user"))
+	// Without either the caller is rejected
+	assert.Equal(t, http.StatusUnauthorized, sendAs(r, "", ""))
+	assert.Equal(t, []string{"auth-user", "header-user"}, limiter.users)
+}
+
+func TestCustomUserIDResolver(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := &keyLimiter{}
+	r := NewRouter(nil, limiter)
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	r.SetUserIDResolver(UserIDResolverFunc(func(c *gin.Context) string {
+		return "tenant:" + c.GetHeader("X-User-ID")
+	}))
+
+	assert.Equal(t, http.StatusOK, sendAs(r, "auth-user", "header-user"))
+	assert.Equal(t, []string{"tenant:header-user"}, limiter.users)
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"go.uber.org/zap"
+)
+
+// Cache outcomes recorded in call logs
+const (
+	cacheHit         = "hit"
+	cacheSemanticHit = "semantic_hit"
+	cacheMiss        = "miss"
+	cacheStale       = "stale"
+	cacheBypass      = "bypass"
+)
+
+// errBudgetExceeded is logged when a request is refused by the budget limit
+var errBudgetExceeded = errors.New("monthly budget exceeded")
+
+// callLog collects what is known about one chat completion as the request
+// is handled
+type callLog struct {
+	requestID string
+	userID    string
+	provider  string
+	model     string
+	cache     string
+	stream    bool
+	fallback  bool
+	req       *providers.ChatRequest
+	resp      *providers.ChatResponse
+	err       error
+
+	// requestedModel is the model in the request body when X-Model-Override
+	// replaced it
+	requestedModel string
+}
+
+// served records the provider call that produced the response
+func (l *callLog) served(result *completion) {
+	l.fallback = result.model != l.model
+	l.provider = result.servedBy
+	l.model = result.model
+	l.resp = result.resp
+}
+
+// SetLogger sets the logger that receives one structured entry per chat
+// completion. Message and response content is redacted unless logContent
+// is set.
+func (r *Router) SetLogger(logger *zap.Logger, logContent bool) {
+	r.logger = logger
+	r.logContent = logContent
+}
+
+// logCall writes the log entry of a finished chat completion
+func (r *Router) logCall(l *callLog, latency time.Duration) {
+	fields := []zap.Field{
+		zap.String("request_id", l.requestID),
+		zap.String("user_id", l.userID),
+		zap.String("provider", l.provider),
+		zap.String("model", l.model),
+		zap.String("cache", l.cache),
+		zap.Bool("stream", l.stream),
+		zap.Bool("fallback", l.fallback),
+		zap.Duration("latency", latency),
+	}
+	if l.requestedModel != "" {
+		fields = append(fields, zap.String("requested_model", l.requestedModel))
+	}
+	if l.resp != nil {
+		fields = append(fields,
+			zap.Int("prompt_tokens", l.resp.Usage.PromptTokens),
+			zap.Int("completion_tokens", l.resp.Usage.CompletionTokens),
+		)
+	}
+	if r.logContent {
+		fields = append(fields, zap.Any("messages", l.req.Messages))
+		if l.resp != nil {
+			fields = append(fields, zap.Any("choices", l.resp.Choices))
+		}
+	}
+
+	if l.err != nil {
+		r.logger.Error("LLM call failed", append(fields, zap.Error(l.err))...)
+		return
+	}
+	r.logger.Info("LLM call", fields...)
+}
@@ -0,0 +1,169 @@
+package router
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// ProviderHealth is the health of a provider as measured by its last
+// probe. A provider is up if any of its backends answered.
+type ProviderHealth struct {
+	Name      string    `json:"name"`
+	Up        bool      `json:"up"`
+	LatencyMS int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// probeResult is the outcome of probing one backend
+type probeResult struct {
+	name    string
+	latency time.Duration
+	err     error
+}
+
+// StartHealthProbes probes every provider backend with a cheap request,
+// right away and then every interval until ctx is done. Providers whose
+// probes fail are tried after healthy ones when falling back, and
+// regional backends are chosen by their probed health and latency. A zero
+// interval disables probing.
+func (r *Router) StartHealthProbes(ctx context.Context, interval, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			r.probeProviders(ctx, timeout)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// probeProviders probes every backend concurrently and records the health
+// of each provider
+func (r *Router) probeProviders(ctx context.Context, timeout time.Duration) {
+	var names []string
+	var backends []weightedProvider
+	r.providersMu.RLock()
+	for name, named := range r.providers {
+		for _, b := range named {
+			names = append(names, name)
+			backends = append(backends, b)
+		}
+	}
+	r.providersMu.RUnlock()
+
+	results := make([]probeResult, len(backends))
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Add(1)
+		go func(i int, b weightedProvider) {
+			defer wg.Done()
+			latency, err := probeBackend(ctx, b, timeout)
+			results[i] = probeResult{name: names[i], latency: latency, err: err}
+		}(i, b)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	health := make(map[string]ProviderHealth)
+	for _, result := range results {
+		h := health[result.name]
+		h.Name, h.CheckedAt = result.name, now
+		latency := result.latency.Milliseconds()
+		if result.err != nil {
+			if !h.Up {
+				h.Error = result.err.Error()
+			}
+		} else if !h.Up || latency < h.LatencyMS {
+			h.Up, h.LatencyMS, h.Error = true, latency, ""
+		}
+		health[result.name] = h
+	}
+
+	r.healthMu.Lock()
+	r.health = health
+	r.healthMu.Unlock()
+
+	for _, h := range health {
+		middleware.RecordProviderHealth(h.Name, h.Up, time.Duration(h.LatencyMS)*time.Millisecond)
+	}
+}
+
+// probeBackend times a health check of a backend, calling its
+// HealthChecker if it has one and listing its models otherwise. Regional
+// backends keep the result for backend selection.
+func probeBackend(ctx context.Context, b weightedProvider, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	if checker, ok := b.provider.(providers.HealthChecker); ok {
+		err = checker.HealthCheck(ctx)
+	} else {
+		_, err = b.provider.Models(ctx)
+	}
+	latency := time.Since(start)
+
+	if b.probe != nil {
+		b.probe.down.Store(err != nil)
+		if err == nil {
+			b.probe.latency.Store(int64(latency))
+		}
+	}
+	return latency, err
+}
+
+// ProviderHealths lists the health of the probed providers by name. It is
+// empty until the first probe completes.
+func (r *Router) ProviderHealths() []ProviderHealth {
+	r.healthMu.RLock()
+	healths := make([]ProviderHealth, 0, len(r.health))
+	for _, h := range r.health {
+		healths = append(healths, h)
+	}
+	r.healthMu.RUnlock()
+
+	sort.Slice(healths, func(i, j int) bool {
+		return healths[i].Name < healths[j].Name
+	})
+	return healths
+}
+
+// providerDown reports whether the provider failed its last probe.
+// Providers not yet probed are assumed to be up.
+func (r *Router) providerDown(name string) bool {
+	r.healthMu.RLock()
+	defer r.healthMu.RUnlock()
+	h, ok := r.health[name]
+	return ok && !h.Up
+}
+
+// healthyFirst orders models so those served by providers that are up
+// come first, keeping their relative order. Models of providers that are
+// down are still tried last rather than not at all.
+func (r *Router) healthyFirst(models []string) []string {
+	ordered := make([]string, 0, len(models))
+	var down []string
+	for _, model := range models {
+		if r.providerDown(r.getProviderFromModel(model)) {
+			down = append(down, model)
+		} else {
+			ordered = append(ordered, model)
+		}
+	}
+	return append(ordered, down...)
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// flappingProvider fails every other health check, starting healthy
+type flappingProvider struct {
+	stubProvider
+	checks int
+}
+
+func (p *flappingProvider) HealthCheck(ctx context.Context) error {
+	p.checks++
+	if p.checks%2 == 0 {
+		return errors.New("service unavailable")
+	}
+	return nil
+}
+
+func TestHealthProbesTrackFlappingProvider(t *testing.T) {
+	openai := &flappingProvider{stubProvider: stubProvider{name: "openai"}}
+	anthropic := &stubProvider{name: "anthropic"}
+
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", openai)
+	r.RegisterProvider("anthropic", anthropic)
+	r.SetFallback("gpt-4", []string{"claude-3-opus-20240229"})
+
+	complete := func() string {
+		result, err := r.completeWithFallback(context.Background(), &providers.ChatRequest{Model: "gpt-4"})
+		assert.NoError(t, err)
+		return result.servedBy
+	}
+
+	// Healthy: the primary provider serves
+	r.probeProviders(context.Background(), time.Second)
+	health := r.ProviderHealths()
+	assert.Len(t, health, 2)
+	assert.Equal(t, "openai", health[1].Name)
+	assert.True(t, health[1].Up)
+	assert.Equal(t, "openai", complete())
+	assert.Equal(t, 1, openai.calls)
+
+	// Unhealthy: the fallback serves without the primary being tried
+	r.probeProviders(context.Background(), time.Second)
+	health = r.ProviderHealths()
+	assert.False(t, health[1].Up)
+	assert.Equal(t, "service unavailable", health[1].Error)
+	assert.Equal(t, "anthropic", complete())
+	assert.Equal(t, 1, openai.calls)
+	assert.Equal(t, StatusOK, r.ReadinessCheck(context.Background())["providers"])
+
+	// Healthy again: the primary serves once more
+	r.probeProviders(context.Background(), time.Second)
+	assert.True(t, r.ProviderHealths()[1].Up)
+	assert.Equal(t, "openai", complete())
+	assert.Equal(t, 2, openai.calls)
+}
+
+func TestDownProvidersAreStillTriedLast(t *testing.T) {
+	openai := &flappingProvider{stubProvider: stubProvider{name: "openai"}, checks: 1}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", openai)
+
+	r.probeProviders(context.Background(), time.Second)
+	assert.Equal(t, "every provider failed its health probe", r.ReadinessCheck(context.Background())["providers"])
+
+	// With nothing healthy to fall back to, the provider is tried anyway
+	result, err := r.completeWithFallback(context.Background(), &providers.ChatRequest{Model: "gpt-4"})
+	assert.NoError(t, err)
+	assert.Equal(t, "openai", result.servedBy)
+}
+
+func TestHandleProviderHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", &probedProvider{stubProvider: stubProvider{name: "openai"}, probeErr: errors.New("connection refused")})
+	r.probeProviders(context.Background(), time.Second)
+
+	engine := gin.New()
+	engine.GET("/admin/providers/health", r.HandleProviderHealth)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/admin/providers/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Providers []ProviderHealth `json:"providers"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Providers, 1)
+	assert.Equal(t, "openai", body.Providers[0].Name)
+	assert.False(t, body.Providers[0].Up)
+	assert.Equal(t, "connection refused", body.Providers[0].Error)
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// RateLimitWarningHeader is set on responses to requests allowed beyond
+// the user's soft rate limit
+const RateLimitWarningHeader = "X-RateLimit-Warning"
+
+// Errors naming the limit a rate limited request exceeded
+var (
+	errKeyRateLimited  = errors.New("API key rate limit exceeded")
+	errUserRateLimited = errors.New("user rate limit exceeded")
+)
+
+// SetKeyRateLimiter limits each API key, across models, in addition to
+// the user it belongs to, so a leaked key can't use up its user's limit.
+// It applies to requests authenticated by middleware.AuthMiddleware or
+// middleware.JWTAuthMiddleware, whose keys are tokens; nil disables key
+// limits.
+func (r *Router) SetKeyRateLimiter(limiter ratelimit.Limiter) {
+	r.keyRateLimiter = limiter
+}
+
+// SetRateLimitWait makes rate limited requests wait up to maxWait for the
+// limit to refill instead of failing immediately. It only applies to
+// limiters implementing ratelimit.Waiter; zero restores fail-fast
+// rejection. Safe to call while serving.
+func (r *Router) SetRateLimitWait(maxWait time.Duration) {
+	r.rateLimitWait.Store(int64(maxWait))
+}
+
+// SetRateLimitTokens makes the rate limit count tokens instead of requests,
+// so limits are sized in tokens per refill period or window. A request is
+// charged its estimated prompt tokens up front; once the provider reports
+// the tokens it used, the charge is corrected to match, for limiters
+// implementing ratelimit.Adjuster. Safe to call while serving.
+func (r *Router) SetRateLimitTokens(enabled bool) {
+	r.rateLimitTokens.Store(enabled)
+}
+
+// allowRequest applies the rate limits of a request: that of the API key
+// it was made with, if any, then that of the user and model. It must pass
+// both; a request the user's limit rejects is refunded its charge to the
+// key's limit where the limiter supports it. The decision is the user's,
+// and the error names the limit exceeded.
+func (r *Router) allowRequest(ctx context.Context, keyID, userID, model string, priority ratelimit.Priority, cost int64) (ratelimit.Decision, error) {
+	keyLimited := r.keyRateLimiter != nil && keyID != ""
+	if keyLimited && !r.allow(ctx, r.keyRateLimiter, keyID, "", priority, cost).Allowed {
+		return ratelimit.Decision{}, errKeyRateLimited
+	}
+	d := r.allow(ctx, r.rateLimiter, userID, model, priority, cost)
+	if !d.Allowed {
+		if adjuster, ok := r.keyRateLimiter.(ratelimit.Adjuster); ok && keyLimited {
+			adjuster.AdjustModel(keyID, "", -cost)
+		}
+		return d, errUserRateLimited
+	}
+	return d, nil
+}
+
+// allow applies a limiter's limit of an ID and model in a priority lane,
+// charging cost, and waiting for it if configured to. Limiters without
+// priority lanes treat every request alike, and those without soft limits
+// only report whether a request is allowed.
+func (r *Router) allow(ctx context.Context, limiter ratelimit.Limiter, id, model string, priority ratelimit.Priority, cost int64) ratelimit.Decision {
+	if waiter, ok := limiter.(ratelimit.Waiter); ok {
+		if maxWait := time.Duration(r.rateLimitWait.Load()); maxWait > 0 {
+			ctx, cancel := context.WithTimeout(ctx, maxWait)
+			defer cancel()
+			d, _ := waiter.WaitModel(ctx, id, model, cost, priority)
+			return d
+		}
+	}
+	if decider, ok := limiter.(ratelimit.Decider); ok {
+		return decider.DecideModel(id, model, cost, priority)
+	}
+	if lanes, ok := limiter.(ratelimit.PriorityLimiter); ok {
+		return ratelimit.Decision{Allowed: lanes.AllowModelWithPriority(id, model, cost, priority)}
+	}
+	return ratelimit.Decision{Allowed: limiter.AllowModel(id, model, cost)}
+}
+
+// rateLimit applies the rate limit to an HTTP request, responding 429 if
+// the hard limit is exceeded. Requests allowed beyond the soft limit are
+// counted and warned about with RateLimitWarningHeader.
+func (r *Router) rateLimit(c *gin.Context, userID, model string, priority ratelimit.Priority, cost int64) bool {
+	d, err := r.allowRequest(c.Request.Context(), apiKeyID(c), userID, model, priority, cost)
+	if err != nil {
+		middleware.RecordRateLimitExceeded(userID)
+		respondError(c, http.StatusTooManyRequests, err)
+		return false
+	}
+	if d.SoftExceeded {
+		middleware.RecordRateLimitWarning()
+		c.Header(RateLimitWarningHeader, fmt.Sprintf("soft rate limit exceeded, %d of %d remaining", d.Remaining, d.Limit))
+	}
+	return true
+}
+
+// chatRateLimitCost returns what a chat request is charged by the rate
+// limit: one request, or its estimated prompt tokens
+func (r *Router) chatRateLimitCost(req *providers.ChatRequest) int64 {
+	if !r.rateLimitTokens.Load() {
+		return 1
+	}
+	prompt, _ := estimateTokens(req)
+	return int64(prompt)
+}
+
+// embeddingRateLimitCost returns what an embeddings request is charged by
+// the rate limit: one request, or the estimated tokens of its inputs
+func (r *Router) embeddingRateLimitCost(req *providers.EmbeddingRequest) int64 {
+	if !r.rateLimitTokens.Load() {
+		return 1
+	}
+	var cost int64
+	for _, input := range req.Input {
+		cost += int64(len(input)+2) / 3
+	}
+	return max(cost, 1)
+}
+
+// reconcileRateLimit corrects the charge of a request counted in tokens to
+// the tokens the provider reports it used, for both the user's and the
+// API key's limits. Requests without reported usage keep the estimate.
+func (r *Router) reconcileRateLimit(c *gin.Context, userID, model string, charged int64, used int) {
+	if !r.rateLimitTokens.Load() || used <= 0 {
+		return
+	}
+	if adjuster, ok := r.rateLimiter.(ratelimit.Adjuster); ok {
+		adjuster.AdjustModel(userID, model, int64(used)-charged)
+	}
+	if adjuster, ok := r.keyRateLimiter.(ratelimit.Adjuster); ok {
+		if keyID := apiKeyID(c); keyID != "" {
+			adjuster.AdjustModel(keyID, "", int64(used)-charged)
+		}
+	}
+}
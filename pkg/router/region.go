@@ -0,0 +1,80 @@
+package router
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// servedRegionHeader names the region of the backend that served a request
+const servedRegionHeader = "X-Served-Region"
+
+// regionProbe is the health and latency of a regional backend as last
+// measured by a probe
+type regionProbe struct {
+	// latency is a time.Duration; zero until the first successful probe
+	latency atomic.Int64
+	down    atomic.Bool
+}
+
+// RegisterRegionalProvider adds a backend in a region under a logical
+// provider name. Requests for the name go to a healthy backend in the home
+// region, else to the healthy backend with the lowest probed latency, else
+// to the first backend registered.
+func (r *Router) RegisterRegionalProvider(name, region string, provider providers.Provider) {
+	r.providersMu.Lock()
+	defer r.providersMu.Unlock()
+	r.providers[name] = append(r.providers[name], weightedProvider{provider: provider, weight: 1, region: region, probe: &regionProbe{}})
+}
+
+// SetHomeRegion sets the region whose backends are preferred, normally the
+// one the gateway runs in
+func (r *Router) SetHomeRegion(region string) {
+	r.homeRegion = region
+}
+
+// selectRegional picks the backend of a regional provider to send a
+// request to
+func (r *Router) selectRegional(backends []weightedProvider) weightedProvider {
+	best := -1
+	for i, b := range backends {
+		if b.probe != nil && b.probe.down.Load() {
+			continue
+		}
+		if best < 0 || r.preferred(b, backends[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		// Every region is down; try anyway rather than fail outright
+		return backends[0]
+	}
+	return backends[best]
+}
+
+// preferred reports whether backend a is preferred to b: the home region
+// first, then the lowest probed latency. Backends not yet probed come last.
+func (r *Router) preferred(a, b weightedProvider) bool {
+	aHome, bHome := a.region == r.homeRegion, b.region == r.homeRegion
+	if aHome != bHome {
+		return aHome
+	}
+	aLatency, bLatency := a.latency(), b.latency()
+	if aLatency == 0 || bLatency == 0 {
+		return aLatency != 0
+	}
+	return aLatency < bLatency
+}
+
+// setServedRegion reports the region of the backend serving a request, for
+// regional providers
+func setServedRegion(c *gin.Context, provider, region string) {
+	if region == "" {
+		return
+	}
+	c.Header(servedRegionHeader, region)
+	middleware.RecordRegionRequest(provider, region)
+}
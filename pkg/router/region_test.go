@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// probedProvider answers probes after a delay, or fails them
+type probedProvider struct {
+	stubProvider
+	delay    time.Duration
+	probeErr error
+}
+
+func (p *probedProvider) Models(ctx context.Context) ([]providers.ModelInfo, error) {
+	time.Sleep(p.delay)
+	return nil, p.probeErr
+}
+
+func newRegionalRouter(home string, backends map[string]*probedProvider) *Router {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.SetHomeRegion(home)
+	for _, region := range []string{"us-east", "eu-west", "ap-south"} {
+		if backend, ok := backends[region]; ok {
+			r.RegisterRegionalProvider("openai", region, backend)
+		}
+	}
+	return r
+}
+
+func TestRegionalProviderPrefersHomeRegion(t *testing.T) {
+	r := newRegionalRouter("eu-west", map[string]*probedProvider{
+		"us-east": {stubProvider: stubProvider{name: "openai"}},
+		"eu-west": {stubProvider: stubProvider{name: "openai"}, delay: 20 * time.Millisecond},
+	})
+	r.probeProviders(context.Background(), time.Second)
+
+	// The home region wins even though it is slower
+	backend, ok := r.getBackend("openai")
+	assert.True(t, ok)
+	assert.Equal(t, "eu-west", backend.region)
+}
+
+func TestRegionalProviderFailsOverWhenHomeRegionIsDown(t *testing.T) {
+	r := newRegionalRouter("us-east", map[string]*probedProvider{
+		"us-east":  {stubProvider: stubProvider{name: "openai"}, probeErr: errors.New("connection refused")},
+		"eu-west":  {stubProvider: stubProvider{name: "openai"}, delay: 20 * time.Millisecond},
+		"ap-south": {stubProvider: stubProvider{name: "openai"}},
+	})
+	r.probeProviders(context.Background(), time.Second)
+
+	// The healthy region with the lowest latency is chosen
+	backend, _ := r.getBackend("openai")
+	assert.Equal(t, "ap-south", backend.region)
+}
+
+func TestRegionalProviderRecoversAfterProbeSucceeds(t *testing.T) {
+	home := &probedProvider{stubProvider: stubProvider{name: "openai"}, probeErr: errors.New("timeout")}
+	r := newRegionalRouter("us-east", map[string]*probedProvider{
+		"us-east": home,
+		"eu-west": {stubProvider: stubProvider{name: "openai"}},
+	})
+	r.probeProviders(context.Background(), time.Second)
+	backend, _ := r.getBackend("openai")
+	assert.Equal(t, "eu-west", backend.region)
+
+	home.probeErr = nil
+	r.probeProviders(context.Background(), time.Second)
+	backend, _ = r.getBackend("openai")
+	assert.Equal(t, "us-east", backend.region)
+}
+
+func TestRegionalProviderTriesFirstBackendWhenAllAreDown(t *testing.T) {
+	down := errors.New("connection refused")
+	r := newRegionalRouter("", map[string]*probedProvider{
+		"us-east": {stubProvider: stubProvider{name: "openai"}, probeErr: down},
+		"eu-west": {stubProvider: stubProvider{name: "openai"}, probeErr: down},
+	})
+	r.probeProviders(context.Background(), time.Second)
+
+	backend, ok := r.getBackend("openai")
+	assert.True(t, ok)
+	assert.Equal(t, "us-east", backend.region)
+}
+
+func TestServedRegionHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := newRegionalRouter("eu-west", map[string]*probedProvider{
+		"us-east": {stubProvider: stubProvider{name: "openai"}},
+		"eu-west": {stubProvider: stubProvider{name: "openai"}},
+	})
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	w := sendChat(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "openai", w.Header().Get("X-Served-By"))
+	assert.Equal(t, "eu-west", w.Header().Get(servedRegionHeader))
+}
+
+func TestStartHealthProbesProbesRightAway(t *testing.T) {
+	home := &probedProvider{stubProvider: stubProvider{name: "openai"}, probeErr: errors.New("timeout")}
+	r := newRegionalRouter("us-east", map[string]*probedProvider{"us-east": home})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.StartHealthProbes(ctx, time.Hour, time.Second)
+	defer cancel()
+
+	// The first probe runs right away
+	assert.Eventually(t, func() bool {
+		backend, _ := r.getBackend("openai")
+		return backend.probe.down.Load()
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// ProviderStatus describes a registered provider
+type ProviderStatus struct {
+	Name     string `json:"name"`
+	Backends int    `json:"backends"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// UnregisterProvider removes every backend registered under name; requests
+// for its models are rejected from then on
+func (r *Router) UnregisterProvider(name string) {
+	r.providersMu.Lock()
+	defer r.providersMu.Unlock()
+	delete(r.providers, name)
+	delete(r.disabledProviders, name)
+}
+
+// SetProviderEnabled disables a registered provider, e.g. a misbehaving
+// backend, without unregistering it, or enables it again. Disabled
+// providers are skipped like unregistered ones.
+func (r *Router) SetProviderEnabled(name string, enabled bool) error {
+	r.providersMu.Lock()
+	defer r.providersMu.Unlock()
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("provider not registered: %s", name)
+	}
+	if enabled {
+		delete(r.disabledProviders, name)
+	} else {
+		r.disabledProviders[name] = true
+	}
+	return nil
+}
+
+// ProviderStatuses lists the registered providers by name
+func (r *Router) ProviderStatuses() []ProviderStatus {
+	r.providersMu.RLock()
+	statuses := make([]ProviderStatus, 0, len(r.providers))
+	for name, backends := range r.providers {
+		statuses = append(statuses, ProviderStatus{Name: name, Backends: len(backends), Enabled: !r.disabledProviders[name]})
+	}
+	r.providersMu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// enabledProviders returns the first backend of every enabled provider;
+// weighted backends share a name and serve the same models
+func (r *Router) enabledProviders() map[string]providers.Provider {
+	r.providersMu.RLock()
+	defer r.providersMu.RUnlock()
+	enabled := make(map[string]providers.Provider, len(r.providers))
+	for name, backends := range r.providers {
+		if !r.disabledProviders[name] {
+			enabled[name] = backends[0].provider
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,144 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+func TestProviderAdminEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	r.RegisterProvider("anthropic", &stubProvider{name: "anthropic"})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	engine.GET("/admin/providers", r.HandleListProviders)
+	engine.POST("/admin/providers/:name/enable", r.HandleProviderEnable)
+	engine.POST("/admin/providers/:name/disable", r.HandleProviderDisable)
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/admin/providers/openai/disable").Code)
+	var body struct {
+		Providers []ProviderStatus `json:"providers"`
+	}
+	assert.NoError(t, json.Unmarshal(send("GET", "/admin/providers").Body.Bytes(), &body))
+	assert.Equal(t, []ProviderStatus{{Name: "anthropic", Backends: 1, Enabled: true}, {Name: "openai", Backends: 1, Enabled: false}}, body.Providers)
+	assert.Equal(t, http.StatusBadRequest, sendChat(engine).Code, "disabled providers serve no requests")
+
+	assert.Equal(t, http.StatusOK, send("POST", "/admin/providers/openai/enable").Code)
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+
+	assert.Equal(t, http.StatusNotFound, send("POST", "/admin/providers/mistral/disable").Code)
+}
+
+func TestUnregisterProvider(t *testing.T) {
+	r := NewRouter(nil, nil)
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	assert.NoError(t, r.SetProviderEnabled("openai", false))
+
+	r.UnregisterProvider("openai")
+	_, ok := r.getProvider("openai")
+	assert.False(t, ok)
+	assert.Empty(t, r.ProviderStatuses())
+	assert.Equal(t, "no providers enabled", r.ReadinessCheck(context.Background())["providers"])
+}
+
+// Run with -race: providers change while requests are served
+func TestProviderRegistrationWhileServing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(1000, 1000))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	engine.GET("/v1/models", r.HandleListModels)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			r.UnregisterProvider("openai")
+			r.RegisterWeightedProvider("openai", &stubProvider{name: "openai"}, 1)
+			r.RegisterWeightedProvider("openai", &stubProvider{name: "openai"}, 2)
+			r.SetProviderEnabled("openai", i%2 == 0)
+			r.ProviderStatuses()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","temperature":0.5,"messages":[{"role":"user","content":"Hi"}]}`))
+			req.Header.Set("X-User-ID", "test-user")
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+			engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+		}
+	}()
+	wg.Wait()
+}
+
+// statelessProvider answers every request without recording it, so it can
+// serve concurrent requests
+type statelessProvider struct {
+	stubProvider
+}
+
+func (s *statelessProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	return &providers.ChatResponse{ID: s.name + "-1", Model: req.Model}, nil
+}
+
+// Run with -race: new provider names are registered while concurrent
+// completions, fallbacks and readiness checks read the providers
+func TestRegisterProviderRacesWithCompletions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10000, 10000))
+	r.RegisterProvider("openai", &statelessProvider{stubProvider{name: "openai"}})
+	r.SetFallback("gpt-4", []string{"claude-3-opus"})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			r.RegisterProvider(fmt.Sprintf("backend-%d", i), &statelessProvider{stubProvider{name: "backend"}})
+			r.RegisterProvider("openai", &statelessProvider{stubProvider{name: "openai"}})
+			r.RegisterProvider("anthropic", &statelessProvider{stubProvider{name: "anthropic"}})
+		}
+	}()
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				body := fmt.Sprintf(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi %d-%d"}]}`, worker, i)
+				req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+				req.Header.Set("X-User-ID", "test-user")
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				assert.Equal(t, http.StatusOK, w.Code)
+				r.ReadinessCheck(context.Background())
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
@@ -1,114 +1,813 @@
 package router
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math/rand"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 // Router handles routing requests to appropriate providers
 type Router struct {
-	providers   map[string]providers.Provider
-	cache       *cache.RedisCache
-	rateLimiter *ratelimit.RateLimiter
+	// Provider backends keyed by name, and the names disabled at runtime;
+	// both may change while requests are served
+	providers         map[string][]weightedProvider
+	disabledProviders map[string]bool
+	providersMu       sync.RWMutex
+
+	// Region whose backends regional providers prefer
+	homeRegion string
+
+	cache       cache.Cache
+	rateLimiter ratelimit.Limiter
+
+	// Optional limit of each API key across models, applied before the
+	// user's
+	keyRateLimiter ratelimit.Limiter
+
+	// How long a rate limited request may wait for the limit to refill,
+	// as a time.Duration; zero rejects immediately
+	rateLimitWait atomic.Int64
+
+	// Whether the rate limit counts tokens rather than requests
+	rateLimitTokens atomic.Bool
+
+	// How long streamed completions may stall
+	streamTimeouts StreamTimeouts
+
+	// Model-to-provider routing rules, checked before the defaults
+	modelRoutes []ModelRoute
+	routesMu    sync.RWMutex
+
+	// Catch-all provider for models no route matches; empty rejects them
+	defaultProvider  string
+	fallthroughs     sync.Map
+	fallthroughCount atomic.Int32
+
+	// Concrete models keyed by alias
+	modelAliases map[string]string
+
+	// Default request parameters keyed by provider
+	providerDefaults map[string]ProviderDefaults
+
+	// Size limits of chat completion requests
+	limits RequestLimits
+
+	// Splitting of embeddings requests into concurrent provider calls
+	embeddingBatching EmbeddingBatching
+
+	// Cache TTL overrides keyed by model prefix
+	cacheTTLs map[string]time.Duration
+
+	// Whether cached responses are kept per user rather than shared
+	perUserCache bool
+
+	// How long stale copies of cached responses are kept for serving when
+	// providers fail; zero disables them
+	staleTTL time.Duration
+
+	// Ordered fallback models keyed by primary model
+	fallbacks map[string][]string
+
+	// Provider health keyed by name, as last probed
+	health   map[string]ProviderHealth
+	healthMu sync.RWMutex
+
+	// Identifies the caller of each request
+	userIDResolver UserIDResolver
+
+	// Optional per-user usage accounting
+	usageTracker usage.Recorder
+	budget       *usage.BudgetLimit
+
+	// Optional sources of the usage reported by HandleUsage
+	usageStats   usage.StatsReader
+	usageHistory usage.UsageHistory
+
+	// Optional restriction of which models a user may call
+	modelPolicy *middleware.ModelAccessPolicy
+
+	// Optional similarity-based cache layered over exact-match caching
+	semanticCache  *cache.SemanticCache
+	semanticConfig SemanticCacheConfig
+
+	// Structured per-call logging; message content is only logged if
+	// logContent is set
+	logger     *zap.Logger
+	logContent bool
+
+	// Creates the cache lookup and provider call spans
+	tracer trace.Tracer
+
+	// Deduplicates concurrent identical upstream calls
+	inflight singleflight.Group
+
+	// Tracks in-flight streams for graceful shutdown
+	streams streamTracker
+
+	// Screening of requests before dispatch, and post-processing of
+	// provider responses before caching
+	requestFilters  []RequestFilter
+	responseFilters []ResponseFilter
+
+	// Optional mirroring of served requests to a shadow provider;
+	// shadowSlots bounds the shadow calls in flight
+	shadow      ShadowConfig
+	shadowSlots chan struct{}
+
+	// Random source for weighted provider selection
+	rand   *rand.Rand
+	randMu sync.Mutex
 }
 
-// NewRouter creates a new router
-func NewRouter(cache *cache.RedisCache, rateLimiter *ratelimit.RateLimiter) *Router {
-	return &Router{
-		providers:   make(map[string]providers.Provider),
-		cache:       cache,
-		rateLimiter: rateLimiter,
+// NewRouter creates a new router. Any cache.Cache may be used, such as a
+// RedisCache or an InMemoryCache, and any ratelimit.Limiter, such as the
+// token bucket RateLimiter or a SlidingWindowLimiter. A nil cache disables
+// response caching.
+func NewRouter(cache cache.Cache, rateLimiter ratelimit.Limiter) *Router {
+	r := &Router{
+		providers:         make(map[string][]weightedProvider),
+		disabledProviders: make(map[string]bool),
+		cache:             cache,
+		rateLimiter:       rateLimiter,
+		limits:            DefaultRequestLimits(),
+		embeddingBatching: DefaultEmbeddingBatching(),
+		modelAliases:      make(map[string]string),
+		providerDefaults:  make(map[string]ProviderDefaults),
+		cacheTTLs:         make(map[string]time.Duration),
+		fallbacks:         make(map[string][]string),
+		userIDResolver:    DefaultUserIDResolver,
+		logger:            zap.NewNop(),
+		tracer:            otel.Tracer(tracerName),
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for alias, model := range defaultModelAliases {
+		r.modelAliases[alias] = model
 	}
+	return r
 }
 
-// RegisterProvider registers a provider
+// RegisterProvider registers a provider, replacing any backends previously
+// registered under the same name. It is safe to call while requests are
+// being served.
 func (r *Router) RegisterProvider(name string, provider providers.Provider) {
-	r.providers[name] = provider
+	r.providersMu.Lock()
+	defer r.providersMu.Unlock()
+	r.providers[name] = []weightedProvider{{provider: provider, weight: 1}}
+}
+
+// SetFallback configures the models to try, in order, when the provider
+// serving the primary model fails with a retryable error
+func (r *Router) SetFallback(primary string, fallbacks []string) {
+	r.fallbacks[primary] = fallbacks
+}
+
+// SetUsageTracker records the token usage and cost of every completion,
+// with a UsageTracker or a UsageWriter batching records for one
+func (r *Router) SetUsageTracker(tracker usage.Recorder) {
+	r.usageTracker = tracker
+}
+
+// usageRecord returns the usage record of a completion
+func usageRecord(userID, provider, model string, u providers.Usage) usage.Record {
+	return usage.Record{
+		UserID:           userID,
+		Provider:         provider,
+		Model:            model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     u.CachedTokens(),
+		ReasoningTokens:  u.ReasoningTokens(),
+	}
+}
+
+// SetModelAccessPolicy restricts which models each user may call. The
+// policy is enforced after the request body is parsed, since the model is
+// part of the body.
+func (r *Router) SetModelAccessPolicy(policy *middleware.ModelAccessPolicy) {
+	r.modelPolicy = policy
 }
 
 // HandleChatCompletion handles chat completion requests
 func (r *Router) HandleChatCompletion(c *gin.Context) {
-	// Extract user ID from header or auth token
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user ID"})
+	if r.refuseWhileDraining(c) {
 		return
 	}
 
-	// Rate limiting
-	if !r.rateLimiter.Allow(userID, 1) {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+	userID := r.userID(c)
+	if userID == "" {
+		respondError(c, http.StatusUnauthorized, errors.New("missing user ID"))
 		return
 	}
 
-	// Parse request
+	// Parse and validate request
+	start := time.Now()
+	if r.limits.MaxBodyBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, r.limits.MaxBodyBytes)
+	}
 	var req providers.ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := r.validateChatRequest(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := r.filterRequest(c.Request.Context(), &req); err != nil {
+		respondError(c, statusForError(err), err)
+		return
+	}
+	req.Model = r.resolveModel(req.Model)
+
+	// Authorized users can force another model, e.g. for A/B tests; for
+	// everyone else the header is ignored
+	var requestedModel string
+	if override := c.GetHeader(modelOverrideHeader); override != "" && canOverrideModel(c) {
+		requestedModel, req.Model = req.Model, r.resolveModel(override)
+		middleware.RecordModelOverride(requestedModel, req.Model)
+	}
+	r.applyProviderDefaults(&req)
+
+	// stream_options is only valid on streamed requests
+	if !req.Stream {
+		req.StreamOptions = nil
+	}
+
+	// Authorization
+	if !r.modelAllowed(c, userID, req.Model) {
+		respondError(c, http.StatusForbidden, errors.New("model not allowed: "+req.Model))
+		return
+	}
+
+	// Rate limiting, per user and model, in the lane given by X-Priority
+	priority, err := ratelimit.ParsePriority(c.GetHeader("X-Priority"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	rateLimitCost := r.chatRateLimitCost(&req)
+	if !r.rateLimit(c, userID, req.Model, priority, rateLimitCost) {
 		return
 	}
 
 	// Determine provider from model name
 	providerName := r.getProviderFromModel(req.Model)
-	provider, ok := r.providers[providerName]
+	backend, ok := r.getBackend(providerName)
 	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported model: " + req.Model})
+		respondError(c, http.StatusBadRequest, errors.New("unsupported model: "+req.Model))
 		return
 	}
+	provider := backend.provider
 
-	// Check cache (only for non-streaming requests)
-	if !req.Stream {
-		cacheKey := r.generateCacheKey(&req)
-		var cachedResp providers.ChatResponse
-		if err := r.cache.Get(c.Request.Context(), cacheKey, &cachedResp); err == nil {
-			// Cache hit
-			c.JSON(http.StatusOK, cachedResp)
+	// Every request that reaches a provider or the cache is logged once done
+	call := &callLog{requestID: middleware.RequestIDFromContext(c.Request.Context()), userID: userID, provider: providerName, model: req.Model, requestedModel: requestedModel, req: &req, cache: cacheBypass}
+	defer func() { r.logCall(call, time.Since(start)) }()
+
+	// Check cache; streaming and non-streaming requests share entries.
+	// An empty key means the response is neither read from nor written to
+	// the cache.
+	var cacheKey string
+	if Cacheable(&req) && !noStore(c) {
+		cacheKey = r.cacheNamespace(userID) + r.generateCacheKey(&req)
+		call.cache = cacheMiss
+	}
+	var cachedResp providers.ChatResponse
+	if err := r.tracedCacheGet(c.Request.Context(), cacheKey, &cachedResp); err == nil {
+		// Cache hit
+		call.cache = cacheHit
+		call.resp = &cachedResp
+		if req.Stream {
+			r.replayStream(c, &cachedResp)
+			return
+		}
+		c.JSON(http.StatusOK, cachedResp)
+		return
+	}
+
+	// Budget enforcement, from a conservative estimate of the request cost.
+	// Users without a cap skip the estimate.
+	if r.budget != nil && r.budget.Cap(userID) > 0 {
+		promptTokens, completionTokens := estimateTokens(&req)
+		allowed, err := r.budget.Allow(userID, r.budget.EstimateCost(req.Model, promptTokens, completionTokens))
+		if err != nil {
+			call.err = err
+			respondError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !allowed {
+			call.err = errBudgetExceeded
+			respondError(c, http.StatusPaymentRequired, errors.New("monthly budget exceeded"))
 			return
 		}
 	}
 
-	// Call provider
-	resp, err := provider.ChatCompletion(&req)
+	// Streaming requests are relayed chunk by chunk and cached once complete
+	if req.Stream {
+		call.stream = true
+		setServedRegion(c, providerName, backend.region)
+		call.resp, call.err = r.streamChatCompletion(c, userID, provider, &req, cacheKey)
+		if call.resp != nil {
+			r.reconcileRateLimit(c, userID, req.Model, rateLimitCost, call.resp.Usage.TotalTokens)
+		}
+		if call.err == nil {
+			r.mirror(&req)
+		}
+		return
+	}
+
+	// Fall back to a semantic lookup on an exact-match miss
+	var promptVector []float64
+	if r.semanticCache != nil && cacheKey != "" {
+		promptVector = r.embedPrompt(c.Request.Context(), &req)
+		if promptVector != nil {
+			err := r.semanticCache.Lookup(c.Request.Context(), r.semanticNamespace(userID, &req), promptVector, r.semanticConfig.SimilarityThreshold, &cachedResp)
+			if err == nil {
+				call.cache = cacheSemanticHit
+				call.resp = &cachedResp
+				c.JSON(http.StatusOK, cachedResp)
+				return
+			}
+		}
+	}
+
+	// Call provider, falling back to alternatives on retryable failures
+	complete := func(ctx context.Context) (*completion, error) {
+		result, err := r.completeWithFallback(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		resp := result.resp
+
+		if r.usageTracker != nil {
+			if err := r.usageTracker.Record(usageRecord(userID, result.servedBy, resp.Model, resp.Usage)); err != nil {
+				log.Printf("Failed to record usage: %v", err)
+			}
+		}
+
+		// Filters see the response before it is cached, so cache hits are
+		// filtered too
+		resp, err = r.filterResponse(ctx, resp)
+		if err != nil {
+			return nil, err
+		}
+		result.resp = resp
+
+		// Cache response (only for non-streaming)
+		if err := r.cacheChatResponse(ctx, cacheKey, resp, r.cacheTTL(req.Model)); err == nil && promptVector != nil {
+			r.semanticCache.Store(r.semanticNamespace(userID, &req), promptVector, cacheKey)
+		}
+
+		return result, nil
+	}
+
+	var result *completion
+	if cacheKey != "" {
+		result, err = r.completeOnce(c.Request.Context(), cacheKey, req.Model, complete)
+	} else {
+		result, err = complete(c.Request.Context())
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		call.err = err
+		if stale, ok := r.serveStale(c, cacheKey, err); ok {
+			call.cache = cacheStale
+			call.resp = stale
+			return
+		}
+		respondError(c, statusForError(err), err)
 		return
 	}
+	call.served(result)
+	r.reconcileRateLimit(c, userID, req.Model, rateLimitCost, result.resp.Usage.TotalTokens)
+	c.Header("X-Served-By", result.servedBy)
+	setServedRegion(c, result.servedBy, result.region)
+	setUpstreamRequestID(c, result.resp.UpstreamRequestID)
 
-	// Cache response (only for non-streaming)
-	if !req.Stream {
-		cacheKey := r.generateCacheKey(&req)
-		_ = r.cache.Set(c.Request.Context(), cacheKey, resp)
+	c.JSON(http.StatusOK, result.resp)
+	r.mirror(&req)
+}
+
+// completion is a provider response with the provider and model that
+// served it
+type completion struct {
+	resp     *providers.ChatResponse
+	servedBy string
+	model    string
+
+	// region is the region of the backend, for regional providers
+	region string
+}
+
+// completeOnce runs complete at most once at a time per cache key.
+// Concurrent identical requests wait for the in-flight call and share its
+// response or error, so a burst of cache misses costs one upstream call. The
+// shared call is detached from the cancellation of whichever request started
+// it, so one client going away doesn't fail the others; the provider timeout
+// and the starting request's deadline, if any, still bound it. Requests
+// joining another's call are counted in request_coalesced_total by model.
+func (r *Router) completeOnce(ctx context.Context, key, model string, complete func(context.Context) (*completion, error)) (*completion, error) {
+	var started bool
+	ch := r.inflight.DoChan(key, func() (interface{}, error) {
+		started = true
+		defer middleware.TrackCoalescingGroup()()
+
+		shared := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			shared, cancel = context.WithDeadline(shared, deadline)
+			defer cancel()
+		}
+		return complete(shared)
+	})
+
+	select {
+	case res := <-ch:
+		if !started {
+			middleware.RecordRequestCoalesced(model)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*completion), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
+
+// modelAllowed checks the model access policy, using the scopes set by the
+// JWT auth middleware if present
+func (r *Router) modelAllowed(c *gin.Context, userID, model string) bool {
+	if r.modelPolicy == nil {
+		return true
+	}
+	return r.modelPolicy.Allowed(userID, c.GetStringSlice("scopes"), model)
+}
+
+// completeWithFallback calls the provider for the requested model and then
+// each configured fallback model in order until one succeeds. Models whose
+// provider failed its last health probe are tried last. It returns the
+// response along with the provider and model that served it. Non-retryable
+// errors are returned immediately. Provider calls are bound to ctx, so a
+// client disconnect or deadline aborts the upstream request.
+func (r *Router) completeWithFallback(ctx context.Context, req *providers.ChatRequest) (*completion, error) {
+	models := r.healthyFirst(append([]string{req.Model}, r.fallbacks[req.Model]...))
+
+	var lastErr error
+	for _, model := range models {
+		providerName := r.getProviderFromModel(model)
+		backend, ok := r.getBackend(providerName)
+		if !ok {
+			continue
+		}
+
+		attempt := *req
+		attempt.Model = model
+
+		resp, err := r.tracedChatCompletion(ctx, backend.provider, &attempt, false)
+		if err == nil {
+			return &completion{resp: resp, servedBy: providerName, model: model, region: backend.region}, nil
+		}
+		if !providers.IsRetryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no provider available for model: %s", req.Model)
+	}
+	return nil, lastErr
+}
+
+// HandleEmbeddings handles embeddings requests
+func (r *Router) HandleEmbeddings(c *gin.Context) {
+	if r.refuseWhileDraining(c) {
+		return
+	}
+
+	userID := r.userID(c)
+	if userID == "" {
+		respondError(c, http.StatusUnauthorized, errors.New("missing user ID"))
+		return
+	}
+
+	var req providers.EmbeddingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Input) == 0 {
+		respondError(c, http.StatusBadRequest, errors.New("input must not be empty"))
+		return
+	}
+
+	if !r.modelAllowed(c, userID, req.Model) {
+		respondError(c, http.StatusForbidden, errors.New("model not allowed: "+req.Model))
+		return
+	}
+
+	priority, err := ratelimit.ParsePriority(c.GetHeader("X-Priority"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	rateLimitCost := r.embeddingRateLimitCost(&req)
+	if !r.rateLimit(c, userID, req.Model, priority, rateLimitCost) {
+		return
+	}
+
+	providerName := r.getProviderFromModel(req.Model)
+	provider, ok := r.getProvider(providerName)
+	if !ok {
+		respondError(c, http.StatusBadRequest, errors.New("unsupported model: "+req.Model))
+		return
+	}
+
+	// Embeddings are deterministic, so identical inputs are always cacheable
+	cacheKey := r.cacheNamespace(userID) + r.generateEmbeddingCacheKey(&req)
+	var cachedResp providers.EmbeddingResponse
+	if err := r.cacheGet(c.Request.Context(), cacheKey, &cachedResp); err == nil {
+		c.JSON(http.StatusOK, cachedResp)
+		return
+	}
+
+	// Large inputs are split into batches; if only some batches fail the
+	// response carries the embeddings that succeeded and the failed indices
+	resp, failures, err := r.embedBatched(c.Request.Context(), provider, &req)
+	if err != nil {
+		respondError(c, statusForError(err), err)
+		return
+	}
+	r.reconcileRateLimit(c, userID, req.Model, rateLimitCost, resp.Usage.TotalTokens)
+	if len(failures) > 0 {
+		c.JSON(http.StatusOK, embeddingBatchResponse{EmbeddingResponse: resp, Errors: failures})
+		return
+	}
+
+	_ = r.cacheSet(c.Request.Context(), cacheKey, resp, 0)
 
 	c.JSON(http.StatusOK, resp)
 }
 
-// getProviderFromModel determines the provider from the model name
-func (r *Router) getProviderFromModel(model string) string {
-	if strings.HasPrefix(model, "gpt-") {
-		return "openai"
+// tokenizeRequest is the body of a tokenize request
+type tokenizeRequest struct {
+	Model    string              `json:"model" binding:"required"`
+	Messages []providers.Message `json:"messages"`
+}
+
+// HandleTokenize counts the prompt tokens of a request without sending it
+func (r *Router) HandleTokenize(c *gin.Context) {
+	var req tokenizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
 	}
-	if strings.HasPrefix(model, "claude-") {
-		return "anthropic"
+
+	tokens, err := providers.CountTokens(req.Model, req.Messages)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
 	}
-	// Add more providers as needed
-	return "openai" // default
+
+	c.JSON(http.StatusOK, gin.H{
+		"model":  req.Model,
+		"tokens": tokens,
+	})
 }
 
-// generateCacheKey generates a cache key from the request
+// HandleListModels lists the models of all registered providers in the
+// OpenAI list format
+func (r *Router) HandleListModels(c *gin.Context) {
+	models := []providers.ModelInfo{}
+	for name, provider := range r.enabledProviders() {
+		providerModels, err := provider.Models(c.Request.Context())
+		if err != nil {
+			// One unreachable provider shouldn't hide the others
+			log.Printf("Failed to list models for provider %s: %v", name, err)
+			continue
+		}
+		models = append(models, providerModels...)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   models,
+	})
+}
+
+// errNoCache is returned by the cache helpers when the router has no cache
+var errNoCache = errors.New("cache disabled")
+
+// cacheGet reads a cached response. A nil cache or empty key always misses.
+func (r *Router) cacheGet(ctx context.Context, key string, dest interface{}) error {
+	if r.cache == nil || key == "" {
+		return errNoCache
+	}
+	return r.cache.Get(ctx, key, dest)
+}
+
+// cacheSet stores a response, with the cache's default TTL if ttl is zero.
+// A nil cache or empty key stores nothing.
+func (r *Router) cacheSet(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if r.cache == nil || key == "" {
+		return errNoCache
+	}
+	if ttl <= 0 {
+		return r.cache.Set(ctx, key, value)
+	}
+	return r.cache.SetWithTTL(ctx, key, value, ttl)
+}
+
+// SetPerUserCache keeps cached responses per user, so identical requests
+// of different users never share an entry and concurrent ones aren't
+// coalesced into one call. When disabled, as by default, responses are
+// shared across users, which saves the most in single-tenant deployments.
+func (r *Router) SetPerUserCache(enabled bool) {
+	r.perUserCache = enabled
+}
+
+// cacheNamespace returns the prefix of the cache keys of a user's
+// responses: the user's own prefix with a per-user cache, else none
+func (r *Router) cacheNamespace(userID string) string {
+	if r.perUserCache {
+		return userCachePrefix(userID)
+	}
+	return ""
+}
+
+// SetCacheTTL overrides how long completions of models starting with
+// prefix are cached. The longest matching prefix wins; models without an
+// override use the cache's default TTL.
+func (r *Router) SetCacheTTL(prefix string, ttl time.Duration) {
+	r.cacheTTLs[prefix] = ttl
+}
+
+// cacheTTL returns the TTL override for a model, or zero if it has none
+func (r *Router) cacheTTL(model string) time.Duration {
+	var ttl time.Duration
+	best := -1
+	for prefix, d := range r.cacheTTLs {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			ttl, best = d, len(prefix)
+		}
+	}
+	return ttl
+}
+
+// Cacheable reports whether a completion may be served from and stored in
+// the cache. Sampling with a temperature above zero is expected to vary
+// between calls, so those responses are never cached.
+func Cacheable(req *providers.ChatRequest) bool {
+	return req.Temperature <= 0
+}
+
+// noStore reports whether the client opted out of caching with
+// Cache-Control: no-store
+func noStore(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheSchemaVersion is part of every cache key. Bump it when the format of
+// keys changes; the format of cached values is versioned by
+// cache.SchemaVersion.
+const cacheSchemaVersion = 2
+
+// cacheKeyPrefix is the prefix of the cache keys of kind ("chat" or
+// "embeddings") for a model; every entry of the model shares it
+func cacheKeyPrefix(kind, model string) string {
+	return fmt.Sprintf("%s:v%d:%s:", kind, cacheSchemaVersion, model)
+}
+
+// cacheKeyFields returns the canonical projection of a chat request that is
+// hashed into its cache key. Only fields that affect the output take part,
+// so stream and other transport details don't split entries. Fields are
+// kept in maps, which marshal with sorted keys, and zero values, nil and
+// empty slices are left out, so a field added to ChatRequest leaves the keys
+// of requests that don't set it unchanged.
+func cacheKeyFields(req *providers.ChatRequest) map[string]interface{} {
+	messages := make([]map[string]interface{}, len(req.Messages))
+	for i, msg := range req.Messages {
+		fields := map[string]interface{}{}
+		putNonZero(fields, "role", strings.TrimSpace(msg.Role))
+		putNonZero(fields, "content", strings.TrimSpace(msg.Content))
+		if len(msg.Parts) > 0 {
+			fields["parts"] = msg.Parts
+		}
+		if len(msg.ToolCalls) > 0 {
+			fields["tool_calls"] = msg.ToolCalls
+		}
+		putNonZero(fields, "tool_call_id", msg.ToolCallID)
+		messages[i] = fields
+	}
+
+	fields := map[string]interface{}{
+		"model":    req.Model,
+		"messages": messages,
+	}
+	putNonZero(fields, "temperature", req.Temperature)
+	putNonZero(fields, "top_p", req.TopP)
+	putNonZero(fields, "max_tokens", req.MaxTokens)
+	putNonZero(fields, "presence_penalty", req.PresencePenalty)
+	putNonZero(fields, "frequency_penalty", req.FrequencyPenalty)
+	if len(req.Stop) > 0 {
+		fields["stop"] = sortedStop(req.Stop)
+	}
+	// n of 0 and 1 both ask for a single choice
+	if req.N > 1 {
+		fields["n"] = req.N
+	}
+	if len(req.Tools) > 0 {
+		fields["tools"] = req.Tools
+	}
+	if len(req.ToolChoice) > 0 && string(req.ToolChoice) != "null" {
+		fields["tool_choice"] = req.ToolChoice
+	}
+	// Log probabilities are part of the response
+	putNonZero(fields, "logprobs", req.Logprobs)
+	putNonZero(fields, "top_logprobs", req.TopLogprobs)
+	// Zero is a seed like any other
+	if req.Seed != nil {
+		fields["seed"] = *req.Seed
+	}
+	return fields
+}
+
+// putNonZero sets key to value unless value is its type's zero value
+func putNonZero[T comparable](fields map[string]interface{}, key string, value T) {
+	var zero T
+	if value != zero {
+		fields[key] = value
+	}
+}
+
+// generateCacheKey generates a cache key from the request's model,
+// messages and sampling parameters. Message content is trimmed of leading
+// and trailing whitespace, and stop sequences, whose order doesn't matter,
+// are sorted. Keys have the form chat:v<version>:<model>:<hash>.
 func (r *Router) generateCacheKey(req *providers.ChatRequest) string {
-	// Create a deterministic string from the request
-	data, _ := json.Marshal(req)
+	// Marshaling compacts raw JSON such as tool_choice, so its whitespace
+	// doesn't matter either
+	data, _ := json.Marshal(cacheKeyFields(req))
 	hash := sha256.Sum256(data)
-	return fmt.Sprintf("chat:%s", hex.EncodeToString(hash[:]))
+	return cacheKeyPrefix("chat", req.Model) + hex.EncodeToString(hash[:])
 }
 
+// sortedStop returns a sorted copy of stop sequences
+func sortedStop(stop providers.StopSequences) []string {
+	if len(stop) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), stop...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// userCachePrefix is the key prefix of responses cached for a single user
+// rather than shared across users
+func userCachePrefix(userID string) string {
+	return "user:" + userID + ":"
+}
+
+// generateEmbeddingCacheKey generates a cache key from an embeddings
+// request, of the form embeddings:v<version>:<model>:<hash>
+func (r *Router) generateEmbeddingCacheKey(req *providers.EmbeddingRequest) string {
+	data, _ := json.Marshal(req)
+	hash := sha256.Sum256(data)
+	return cacheKeyPrefix("embeddings", req.Model) + hex.EncodeToString(hash[:])
+}
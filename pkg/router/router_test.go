@@ -0,0 +1,1171 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// stubProvider returns a fixed error, or a response naming the model it served
+type stubProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (s *stubProvider) Name() string {
+	return s.name
+}
+
+func (s *stubProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &providers.ChatResponse{ID: s.name + "-1", Model: req.Model}, nil
+}
+
+func (s *stubProvider) Models(ctx context.Context) ([]providers.ModelInfo, error) {
+	return nil, nil
+}
+
+func (s *stubProvider) Embeddings(ctx context.Context, req *providers.EmbeddingRequest) (*providers.EmbeddingResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestFallbackOnRetryableError(t *testing.T) {
+	openai := &stubProvider{name: "openai", err: &providers.ProviderError{Provider: "openai", StatusCode: 503}}
+	anthropic := &stubProvider{name: "anthropic"}
+
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", openai)
+	r.RegisterProvider("anthropic", anthropic)
+	r.SetFallback("gpt-4", []string{"claude-3-opus-20240229"})
+
+	result, err := r.completeWithFallback(context.Background(), &providers.ChatRequest{Model: "gpt-4"})
+	assert.NoError(t, err)
+	assert.Equal(t, "anthropic", result.servedBy)
+	assert.Equal(t, "claude-3-opus-20240229", result.model)
+	assert.Equal(t, "claude-3-opus-20240229", result.resp.Model)
+	assert.Equal(t, 1, openai.calls)
+}
+
+func TestNoFallbackOnClientError(t *testing.T) {
+	openai := &stubProvider{name: "openai", err: &providers.ProviderError{Provider: "openai", StatusCode: 400}}
+	anthropic := &stubProvider{name: "anthropic"}
+
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", openai)
+	r.RegisterProvider("anthropic", anthropic)
+	r.SetFallback("gpt-4", []string{"claude-3-opus-20240229"})
+
+	_, err := r.completeWithFallback(context.Background(), &providers.ChatRequest{Model: "gpt-4"})
+	assert.Error(t, err)
+	assert.Equal(t, 0, anthropic.calls)
+}
+
+func TestWeightedProviderSelection(t *testing.T) {
+	primary := &stubProvider{name: "openai-a"}
+	secondary := &stubProvider{name: "openai-b"}
+
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterWeightedProvider("openai", primary, 70)
+	r.RegisterWeightedProvider("openai", secondary, 30)
+	r.SetRandSource(rand.NewSource(42))
+
+	for i := 0; i < 1000; i++ {
+		provider, ok := r.getProvider("openai")
+		assert.True(t, ok)
+		provider.ChatCompletion(context.Background(), &providers.ChatRequest{Model: "gpt-4"})
+	}
+
+	assert.InDelta(t, 700, primary.calls, 50)
+	assert.InDelta(t, 300, secondary.calls, 50)
+}
+
+func TestStreamRecorderAssemblesResponse(t *testing.T) {
+	recorder := newStreamRecorder(1700000000)
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Role: "assistant"})
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Content: "Hello, "})
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Content: "world", FinishReason: "stop"})
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Usage: &providers.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}})
+
+	resp := recorder.response()
+	assert.Equal(t, "chatcmpl-1", resp.ID)
+	assert.Equal(t, int64(1700000000), resp.Created)
+	assert.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Hello, world", resp.Choices[0].Message.Content)
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+	assert.Equal(t, 7, resp.Usage.TotalTokens)
+}
+
+func TestStreamRecorderEstimatesMissingUsage(t *testing.T) {
+	req := &providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	prompt, _ := estimateTokens(req)
+
+	recorder := newStreamRecorder(1700000000)
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Content: "Hello, world"})
+	recorder.estimateUsage(req)
+	assert.Equal(t, providers.Usage{PromptTokens: prompt, CompletionTokens: 3, TotalTokens: prompt + 3}, recorder.response().Usage)
+
+	// Reported usage is kept
+	recorder = newStreamRecorder(1700000000)
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Usage: &providers.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}})
+	recorder.estimateUsage(req)
+	assert.Equal(t, 7, recorder.response().Usage.TotalTokens)
+}
+
+// tokensUsed reads llm_tokens_used_total for a provider, model and token
+// type from the default registry
+func tokensUsed(t *testing.T, provider, model, kind string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "llm_tokens_used_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["provider"] == provider && labels["model"] == model && labels["type"] == kind && labels["shadow"] == "false" {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestStreamedCompletionRecordsTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var reportUsage atomic.Bool
+	reportUsage.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello, world\"},\"finish_reason\":\"stop\"}]}\n\n"))
+		if reportUsage.Load() {
+			w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":3,\"total_tokens\":12}}\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", providers.NewOpenAIProvider("test-key", providers.WithBaseURL(upstream.URL)))
+
+	// Streaming needs a real connection rather than a recorder
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	gateway := httptest.NewServer(engine)
+	defer gateway.Close()
+
+	const model = "gpt-4-stream-usage"
+	stream := func() {
+		body := `{"model":"` + model + `","stream":true,"messages":[{"role":"user","content":"Hi"}]}`
+		req, _ := http.NewRequest("POST", gateway.URL+"/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-User-ID", "test-user")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(respBody), "[DONE]")
+	}
+
+	// The usage of the terminal event is recorded
+	prompt, completion := tokensUsed(t, "openai", model, "prompt"), tokensUsed(t, "openai", model, "completion")
+	stream()
+	assert.Equal(t, float64(9), tokensUsed(t, "openai", model, "prompt")-prompt)
+	assert.Equal(t, float64(3), tokensUsed(t, "openai", model, "completion")-completion)
+
+	// Without one the usage is estimated
+	reportUsage.Store(false)
+	prompt, completion = tokensUsed(t, "openai", model, "prompt"), tokensUsed(t, "openai", model, "completion")
+	stream()
+	assert.Greater(t, tokensUsed(t, "openai", model, "prompt"), prompt)
+	assert.Greater(t, tokensUsed(t, "openai", model, "completion"), completion)
+}
+
+// stallingStreamProvider streams sent chunks, then stalls until the stream
+// is cancelled, closing stopped once it is
+type stallingStreamProvider struct {
+	stubProvider
+	sent    int
+	stopped chan struct{}
+}
+
+func (s *stallingStreamProvider) ChatCompletionStream(ctx context.Context, req *providers.ChatRequest) (<-chan providers.StreamChunk, error) {
+	chunks := make(chan providers.StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer close(s.stopped)
+		for i := 0; i < s.sent; i++ {
+			chunks <- providers.StreamChunk{ID: "stream-1", Model: req.Model, Content: "Hello"}
+		}
+		<-ctx.Done()
+	}()
+	return chunks, nil
+}
+
+func TestStalledStreamIsAborted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name  string
+		sent  int
+		stall string
+	}{
+		{"before the first token", 0, "no first token within"},
+		{"between chunks", 1, "no next chunk within"},
+	} {
+		provider := &stallingStreamProvider{stubProvider: stubProvider{name: "openai"}, sent: tc.sent, stopped: make(chan struct{})}
+		r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+		r.RegisterProvider("openai", provider)
+		r.SetStreamTimeouts(StreamTimeouts{FirstToken: 50 * time.Millisecond, Idle: 50 * time.Millisecond})
+
+		engine := gin.New()
+		engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+		gateway := httptest.NewServer(engine)
+
+		body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"Hi"}]}`
+		req, _ := http.NewRequest("POST", gateway.URL+"/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-User-ID", "test-user")
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err, tc.name)
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// The stream ends with an error event instead of hanging
+		assert.Less(t, time.Since(start), time.Second, tc.name)
+		assert.Contains(t, string(respBody), tc.stall, tc.name)
+		assert.NotContains(t, string(respBody), "[DONE]", tc.name)
+
+		// and the provider's stream is torn down
+		select {
+		case <-provider.stopped:
+		case <-time.After(time.Second):
+			t.Errorf("%s: provider stream was not cancelled", tc.name)
+		}
+		gateway.Close()
+	}
+}
+
+func TestStreamRecorderAssemblesToolCalls(t *testing.T) {
+	recorder := newStreamRecorder(1700000000)
+	recorder.add(providers.StreamChunk{ID: "chatcmpl-1", Model: "gpt-4", Role: "assistant"})
+	recorder.add(providers.StreamChunk{ToolCalls: []providers.ToolCallDelta{{Index: 0, ID: "call_1", Type: "function", Function: providers.FunctionCallDelta{Name: "get_weather"}}}})
+	recorder.add(providers.StreamChunk{ToolCalls: []providers.ToolCallDelta{{Index: 0, Function: providers.FunctionCallDelta{Arguments: `{"city":`}}}})
+	recorder.add(providers.StreamChunk{ToolCalls: []providers.ToolCallDelta{{Index: 0, Function: providers.FunctionCallDelta{Arguments: `"Paris"}`}}}, FinishReason: "tool_calls"})
+
+	resp := recorder.response()
+	assert.Equal(t, []providers.ToolCall{{ID: "call_1", Type: "function", Function: providers.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}, resp.Choices[0].Message.ToolCalls)
+	assert.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+}
+
+func TestOpenAIChunkFormat(t *testing.T) {
+	chunk := openAIChunk(providers.StreamChunk{ID: "msg_1", Model: "claude-3-5-haiku-20241022", Content: "Hi"}, 1700000000)
+	assert.Equal(t, "chat.completion.chunk", chunk.Object)
+	assert.Equal(t, int64(1700000000), chunk.Created)
+	assert.Equal(t, []providers.StreamChoice{{Delta: providers.Delta{Content: "Hi"}}}, chunk.Choices)
+	assert.Nil(t, chunk.Usage)
+
+	usage := openAIChunk(providers.StreamChunk{ID: "msg_1", Usage: &providers.Usage{TotalTokens: 7}}, 1700000000)
+	assert.Empty(t, usage.Choices)
+	assert.Equal(t, 7, usage.Usage.TotalTokens)
+}
+
+func TestCacheKeyIgnoresStreamFlag(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	streamReq := req
+	streamReq.Stream = true
+
+	assert.Equal(t, r.generateCacheKey(&req), r.generateCacheKey(&streamReq))
+}
+
+func TestCacheKeyIncludesN(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	single, three := req, req
+	single.N, three.N = 1, 3
+
+	assert.Equal(t, r.generateCacheKey(&req), r.generateCacheKey(&single))
+	assert.NotEqual(t, r.generateCacheKey(&req), r.generateCacheKey(&three))
+}
+
+func TestCacheKeyIncludesLogprobs(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	logprobs := req
+	logprobs.Logprobs = true
+	top := logprobs
+	top.TopLogprobs = 5
+
+	assert.NotEqual(t, r.generateCacheKey(&req), r.generateCacheKey(&logprobs))
+	assert.NotEqual(t, r.generateCacheKey(&logprobs), r.generateCacheKey(&top))
+}
+
+func TestCacheKeyIncludesSeed(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	zero, one, alsoOne := req, req, req
+	zero.Seed, one.Seed, alsoOne.Seed = new(int64), new(int64), new(int64)
+	*one.Seed, *alsoOne.Seed = 1, 1
+
+	// A seed of zero is still a seed
+	assert.NotEqual(t, r.generateCacheKey(&req), r.generateCacheKey(&zero))
+	assert.NotEqual(t, r.generateCacheKey(&zero), r.generateCacheKey(&one))
+	assert.Equal(t, r.generateCacheKey(&one), r.generateCacheKey(&alsoOne))
+}
+
+func TestCacheKeyIncludesStop(t *testing.T) {
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	end, newline, both, reversed := req, req, req, req
+	end.Stop = providers.StopSequences{"END"}
+	newline.Stop = providers.StopSequences{"\n"}
+	both.Stop = providers.StopSequences{"END", "\n"}
+	reversed.Stop = providers.StopSequences{"\n", "END"}
+
+	assert.NotEqual(t, r.generateCacheKey(&req), r.generateCacheKey(&end))
+	assert.NotEqual(t, r.generateCacheKey(&end), r.generateCacheKey(&newline))
+	assert.Equal(t, r.generateCacheKey(&both), r.generateCacheKey(&reversed), "the order of stop sequences doesn't matter")
+}
+
+func TestRequestsDifferingInStopDontShareCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &stubProvider{name: "openai"}
+	r := NewRouter(cache.NewInMemoryCache(10, time.Minute), ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	for _, stop := range []string{`"END"`, `["STOP"]`, `["END"]`} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","stop":`+stop+`,"messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	// "END" as a string and as an array are the same request
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestCacheKeyNamespacedByModel(t *testing.T) {
+	r := NewRouter(nil, nil)
+	a := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	b := a
+	b.Model = "gpt-4o"
+
+	keyA, keyB := r.generateCacheKey(&a), r.generateCacheKey(&b)
+	assert.NotEqual(t, keyA, keyB)
+	assert.True(t, strings.HasPrefix(keyA, fmt.Sprintf("chat:v%d:gpt-4:", cacheSchemaVersion)))
+	assert.True(t, strings.HasPrefix(keyB, fmt.Sprintf("chat:v%d:gpt-4o:", cacheSchemaVersion)))
+
+	embedding := r.generateEmbeddingCacheKey(&providers.EmbeddingRequest{Model: "text-embedding-3-small", Input: providers.EmbeddingInput{"Hi"}})
+	assert.True(t, strings.HasPrefix(embedding, cacheKeyPrefix("embeddings", "text-embedding-3-small")))
+}
+
+func TestSchemaVersionBumpInvalidatesEntries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := cache.NewInMemoryCache(10, time.Minute)
+	provider := &stubProvider{name: "openai"}
+	r := NewRouter(c, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	// An entry of the previous schema version under the request's key
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	c.SetSchemaVersion(cache.SchemaVersion - 1)
+	assert.NoError(t, c.Set(context.Background(), r.generateCacheKey(&req), map[string]string{"id": "stale-format"}))
+	c.SetSchemaVersion(cache.SchemaVersion)
+
+	// is a miss, so the provider is called
+	w := sendChat(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "stale-format")
+	assert.Equal(t, 1, provider.calls)
+
+	// and its response replaces the entry under the current version
+	sendChat(engine)
+	assert.Equal(t, 1, provider.calls)
+}
+
+func TestCacheKeyNormalizesZeroValues(t *testing.T) {
+	r := NewRouter(nil, nil)
+	req := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	normalized := providers.ChatRequest{
+		Model:      "gpt-4",
+		Messages:   []providers.Message{{Role: "user", Content: "Hi", Parts: []providers.ContentPart{}, ToolCalls: []providers.ToolCall{}}},
+		Stop:       providers.StopSequences{},
+		Tools:      []providers.Tool{},
+		ToolChoice: json.RawMessage("null"),
+		N:          1,
+	}
+	assert.Equal(t, r.generateCacheKey(&req), r.generateCacheKey(&normalized), "nil, empty and zero values are the same")
+
+	auto, spaced := req, req
+	auto.ToolChoice = json.RawMessage(`"auto"`)
+	spaced.ToolChoice = json.RawMessage(` "auto" `)
+	assert.Equal(t, r.generateCacheKey(&auto), r.generateCacheKey(&spaced))
+}
+
+func TestCacheKeyStableAcrossFieldAdditions(t *testing.T) {
+	r := NewRouter(nil, nil)
+	req := providers.ChatRequest{
+		Model:       "gpt-4",
+		Messages:    []providers.Message{{Role: "system", Content: "Be brief"}, {Role: "user", Content: "Hi"}},
+		Temperature: 0.7,
+		MaxTokens:   100,
+		Stop:        providers.StopSequences{"END"},
+	}
+
+	// Fields left at their zero value are not serialized, so adding one to
+	// ChatRequest keeps this key; only a change to the canonical form may
+	// change it, along with cacheSchemaVersion
+	fields, _ := json.Marshal(cacheKeyFields(&req))
+	assert.JSONEq(t, `{"model":"gpt-4","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hi"}],"temperature":0.7,"max_tokens":100,"stop":["END"]}`, string(fields))
+	assert.Equal(t, "chat:v2:gpt-4:c7a5478f29e4f4fcc43f368ea2ff1f815a096645eedc127626dd6ada654b5c73", r.generateCacheKey(&req))
+}
+
+func TestModelRoutes(t *testing.T) {
+	r := NewRouter(nil, nil)
+	r.SetModelRoute("gpt-4o", "azure")
+	r.SetModelRoute("llama-*", "local")
+
+	assert.Equal(t, "azure", r.getProviderFromModel("gpt-4o"))
+	assert.Equal(t, "openai", r.getProviderFromModel("gpt-4o-mini"))
+	assert.Equal(t, "local", r.getProviderFromModel("llama-3-70b"))
+	assert.Equal(t, "anthropic", r.getProviderFromModel("claude-3-haiku-20240307"))
+	assert.Equal(t, "", r.getProviderFromModel("mistral-large"))
+}
+
+func TestUnmappedModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.WarnLevel)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	local := &stubProvider{name: "local"}
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	r.RegisterProvider("local", local)
+	r.SetLogger(zap.New(core), false)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	send := func(model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	// Strict routing, the default, rejects unmapped models
+	w := send("mistral-large")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unsupported model: mistral-large")
+	assert.Zero(t, logs.Len())
+
+	// Otherwise they go to the default provider, with a warning the first
+	// time each model falls through
+	r.SetDefaultProvider("local")
+	assert.Equal(t, http.StatusOK, send("mistral-large").Code)
+	assert.Equal(t, http.StatusOK, send("mistral-large").Code)
+	assert.Equal(t, http.StatusOK, send("gpt-4").Code, "mapped models keep their route")
+	assert.Equal(t, 2, local.calls)
+
+	entries := logs.All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "mistral-large", entries[0].ContextMap()["model"])
+		assert.Equal(t, "local", entries[0].ContextMap()["provider"])
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	assert.True(t, Cacheable(&providers.ChatRequest{Model: "gpt-4"}))
+	assert.False(t, Cacheable(&providers.ChatRequest{Model: "gpt-4", Temperature: 0.7}))
+}
+
+func TestCacheKeyIgnoresFieldOrder(t *testing.T) {
+	r := NewRouter(nil, nil)
+
+	var a, b providers.ChatRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"model":"gpt-4","max_tokens":50,"messages":[{"role":"user","content":"Hi"}]}`), &a))
+	assert.NoError(t, json.Unmarshal([]byte(`{"messages":[{"content":"Hi","role":"user"}],"max_tokens":50,"model":"gpt-4"}`), &b))
+
+	assert.Equal(t, r.generateCacheKey(&a), r.generateCacheKey(&b))
+}
+
+func TestCacheKeyTrimsWhitespace(t *testing.T) {
+	r := NewRouter(nil, nil)
+	a := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	b := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "  Hi\n"}}}
+	c := providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi there"}}}
+
+	assert.Equal(t, r.generateCacheKey(&a), r.generateCacheKey(&b))
+	assert.NotEqual(t, r.generateCacheKey(&a), r.generateCacheKey(&c))
+}
+
+func TestCacheTTLOverrides(t *testing.T) {
+	r := NewRouter(nil, nil)
+	r.SetCacheTTL("gpt-4", time.Hour)
+	r.SetCacheTTL("gpt-4o", 10*time.Minute)
+	r.SetCacheTTL("gpt-3.5", 5*time.Minute)
+
+	assert.Equal(t, time.Hour, r.cacheTTL("gpt-4-0613"))
+	assert.Equal(t, 10*time.Minute, r.cacheTTL("gpt-4o-mini"))
+	assert.Equal(t, 5*time.Minute, r.cacheTTL("gpt-3.5-turbo"))
+	assert.Equal(t, time.Duration(0), r.cacheTTL("claude-3-haiku-20240307"))
+}
+
+// gatedProvider counts calls and blocks each one until release is closed
+type gatedProvider struct {
+	stubProvider
+	release chan struct{}
+	count   int32
+}
+
+func (g *gatedProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	atomic.AddInt32(&g.count, 1)
+	<-g.release
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &providers.ChatResponse{ID: g.name + "-1", Model: req.Model}, nil
+}
+
+// fireConcurrent sends n identical chat requests at once and returns their
+// status codes after the provider is released
+func fireConcurrent(r *Router, provider *gatedProvider, n int) []int {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"Hello"}]}`
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("X-User-ID", "test-user")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}(i)
+	}
+
+	// Let every request reach the in-flight call before it completes
+	time.Sleep(100 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+	return codes
+}
+
+func TestConcurrentIdenticalRequestsShareOneCall(t *testing.T) {
+	provider := &gatedProvider{stubProvider: stubProvider{name: "openai"}, release: make(chan struct{})}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+
+	for _, code := range fireConcurrent(r, provider, 50) {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&provider.count))
+}
+
+// coalescedRequests reads request_coalesced_total for a model from the
+// default registry
+func coalescedRequests(t *testing.T, model string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "request_coalesced_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "model" && label.GetValue() == model {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestConcurrentIdenticalRequestsCountJoins(t *testing.T) {
+	provider := &gatedProvider{stubProvider: stubProvider{name: "openai"}, release: make(chan struct{})}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+
+	before := coalescedRequests(t, "gpt-4")
+	fireConcurrent(r, provider, 20)
+
+	// Every request but the one making the upstream call joined it
+	assert.Equal(t, int32(1), atomic.LoadInt32(&provider.count))
+	assert.Equal(t, before+19, coalescedRequests(t, "gpt-4"))
+}
+
+func TestConcurrentIdenticalRequestsShareError(t *testing.T) {
+	provider := &gatedProvider{
+		stubProvider: stubProvider{name: "openai", err: &providers.ProviderError{Provider: "openai", StatusCode: 400}},
+		release:      make(chan struct{}),
+	}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+
+	for _, code := range fireConcurrent(r, provider, 50) {
+		assert.Equal(t, http.StatusBadRequest, code)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&provider.count))
+}
+
+// denyLimiter rejects every request
+type denyLimiter struct{}
+
+func (denyLimiter) Allow(userID string, tokens int64) bool { return false }
+
+func (denyLimiter) AllowModel(userID, model string, tokens int64) bool { return false }
+
+func (denyLimiter) Stats(userID string) map[string]interface{} { return nil }
+
+func TestRouterUsesInjectedLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &stubProvider{name: "openai"}
+	r := NewRouter(nil, denyLimiter{})
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, 0, provider.calls)
+}
+
+func TestKeyAndUserRateLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyLimiter := ratelimit.NewRateLimiter(2, 0.001)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(2, 0.001))
+	r.SetKeyRateLimiter(keyLimiter)
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+
+	// Both keys belong to the same user
+	engine := gin.New()
+	engine.Use(middleware.AuthMiddleware(map[string]string{"key-a": "test-user", "key-b": "test-user"}))
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	send := func(key string) (int, string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		var resp middleware.ErrorResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Error.Message
+	}
+
+	status, _ := send("key-a")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = send("key-b")
+	assert.Equal(t, http.StatusOK, status)
+
+	// key-b is within its limit but the user has used theirs up
+	status, message := send("key-b")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "user rate limit exceeded", message)
+	// and the rejected request isn't charged to the key
+	assert.Equal(t, int64(1), keyLimiter.Stats(middleware.APIKeyID("key-b"))["available"])
+
+	// A key over its own limit is rejected as such
+	r.rateLimiter = ratelimit.NewRateLimiter(10, 0.001)
+	status, _ = send("key-a")
+	assert.Equal(t, http.StatusOK, status)
+	status, message = send("key-a")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "API key rate limit exceeded", message)
+}
+
+func TestRateLimitWaitQueuesRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &stubProvider{name: "openai"}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(1, 20))
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	send := func() int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Fail fast by default
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, http.StatusTooManyRequests, send())
+
+	// A token refills every 50ms, well within the wait
+	r.SetRateLimitWait(time.Second)
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, http.StatusOK, send())
+
+	// A wait shorter than the refill is rejected
+	r.SetRateLimitWait(10 * time.Millisecond)
+	assert.Equal(t, http.StatusTooManyRequests, send())
+}
+
+func TestSoftRateLimitWarns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewRateLimiter(3, 0.001)
+	limiter.SetThresholds(1, nil)
+	r := NewRouter(nil, limiter)
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	// Within the soft limit
+	w := sendChat(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(RateLimitWarningHeader))
+
+	// Beyond it, up to the hard limit, with a warning
+	for remaining := 1; remaining >= 0; remaining-- {
+		w = sendChat(engine)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, fmt.Sprintf("soft rate limit exceeded, %d of 3 remaining", remaining), w.Header().Get(RateLimitWarningHeader))
+	}
+
+	// Beyond the hard limit
+	w = sendChat(engine)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get(RateLimitWarningHeader))
+}
+
+func TestPriorityHeaderSelectsLane(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewRateLimiter(4, 0.001)
+	limiter.SetBatchReserve(0.5)
+	r := NewRouter(nil, limiter)
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	send := func(priority string) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		req.Header.Set("X-Priority", priority)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("batch"))
+	assert.Equal(t, http.StatusOK, send("batch"))
+	assert.Equal(t, http.StatusTooManyRequests, send("batch"))
+	assert.Equal(t, http.StatusOK, send("interactive"))
+	assert.Equal(t, http.StatusOK, send(""))
+	assert.Equal(t, http.StatusBadRequest, send("urgent"))
+}
+
+// usageProvider reports a fixed token usage
+type usageProvider struct {
+	stubProvider
+	usage providers.Usage
+}
+
+func (p *usageProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.calls++
+	return &providers.ChatResponse{ID: p.name + "-1", Model: req.Model, Usage: p.usage}, nil
+}
+
+func newTokenRateLimitRouter(provider providers.Provider, limiter ratelimit.Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, limiter)
+	r.RegisterProvider("openai", provider)
+	r.SetRateLimitTokens(true)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	return engine
+}
+
+func TestTokenRateLimitChargesEstimatedPromptTokens(t *testing.T) {
+	provider := &stubProvider{name: "openai"}
+	limiter := ratelimit.NewRateLimiter(1000, 0.001)
+	engine := newTokenRateLimitRouter(provider, limiter)
+
+	// A prompt larger than the whole limit is rejected up front
+	long := strings.Repeat("lorem ipsum ", 1000)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"`+long+`"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, 0, provider.calls)
+
+	// Without reported usage the estimate stands
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+	estimate, _ := estimateTokens(&providers.ChatRequest{Model: "gpt-4", Messages: []providers.Message{{Role: "user", Content: "Hi"}}})
+	assert.True(t, limiter.AllowModel("test-user", "gpt-4", int64(1000-estimate)))
+	assert.False(t, limiter.AllowModel("test-user", "gpt-4", 1))
+}
+
+func TestTokenRateLimitReconcilesWithUsage(t *testing.T) {
+	provider := &usageProvider{stubProvider: stubProvider{name: "openai"}, usage: providers.Usage{PromptTokens: 8, CompletionTokens: 292, TotalTokens: 300}}
+	limiter := ratelimit.NewRateLimiter(1000, 0.001)
+	engine := newTokenRateLimitRouter(provider, limiter)
+
+	// The estimate is replaced by the 300 tokens the provider reports
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+	assert.True(t, limiter.AllowModel("test-user", "gpt-4", 700))
+	assert.False(t, limiter.AllowModel("test-user", "gpt-4", 1))
+
+	// Requests are rejected once used tokens exhaust the limit
+	limiter.AdjustModel("test-user", "gpt-4", -600)
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+	assert.Equal(t, http.StatusTooManyRequests, sendChat(engine).Code)
+	assert.Equal(t, 3, provider.calls)
+}
+
+func TestInMemoryCacheServesRepeatRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &stubProvider{name: "openai"}
+	r := NewRouter(cache.NewInMemoryCache(10, time.Minute), ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, 1, provider.calls)
+	assert.Equal(t, StatusOK, r.ReadinessCheck(context.Background())["cache"])
+}
+
+func TestPerUserCacheIsolatesUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, perUser := range []bool{false, true} {
+		provider := &stubProvider{name: "openai"}
+		r := NewRouter(cache.NewInMemoryCache(10, time.Minute), ratelimit.NewRateLimiter(10, 1))
+		r.RegisterProvider("openai", provider)
+		r.SetPerUserCache(perUser)
+
+		engine := gin.New()
+		engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+		for _, userID := range []string{"tenant-a", "tenant-b", "tenant-a"} {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+			req.Header.Set("X-User-ID", userID)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+
+		if perUser {
+			// Each user misses once, then hits their own entry
+			assert.Equal(t, 2, provider.calls)
+		} else {
+			assert.Equal(t, 1, provider.calls, "the shared cache serves identical prompts of any user")
+		}
+	}
+}
+
+func TestReadinessCheck(t *testing.T) {
+	r := NewRouter(nil, nil)
+	checks := r.ReadinessCheck(context.Background())
+	assert.Equal(t, StatusDisabled, checks["cache"])
+	assert.NotEqual(t, StatusOK, checks["providers"])
+	assert.False(t, Ready(checks))
+
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	checks = r.ReadinessCheck(context.Background())
+	assert.Equal(t, StatusOK, checks["providers"])
+	assert.True(t, Ready(checks))
+}
+
+func TestCallLogRedactsContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	r.SetLogger(zap.New(core), false)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"secret"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "test-user", fields["user_id"])
+	assert.Equal(t, "openai", fields["provider"])
+	assert.Equal(t, cacheMiss, fields["cache"])
+	assert.Equal(t, false, fields["fallback"])
+	assert.NotContains(t, fields, "messages")
+}
+
+func TestRequestIDInCallLogAndProviderError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", &stubProvider{name: "openai", err: &providers.ProviderError{Provider: "openai", StatusCode: 400, Body: "bad request"}})
+	r.SetLogger(zap.New(core), false)
+
+	engine := gin.New()
+	engine.Use(middleware.RequestIDMiddleware())
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	req.Header.Set(middleware.RequestIDHeader, "req-abc")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "req-abc", w.Header().Get(middleware.RequestIDHeader))
+	assert.Contains(t, w.Body.String(), "(gateway request ID req-abc)")
+
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "req-abc", entries[0].ContextMap()["request_id"])
+}
+
+func TestProviderSpans(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+
+	openai := &stubProvider{name: "openai", err: &providers.ProviderError{Provider: "openai", StatusCode: 503}}
+	r := NewRouter(nil, nil)
+	r.tracer = tp.Tracer(tracerName)
+	r.RegisterProvider("openai", openai)
+	r.RegisterProvider("anthropic", &stubProvider{name: "anthropic"})
+	r.SetFallback("gpt-4", []string{"claude-3-opus-20240229"})
+
+	_, err := r.completeWithFallback(context.Background(), &providers.ChatRequest{Model: "gpt-4"})
+	assert.NoError(t, err)
+
+	ended := spans.Ended()
+	assert.Len(t, ended, 2)
+	for _, span := range ended {
+		assert.Equal(t, "provider.chat_completion", span.Name())
+	}
+	assert.Equal(t, codes.Error, ended[0].Status().Code)
+	assert.Len(t, ended[0].Events(), 1) // recorded error
+	assert.Contains(t, ended[1].Attributes(), attribute.String("llm.model", "claude-3-opus-20240229"))
+}
+
+func TestUpstreamStatusMapping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		upstream int
+		want     int
+	}{
+		{http.StatusBadRequest, http.StatusBadRequest},
+		{http.StatusUnauthorized, http.StatusUnauthorized},
+		{http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{http.StatusInternalServerError, http.StatusBadGateway},
+		{http.StatusServiceUnavailable, http.StatusBadGateway},
+	}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(tc.upstream)
+			w.Write([]byte(`{"error":{"message":"upstream"}}`))
+		}))
+
+		r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+		r.RegisterProvider("openai", providers.NewOpenAIProvider("test-key",
+			providers.WithBaseURL(server.URL),
+			providers.WithRetryConfig(providers.RetryConfig{MaxAttempts: 1}),
+		))
+
+		engine := gin.New()
+		engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.want, w.Code, "upstream status %d", tc.upstream)
+		server.Close()
+	}
+}
+
+func TestUndecodableUpstreamResponseReturns502(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":`))
+	}))
+	defer server.Close()
+
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", providers.NewOpenAIProvider("test-key",
+		providers.WithBaseURL(server.URL),
+		providers.WithRetryConfig(providers.RetryConfig{MaxAttempts: 1}),
+	))
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	w := sendChat(engine)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "failed to decode response")
+	assert.Contains(t, w.Body.String(), "chatcmpl-1", "the truncated body is included")
+}
+
+func TestUpstreamRequestIDHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name     string
+		upstream int
+		body     string
+		stream   bool
+	}{
+		{"success", http.StatusOK, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`, false},
+		{"error", http.StatusBadRequest, `{"error":{"message":"bad"}}`, false},
+		{"stream", http.StatusOK, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("x-request-id", "req_123")
+				w.WriteHeader(tc.upstream)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+			r.RegisterProvider("openai", providers.NewOpenAIProvider("test-key",
+				providers.WithBaseURL(server.URL),
+				providers.WithRetryConfig(providers.RetryConfig{MaxAttempts: 1}),
+			))
+
+			// Streaming needs a real connection rather than a recorder
+			engine := gin.New()
+			engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+			gateway := httptest.NewServer(engine)
+			defer gateway.Close()
+
+			body := fmt.Sprintf(`{"model":"gpt-4","stream":%t,"messages":[{"role":"user","content":"Hi"}]}`, tc.stream)
+			req, _ := http.NewRequest("POST", gateway.URL+"/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("X-User-ID", "test-user")
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			respBody, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tc.upstream, resp.StatusCode)
+			assert.Equal(t, "req_123", resp.Header.Get("X-Upstream-Request-Id"))
+			if tc.upstream != http.StatusOK {
+				assert.Contains(t, string(respBody), "request ID req_123")
+			}
+		})
+	}
+}
+
+func TestModelOverrideHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name   string
+		scopes []string
+		want   string
+	}{
+		{"admin", []string{middleware.AdminScope}, "anthropic"},
+		{"override scope", []string{middleware.ModelOverrideScope}, "anthropic"},
+		{"unauthorized", []string{"models:*"}, "openai"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+			r.RegisterProvider("openai", &stubProvider{name: "openai"})
+			r.RegisterProvider("anthropic", &stubProvider{name: "anthropic"})
+
+			engine := gin.New()
+			engine.POST("/v1/chat/completions", func(c *gin.Context) {
+				c.Set("scopes", tc.scopes)
+			}, r.HandleChatCompletion)
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+			req.Header.Set("X-User-ID", "test-user")
+			req.Header.Set("X-Model-Override", "claude-3-opus-20240229")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.want, w.Header().Get("X-Served-By"))
+		})
+	}
+}
+
+// slowProvider answers only once the request is cancelled
+type slowProvider struct {
+	stubProvider
+	cancelled chan struct{}
+}
+
+func (s *slowProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	<-ctx.Done()
+	close(s.cancelled)
+	return nil, ctx.Err()
+}
+
+func TestRequestTimeoutReturns504(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &slowProvider{stubProvider: stubProvider{name: "openai"}, cancelled: make(chan struct{})}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", middleware.TimeoutMiddleware(50*time.Millisecond), r.HandleChatCompletion)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	select {
+	case <-provider.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the provider call was not cancelled")
+	}
+}
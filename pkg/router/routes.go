@@ -0,0 +1,124 @@
+package router
+
+import (
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+)
+
+// ModelRoute sends models matching a pattern to a provider. Patterns are
+// exact model names or globs such as "gpt-4*".
+type ModelRoute struct {
+	Pattern  string
+	Provider string
+}
+
+// defaultModelRoutes are checked after any configured routes
+var defaultModelRoutes = []ModelRoute{
+	{Pattern: "gpt-*", Provider: "openai"},
+	{Pattern: "text-embedding-*", Provider: "openai"},
+	{Pattern: "claude-*", Provider: "anthropic"},
+	{Pattern: "gemini-*", Provider: "gemini"},
+}
+
+// defaultModelAliases map provider aliases to a default concrete model
+var defaultModelAliases = map[string]string{
+	"gpt":    "gpt-4o-mini",
+	"claude": "claude-3-5-haiku-20241022",
+	"gemini": "gemini-1.5-flash",
+}
+
+// SetModelAlias makes requests for alias use model instead, e.g. "gpt" for
+// "gpt-4o-mini". Aliases are resolved once; an alias may not point to
+// another alias.
+func (r *Router) SetModelAlias(alias, model string) {
+	r.modelAliases[alias] = model
+}
+
+// resolveModel returns the concrete model an alias stands for, or model
+// itself if it is not an alias
+func (r *Router) resolveModel(model string) string {
+	if resolved, ok := r.modelAliases[model]; ok {
+		return resolved
+	}
+	return model
+}
+
+// modelOverrideHeader replaces the model of a chat completion request
+const modelOverrideHeader = "X-Model-Override"
+
+// canOverrideModel reports whether the caller may use modelOverrideHeader:
+// admins and tokens with the model_override scope
+func canOverrideModel(c *gin.Context) bool {
+	return middleware.HasScope(c, middleware.AdminScope) || middleware.HasScope(c, middleware.ModelOverrideScope)
+}
+
+// SetModelRoute routes models matching pattern to the named provider.
+// Patterns are exact model names or globs such as "gpt-4*". Routes are
+// evaluated in registration order, ahead of the default gpt-*, claude-*,
+// gemini-* and text-embedding-* routes.
+func (r *Router) SetModelRoute(pattern, providerName string) {
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+	r.modelRoutes = append(r.modelRoutes, ModelRoute{Pattern: pattern, Provider: providerName})
+}
+
+// SetModelRoutes atomically replaces all routes set with SetModelRoute
+func (r *Router) SetModelRoutes(routes []ModelRoute) {
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+	r.modelRoutes = append([]ModelRoute(nil), routes...)
+}
+
+// SetDefaultProvider sends models that no route matches to the named
+// provider. By default, and with an empty name, such models are rejected
+// as unsupported, so a typo in a model name cannot run up costs on the
+// wrong backend.
+func (r *Router) SetDefaultProvider(providerName string) {
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+	r.defaultProvider = providerName
+}
+
+// maxFallthroughWarnings bounds the models remembered as having fallen
+// through to the default provider, as clients choose the model names
+const maxFallthroughWarnings = 1000
+
+// getProviderFromModel determines the provider from the model name. It
+// returns the default provider, or "" if there is none, for models no
+// route matches.
+func (r *Router) getProviderFromModel(model string) string {
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+
+	for _, routes := range [][]ModelRoute{r.modelRoutes, defaultModelRoutes} {
+		for _, route := range routes {
+			if matched, _ := path.Match(route.Pattern, model); matched {
+				return route.Provider
+			}
+		}
+	}
+	if r.defaultProvider != "" {
+		r.warnFallthrough(model)
+	}
+	return r.defaultProvider
+}
+
+// warnFallthrough logs a warning the first time a model falls through to
+// the default provider
+func (r *Router) warnFallthrough(model string) {
+	if r.fallthroughCount.Load() >= maxFallthroughWarnings {
+		return
+	}
+	if _, seen := r.fallthroughs.LoadOrStore(model, struct{}{}); seen {
+		return
+	}
+	r.fallthroughCount.Add(1)
+	r.logger.Warn("model matched no route, using the default provider",
+		zap.String("model", model),
+		zap.String("provider", r.defaultProvider),
+	)
+}
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// SemanticCacheConfig configures semantic response caching
+type SemanticCacheConfig struct {
+	// EmbeddingModel is the model used to embed prompts
+	EmbeddingModel string
+	// SimilarityThreshold is the minimum cosine similarity, between 0 and 1,
+	// for a cached response to be served for a new prompt
+	SimilarityThreshold float64
+}
+
+// EnableSemanticCache serves cached responses for prompts similar to a
+// previously answered one. Exact-match caching is still tried first.
+func (r *Router) EnableSemanticCache(semanticCache *cache.SemanticCache, config SemanticCacheConfig) {
+	r.semanticCache = semanticCache
+	r.semanticConfig = config
+}
+
+// semanticNamespace returns the namespace a request's prompt is indexed
+// and looked up in: the user's cache namespace, the model and a hash of
+// the request's other cache key fields, so similar prompts only match
+// requests asking for responses of the same shape, e.g. the same n and
+// tools
+func (r *Router) semanticNamespace(userID string, req *providers.ChatRequest) string {
+	fields := cacheKeyFields(req)
+	delete(fields, "messages")
+	data, _ := json.Marshal(fields)
+	hash := sha256.Sum256(data)
+	return r.cacheNamespace(userID) + req.Model + ":" + hex.EncodeToString(hash[:])
+}
+
+// embedPrompt embeds the messages of a request for semantic lookup. It
+// returns nil if the prompt can't be embedded, including prompts with
+// images, which a text embedding would ignore.
+func (r *Router) embedPrompt(ctx context.Context, req *providers.ChatRequest) []float64 {
+	provider, ok := r.getProvider(r.getProviderFromModel(r.semanticConfig.EmbeddingModel))
+	if !ok {
+		return nil
+	}
+
+	var prompt strings.Builder
+	for _, msg := range req.Messages {
+		for _, part := range msg.Parts {
+			if part.Type == providers.ContentPartImageURL {
+				return nil
+			}
+		}
+		prompt.WriteString(msg.Role)
+		prompt.WriteString(": ")
+		prompt.WriteString(strings.TrimSpace(msg.Content))
+		prompt.WriteString("\n")
+	}
+
+	resp, err := provider.Embeddings(ctx, &providers.EmbeddingRequest{
+		Model: r.semanticConfig.EmbeddingModel,
+		Input: providers.EmbeddingInput{prompt.String()},
+	})
+	if err != nil || len(resp.Data) == 0 {
+		return nil
+	}
+	return resp.Data[0].Embedding
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// sameEmbeddingProvider embeds every prompt as the same vector, so every
+// prompt is similar to every other
+type sameEmbeddingProvider struct {
+	stubProvider
+}
+
+func (p *sameEmbeddingProvider) Embeddings(ctx context.Context, req *providers.EmbeddingRequest) (*providers.EmbeddingResponse, error) {
+	return &providers.EmbeddingResponse{Data: []providers.Embedding{{Embedding: []float64{1, 0}}}}, nil
+}
+
+func TestSemanticCacheMatchesResponseShape(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &sameEmbeddingProvider{stubProvider{name: "openai"}}
+	responses := cache.NewInMemoryCache(100, time.Minute)
+	r := NewRouter(responses, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+	r.EnableSemanticCache(cache.NewSemanticCache(responses, 100), SemanticCacheConfig{
+		EmbeddingModel:      "text-embedding-3-small",
+		SimilarityThreshold: 0.9,
+	})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	send := func(content, params string) {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"` + content + `"}]` + params + `}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	send("What is Go?", "")
+	assert.Equal(t, 1, provider.calls)
+
+	// A similar prompt with the same parameters is a semantic hit
+	send("What's Go?", "")
+	assert.Equal(t, 1, provider.calls)
+
+	// One asking for more choices or with tools is not
+	send("What's Go?", `,"n":3`)
+	assert.Equal(t, 2, provider.calls)
+	send("Tell me about Go", `,"tools":[{"type":"function","function":{"name":"search"}}]`)
+	assert.Equal(t, 3, provider.calls)
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// ShadowConfig mirrors a sample of chat completions to a shadow provider,
+// e.g. to evaluate a new model on production traffic. Shadow responses are
+// discarded; only their metrics are recorded, labeled shadow="true".
+type ShadowConfig struct {
+	// Provider receives the copies; empty disables shadowing
+	Provider string
+	// Model replaces the model of the copies; empty keeps the request's
+	Model string
+	// SampleRate is the fraction of requests mirrored, from 0 to 1
+	SampleRate float64
+	// Timeout bounds each shadow call
+	Timeout time.Duration
+	// MaxInFlight caps concurrent shadow calls; requests arriving while
+	// the cap is reached are not mirrored
+	MaxInFlight int
+}
+
+// DefaultShadowConfig returns the shadow settings used when none are
+// configured, with shadowing disabled
+func DefaultShadowConfig() ShadowConfig {
+	return ShadowConfig{
+		Timeout:     60 * time.Second,
+		MaxInFlight: 100,
+	}
+}
+
+// SetShadow replaces the shadow traffic settings
+func (r *Router) SetShadow(config ShadowConfig) {
+	r.shadow = config
+	r.shadowSlots = make(chan struct{}, max(config.MaxInFlight, 1))
+}
+
+// mirror sends a copy of a served request to the shadow provider in the
+// background. It never blocks: unsampled requests and requests over the
+// in-flight cap are skipped, and shadow failures are only logged.
+func (r *Router) mirror(req *providers.ChatRequest) {
+	config := r.shadow
+	if config.Provider == "" || config.SampleRate <= 0 {
+		return
+	}
+	if config.SampleRate < 1 {
+		r.randMu.Lock()
+		sampled := r.rand.Float64() < config.SampleRate
+		r.randMu.Unlock()
+		if !sampled {
+			return
+		}
+	}
+	provider, ok := r.getProvider(config.Provider)
+	if !ok {
+		r.logger.Warn("Shadow provider not registered", zap.String("provider", config.Provider))
+		return
+	}
+
+	select {
+	case r.shadowSlots <- struct{}{}:
+	default:
+		return
+	}
+
+	shadowReq := *req
+	shadowReq.Stream = false
+	shadowReq.StreamOptions = nil
+	if config.Model != "" {
+		shadowReq.Model = config.Model
+	}
+	go func() {
+		defer func() { <-r.shadowSlots }()
+
+		// Detached from the client request, which has already been served
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		if _, err := r.tracedChatCompletion(ctx, provider, &shadowReq, true); err != nil {
+			r.logger.Warn("Shadow request failed",
+				zap.String("provider", config.Provider),
+				zap.String("model", shadowReq.Model),
+				zap.Error(err))
+		}
+	}()
+}
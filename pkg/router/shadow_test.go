@@ -0,0 +1,81 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// shadowStub reports the requests it receives and blocks until released
+type shadowStub struct {
+	stubProvider
+	received chan *providers.ChatRequest
+	release  chan struct{}
+}
+
+func (s *shadowStub) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
+	s.received <- req
+	<-s.release
+	return nil, errors.New("shadow failure")
+}
+
+func newShadowRouter(shadow *shadowStub, config ShadowConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	r.RegisterProvider("candidate", shadow)
+	r.SetShadow(config)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	return engine
+}
+
+func sendChat(engine *gin.Engine) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestShadowMirrorsWithoutBlocking(t *testing.T) {
+	shadow := &shadowStub{stubProvider: stubProvider{name: "candidate"}, received: make(chan *providers.ChatRequest, 1), release: make(chan struct{})}
+	engine := newShadowRouter(shadow, ShadowConfig{Provider: "candidate", Model: "candidate-model", SampleRate: 1, Timeout: time.Second, MaxInFlight: 1})
+
+	// The client is served while the shadow call is still blocked
+	w := sendChat(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "openai", w.Header().Get("X-Served-By"))
+
+	select {
+	case req := <-shadow.received:
+		assert.Equal(t, "candidate-model", req.Model)
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	// Over the in-flight cap requests are served but not mirrored
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+	close(shadow.release)
+	assert.Never(t, func() bool { return len(shadow.received) > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestShadowSampleRateZeroMirrorsNothing(t *testing.T) {
+	shadow := &shadowStub{stubProvider: stubProvider{name: "candidate"}, received: make(chan *providers.ChatRequest, 1), release: make(chan struct{})}
+	close(shadow.release)
+	engine := newShadowRouter(shadow, ShadowConfig{Provider: "candidate", Timeout: time.Second, MaxInFlight: 1})
+
+	assert.Equal(t, http.StatusOK, sendChat(engine).Code)
+	assert.Never(t, func() bool { return len(shadow.received) > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// cacheStatusHeader reports a response served from the cache
+const cacheStatusHeader = "X-Cache"
+
+// staleKeySuffix marks the stale copy of a cached response. It extends the
+// key rather than prefixing it, so purges by prefix remove both copies.
+const staleKeySuffix = ":stale"
+
+// SetStaleCache keeps a stale copy of every cached chat response for ttl,
+// which should outlive the freshness TTLs. When a provider call then fails
+// with an outage, timeout or rate limit, the stale copy is served instead
+// of the error. Zero disables stale serving.
+func (r *Router) SetStaleCache(ttl time.Duration) {
+	r.staleTTL = ttl
+}
+
+// cacheChatResponse caches a chat response, along with its stale copy when
+// stale serving is enabled
+func (r *Router) cacheChatResponse(ctx context.Context, key string, resp *providers.ChatResponse, ttl time.Duration) error {
+	if err := r.cacheSet(ctx, key, resp, ttl); err != nil {
+		return err
+	}
+	if r.staleTTL > 0 {
+		_ = r.cacheSet(ctx, key+staleKeySuffix, resp, r.staleTTL)
+	}
+	return nil
+}
+
+// serveStale answers a failed completion with the stale copy of its cached
+// response, if there is one. Only failures a retry could fix are answered
+// this way; a request the provider rejected is not.
+func (r *Router) serveStale(c *gin.Context, key string, err error) (*providers.ChatResponse, bool) {
+	if r.staleTTL <= 0 || key == "" || !providers.IsRetryable(err) {
+		return nil, false
+	}
+
+	var resp providers.ChatResponse
+	if r.cacheGet(c.Request.Context(), key+staleKeySuffix, &resp) != nil {
+		return nil, false
+	}
+	middleware.RecordCacheStaleHit()
+	c.Header(cacheStatusHeader, "stale")
+	c.Header("Warning", `110 - "Response is Stale"`)
+	c.JSON(http.StatusOK, resp)
+	return &resp, true
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/cache"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+func newStaleRouter(provider *stubProvider) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(cache.NewInMemoryCache(10, time.Minute), ratelimit.NewRateLimiter(10, 1))
+	r.RegisterProvider("openai", provider)
+	r.SetCacheTTL("gpt-4", 20*time.Millisecond)
+	r.SetStaleCache(time.Minute)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+	return engine
+}
+
+func TestStaleResponseServedWhenProviderFails(t *testing.T) {
+	provider := &stubProvider{name: "openai"}
+	engine := newStaleRouter(provider)
+
+	w := sendChat(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(cacheStatusHeader))
+
+	// Once the fresh entry expires and the provider goes down, the stale
+	// copy is served
+	time.Sleep(50 * time.Millisecond)
+	provider.err = &providers.ProviderError{Provider: "openai", StatusCode: 503}
+	w = sendChat(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "stale", w.Header().Get(cacheStatusHeader))
+	assert.Contains(t, w.Header().Get("Warning"), "110")
+	assert.Contains(t, w.Body.String(), `"id":"openai-1"`)
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestStaleResponseNotServedForRejectedRequests(t *testing.T) {
+	provider := &stubProvider{name: "openai"}
+	engine := newStaleRouter(provider)
+	sendChat(engine)
+
+	time.Sleep(50 * time.Millisecond)
+	provider.err = &providers.ProviderError{Provider: "openai", StatusCode: 400}
+	w := sendChat(engine)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get(cacheStatusHeader))
+}
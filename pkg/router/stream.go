@@ -0,0 +1,344 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// StreamTimeouts bound how long a streamed completion may stall before it
+// is aborted. Zero disables a timeout.
+type StreamTimeouts struct {
+	// FirstToken bounds the wait for the first chunk of the stream
+	FirstToken time.Duration
+	// Idle bounds the wait for each chunk after the first
+	Idle time.Duration
+}
+
+// SetStreamTimeouts sets how long streamed completions may stall
+func (r *Router) SetStreamTimeouts(timeouts StreamTimeouts) {
+	r.streamTimeouts = timeouts
+}
+
+// chunkReader reads the chunks of a stream, failing it when the provider
+// stalls longer than the stream timeouts allow
+type chunkReader struct {
+	chunks   <-chan providers.StreamChunk
+	provider string
+	timeouts StreamTimeouts
+	started  bool
+}
+
+// newChunkReader creates a chunk reader for a stream of provider
+func (r *Router) newChunkReader(provider string, chunks <-chan providers.StreamChunk) *chunkReader {
+	return &chunkReader{chunks: chunks, provider: provider, timeouts: r.streamTimeouts}
+}
+
+// next returns the next chunk, and false once the stream ends. A stall
+// yields a final chunk whose Err is a timeout; the caller must then cancel
+// the stream's context so the provider stops.
+func (cr *chunkReader) next() (providers.StreamChunk, bool) {
+	wait, waitingFor := cr.timeouts.Idle, "next chunk"
+	if !cr.started {
+		wait, waitingFor = cr.timeouts.FirstToken, "first token"
+	}
+	if wait <= 0 {
+		chunk, ok := <-cr.chunks
+		cr.observe(chunk)
+		return chunk, ok
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case chunk, ok := <-cr.chunks:
+		cr.observe(chunk)
+		return chunk, ok
+	case <-timer.C:
+		return providers.StreamChunk{Err: &providers.ProviderError{
+			Provider: cr.provider,
+			Kind:     providers.ErrorKindTimeout,
+			Err:      fmt.Errorf("stream stalled: no %s within %s", waitingFor, wait),
+		}}, true
+	}
+}
+
+// observe notes a chunk was received. The request ID chunk comes with the
+// response headers, so it doesn't count as the first token.
+func (cr *chunkReader) observe(chunk providers.StreamChunk) {
+	if chunk.RequestID == "" {
+		cr.started = true
+	}
+}
+
+// streamChatCompletion relays a streamed completion to the client as
+// server-sent events. The chunks are also accumulated so the complete
+// response can be cached once the stream finishes successfully. An empty
+// cacheKey disables caching. It returns the assembled response; if the
+// stream was cut short, it returns the error that did so along with the
+// part of the response received before it.
+//
+// Usage the provider reports in the stream is recorded in the LLM request
+// metrics and the usage tracker once the stream ends. Providers that don't
+// report it have it estimated from the prompt and the content relayed, so
+// streams cut short are accounted for too.
+//
+// Content is relayed as it arrives, so response filters only run over the
+// assembled response: a rejection ends the stream with an error event
+// instead of [DONE], and the filtered response is what gets cached.
+//
+// A provider that stalls past the stream timeouts has its stream aborted
+// with an error event.
+func (r *Router) streamChatCompletion(c *gin.Context, userID string, provider providers.Provider, req *providers.ChatRequest, cacheKey string) (*providers.ChatResponse, error) {
+	streamer, ok := provider.(providers.StreamingProvider)
+	if !ok {
+		respondError(c, http.StatusBadRequest, errors.New("streaming not supported by provider: "+provider.Name()))
+		return nil, fmt.Errorf("streaming not supported by provider: %s", provider.Name())
+	}
+
+	// Register the stream so a graceful shutdown waits for it to finish
+	if !r.streams.acquire() {
+		r.refuseWhileDraining(c)
+		return nil, fmt.Errorf("server is shutting down")
+	}
+	defer r.streams.release()
+
+	// The stream is bound to the request context, so it is torn down as soon
+	// as the client goes away or the handler returns, and to a context of
+	// its own so a stalled stream can be torn down too
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	start := time.Now()
+	chunks, err := streamer.ChatCompletionStream(ctx, req)
+	if err != nil {
+		err = tagRequestID(c.Request.Context(), err)
+		middleware.RecordLLMRequest(provider.Name(), req.Model, "error", false, time.Since(start), 0, 0)
+		respondError(c, statusForError(err), err)
+		return nil, err
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	created := time.Now().Unix()
+	recorder := newStreamRecorder(created)
+	completed := false
+	var resp *providers.ChatResponse
+	var streamErr error
+	reader := r.newChunkReader(provider.Name(), chunks)
+	c.Stream(func(w io.Writer) bool {
+		chunk, ok := reader.next()
+		if !ok {
+			recorder.estimateUsage(req)
+			resp, streamErr = r.filterResponse(c.Request.Context(), recorder.response())
+			if streamErr != nil {
+				c.SSEvent("", errorResponse(statusForError(streamErr), streamErr))
+				return false
+			}
+			completed = true
+			c.SSEvent("", "[DONE]")
+			return false
+		}
+		if chunk.Err != nil {
+			streamErr = tagRequestID(c.Request.Context(), chunk.Err)
+			c.SSEvent("", errorResponse(statusForError(streamErr), streamErr))
+			return false
+		}
+		if chunk.RequestID != "" {
+			// Sent before any event, while headers can still be set
+			setUpstreamRequestID(c, chunk.RequestID)
+			return true
+		}
+		recorder.add(chunk)
+		c.SSEvent("", openAIChunk(chunk, created))
+		return true
+	})
+
+	// Only cache streams that ran to completion
+	if !completed {
+		if streamErr == nil {
+			streamErr = fmt.Errorf("stream aborted: %w", c.Request.Context().Err())
+		}
+		recorder.estimateUsage(req)
+		partial := recorder.response()
+		r.recordStreamUsage(userID, provider, req, partial, time.Since(start), streamErr)
+		return partial, streamErr
+	}
+	r.recordStreamUsage(userID, provider, req, resp, time.Since(start), nil)
+	_ = r.cacheChatResponse(c.Request.Context(), cacheKey, resp, r.cacheTTL(req.Model))
+	return resp, nil
+}
+
+// recordStreamUsage records the token usage of a finished stream in the LLM
+// request metrics and the usage tracker. A stream cut short by err counts
+// as failed, but its tokens are recorded all the same since the provider
+// bills them.
+func (r *Router) recordStreamUsage(userID string, provider providers.Provider, req *providers.ChatRequest, resp *providers.ChatResponse, duration time.Duration, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	middleware.RecordLLMRequest(provider.Name(), req.Model, status, false, duration, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	middleware.RecordLLMTokenDetails(provider.Name(), req.Model, false, resp.Usage.CachedTokens(), resp.Usage.ReasoningTokens())
+
+	if r.usageTracker != nil {
+		model := resp.Model
+		if model == "" {
+			model = req.Model
+		}
+		if err := r.usageTracker.Record(usageRecord(userID, provider.Name(), model, resp.Usage)); err != nil {
+			log.Printf("Failed to record usage: %v", err)
+		}
+	}
+}
+
+// replayStream sends a cached response to a streaming client as a simulated
+// stream: a role chunk, a content chunk, a chunk per tool call and a finish
+// chunk per choice
+func (r *Router) replayStream(c *gin.Context, resp *providers.ChatResponse) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	for _, choice := range resp.Choices {
+		chunks := []providers.StreamChunk{
+			{Index: choice.Index, Role: choice.Message.Role},
+			{Index: choice.Index, Content: choice.Message.Content},
+		}
+		for i, call := range choice.Message.ToolCalls {
+			chunks = append(chunks, providers.StreamChunk{Index: choice.Index, ToolCalls: []providers.ToolCallDelta{{
+				Index:    i,
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: providers.FunctionCallDelta{Name: call.Function.Name, Arguments: call.Function.Arguments},
+			}}})
+		}
+		chunks = append(chunks, providers.StreamChunk{Index: choice.Index, FinishReason: choice.FinishReason})
+		for _, chunk := range chunks {
+			chunk.ID, chunk.Model = resp.ID, resp.Model
+			c.SSEvent("", openAIChunk(chunk, resp.Created))
+		}
+	}
+	c.SSEvent("", "[DONE]")
+	c.Writer.Flush()
+}
+
+// openAIChunk converts a stream chunk to OpenAI's chunk format. A usage
+// chunk has no choices, as in OpenAI's own usage chunk.
+func openAIChunk(chunk providers.StreamChunk, created int64) providers.ChatStreamChunk {
+	out := providers.ChatStreamChunk{
+		ID:      chunk.ID,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   chunk.Model,
+		Choices: []providers.StreamChoice{},
+		Usage:   chunk.Usage,
+	}
+	if chunk.Usage == nil {
+		out.Choices = append(out.Choices, providers.StreamChoice{
+			Index:        chunk.Index,
+			Delta:        providers.Delta{Role: chunk.Role, Content: chunk.Content, ToolCalls: chunk.ToolCalls},
+			FinishReason: chunk.FinishReason,
+		})
+	}
+	return out
+}
+
+// streamRecorder accumulates stream chunks into a complete response
+type streamRecorder struct {
+	resp     providers.ChatResponse
+	contents map[int]*strings.Builder
+	choices  map[int]*providers.Choice
+	order    []int
+}
+
+// newStreamRecorder creates a new stream recorder
+func newStreamRecorder(created int64) *streamRecorder {
+	return &streamRecorder{
+		resp:     providers.ChatResponse{Object: "chat.completion", Created: created},
+		contents: make(map[int]*strings.Builder),
+		choices:  make(map[int]*providers.Choice),
+	}
+}
+
+// add records a chunk
+func (sr *streamRecorder) add(chunk providers.StreamChunk) {
+	if sr.resp.ID == "" {
+		sr.resp.ID = chunk.ID
+		sr.resp.Model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		sr.resp.Usage = *chunk.Usage
+		return
+	}
+
+	choice, ok := sr.choices[chunk.Index]
+	if !ok {
+		choice = &providers.Choice{Index: chunk.Index, Message: providers.Message{Role: "assistant"}}
+		sr.choices[chunk.Index] = choice
+		sr.contents[chunk.Index] = &strings.Builder{}
+		sr.order = append(sr.order, chunk.Index)
+	}
+	if chunk.Role != "" {
+		choice.Message.Role = chunk.Role
+	}
+	sr.contents[chunk.Index].WriteString(chunk.Content)
+	for _, delta := range chunk.ToolCalls {
+		addToolCallDelta(&choice.Message, delta)
+	}
+	if chunk.FinishReason != "" {
+		choice.FinishReason = chunk.FinishReason
+	}
+}
+
+// addToolCallDelta merges a piece of a streamed tool call into msg
+func addToolCallDelta(msg *providers.Message, delta providers.ToolCallDelta) {
+	if delta.Index < 0 {
+		return
+	}
+	for len(msg.ToolCalls) <= delta.Index {
+		msg.ToolCalls = append(msg.ToolCalls, providers.ToolCall{})
+	}
+	call := &msg.ToolCalls[delta.Index]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Type != "" {
+		call.Type = delta.Type
+	}
+	call.Function.Name += delta.Function.Name
+	call.Function.Arguments += delta.Function.Arguments
+}
+
+// estimateUsage estimates the token usage of the stream from the prompt of
+// req and the content recorded so far, unless the provider reported it
+func (sr *streamRecorder) estimateUsage(req *providers.ChatRequest) {
+	if sr.resp.Usage != (providers.Usage{}) {
+		return
+	}
+	prompt, _ := estimateTokens(req)
+	completion := estimateCompletionTokens(req.Model, sr.response().Choices)
+	sr.resp.Usage = providers.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// response returns the assembled response
+func (sr *streamRecorder) response() *providers.ChatResponse {
+	resp := sr.resp
+	resp.Choices = make([]providers.Choice, 0, len(sr.order))
+	for _, index := range sr.order {
+		choice := *sr.choices[index]
+		choice.Message.Content = sr.contents[index].String()
+		resp.Choices = append(resp.Choices, choice)
+	}
+	return &resp
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the router's spans
+const tracerName = "ai-gateway/router"
+
+// tracedCacheGet is cacheGet inside a "cache.lookup" span recording
+// whether the lookup hit
+func (r *Router) tracedCacheGet(ctx context.Context, key string, dest interface{}) error {
+	if key == "" {
+		return errNoCache
+	}
+
+	ctx, span := r.tracer.Start(ctx, "cache.lookup")
+	defer span.End()
+
+	err := r.cacheGet(ctx, key, dest)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	return err
+}
+
+// tracedChatCompletion calls a provider inside a "provider.chat_completion"
+// span carrying the provider, model and token counts, and records the call
+// in the LLM request metrics. Failures are recorded on the span and counted
+// in llm_errors_total by error type, except for shadow calls, which must
+// not trip production error alerts.
+func (r *Router) tracedChatCompletion(ctx context.Context, provider providers.Provider, req *providers.ChatRequest, shadow bool) (*providers.ChatResponse, error) {
+	ctx, span := r.tracer.Start(ctx, "provider.chat_completion", trace.WithAttributes(
+		attribute.String("llm.provider", provider.Name()),
+		attribute.String("llm.model", req.Model),
+		attribute.Bool("llm.shadow", shadow),
+	))
+	defer span.End()
+
+	start := time.Now()
+	resp, err := provider.ChatCompletion(ctx, req)
+	if err != nil {
+		err = tagRequestID(ctx, err)
+		middleware.RecordLLMRequest(provider.Name(), req.Model, "error", shadow, time.Since(start), 0, 0)
+		kind := providers.KindOf(err)
+		if !shadow {
+			middleware.RecordLLMError(provider.Name(), req.Model, string(kind))
+		}
+		span.SetAttributes(attribute.String("llm.error_type", string(kind)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	middleware.RecordLLMRequest(provider.Name(), req.Model, "success", shadow, time.Since(start), resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	middleware.RecordLLMTokenDetails(provider.Name(), req.Model, shadow, resp.Usage.CachedTokens(), resp.Usage.ReasoningTokens())
+	span.SetAttributes(
+		attribute.Int("llm.prompt_tokens", resp.Usage.PromptTokens),
+		attribute.Int("llm.completion_tokens", resp.Usage.CompletionTokens),
+		attribute.Int("llm.total_tokens", resp.Usage.TotalTokens),
+		attribute.Int("llm.cached_tokens", resp.Usage.CachedTokens()),
+		attribute.Int("llm.reasoning_tokens", resp.Usage.ReasoningTokens()),
+	)
+	return resp, nil
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
+)
+
+// defaultUsageRange is the time range reported when only to is given
+const defaultUsageRange = 30 * 24 * time.Hour
+
+// maxUsageRange is the longest time range reported at once, bounding the
+// usage history scanned by a request
+const maxUsageRange = 366 * 24 * time.Hour
+
+// SetUsageReporting sets where HandleUsage reads usage: stats for the
+// current day and month, and history for time ranges. Either may be nil.
+func (r *Router) SetUsageReporting(stats usage.StatsReader, history usage.UsageHistory) {
+	r.usageStats = stats
+	r.usageHistory = history
+}
+
+// HandleUsage handles GET /v1/usage, returning the caller's usage for the
+// current day and month. With from, to or group_by it reports on the
+// usage history instead: the total from from up to to, and with group_by
+// the usage of each model, provider or day. Times are RFC 3339 or
+// YYYY-MM-DD dates (UTC); to defaults to now and from to 30 days earlier.
+func (r *Router) HandleUsage(c *gin.Context) {
+	userID := r.userID(c)
+	if userID == "" {
+		userID = "anonymous"
+	}
+
+	if c.Query("from") == "" && c.Query("to") == "" && c.Query("group_by") == "" {
+		if r.usageStats == nil {
+			respondError(c, http.StatusServiceUnavailable, errors.New("usage tracking unavailable"))
+			return
+		}
+		stats, err := r.usageStats.Get(userID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+		return
+	}
+
+	if r.usageHistory == nil {
+		respondError(c, http.StatusServiceUnavailable, errors.New("usage history unavailable"))
+		return
+	}
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		var err error
+		if to, err = parseUsageTime(value); err != nil {
+			respondError(c, http.StatusBadRequest, fmt.Errorf("invalid to: %w", err))
+			return
+		}
+	}
+	from := to.Add(-defaultUsageRange)
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = parseUsageTime(value); err != nil {
+			respondError(c, http.StatusBadRequest, fmt.Errorf("invalid from: %w", err))
+			return
+		}
+	}
+	if !from.Before(to) {
+		respondError(c, http.StatusBadRequest, errors.New("from must be before to"))
+		return
+	}
+	if to.Sub(from) > maxUsageRange {
+		respondError(c, http.StatusBadRequest, fmt.Errorf("time range must not exceed %d days", maxUsageRange/(24*time.Hour)))
+		return
+	}
+
+	groupBy := c.Query("group_by")
+	switch groupBy {
+	case "", usage.GroupByModel, usage.GroupByProvider, usage.GroupByDay:
+	default:
+		respondError(c, http.StatusBadRequest, fmt.Errorf("group_by must be %s, %s or %s", usage.GroupByModel, usage.GroupByProvider, usage.GroupByDay))
+		return
+	}
+
+	report, err := r.usageHistory.Report(c.Request.Context(), userID, from, to, groupBy)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// parseUsageTime parses an RFC 3339 time or a YYYY-MM-DD date, taken as
+// midnight UTC
+func parseUsageTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a YYYY-MM-DD date", value)
+	}
+	return t, nil
+}
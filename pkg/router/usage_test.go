@@ -0,0 +1,93 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/usage"
+)
+
+// fakeHistory reports fixed usage by model
+type fakeHistory struct {
+	calls int
+}
+
+func (h *fakeHistory) Report(ctx context.Context, userID string, from, to time.Time, groupBy string) (usage.UsageReport, error) {
+	h.calls++
+	report := usage.UsageReport{UserID: userID, From: from, To: to, GroupBy: groupBy, Total: usage.UsageWindow{TotalTokens: 4500, Requests: 3, Cost: 0.18}}
+	if groupBy == usage.GroupByModel {
+		report.Groups = []usage.UsageGroup{
+			{Group: "gpt-4", UsageWindow: usage.UsageWindow{TotalTokens: 3000, Requests: 2, Cost: 0.12}},
+			{Group: "gpt-4o", UsageWindow: usage.UsageWindow{TotalTokens: 1500, Requests: 1, Cost: 0.06}},
+		}
+	}
+	return report, nil
+}
+
+func newUsageEngine(history usage.UsageHistory) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(10, 1))
+	r.SetUsageReporting(nil, history)
+
+	engine := gin.New()
+	engine.GET("/v1/usage", r.HandleUsage)
+	return engine
+}
+
+func getUsage(engine *gin.Engine, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/v1/usage?"+query, nil)
+	req.Header.Set("X-User-ID", "test-user")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestUsageGroupedByModel(t *testing.T) {
+	engine := newUsageEngine(&fakeHistory{})
+
+	w := getUsage(engine, "from=2024-03-01&to=2024-04-01T00:00:00Z&group_by=model")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report usage.UsageReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "test-user", report.UserID)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), report.From)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), report.To)
+	assert.Equal(t, 0.18, report.Total.Cost)
+	if assert.Len(t, report.Groups, 2) {
+		assert.Equal(t, "gpt-4", report.Groups[0].Group)
+		assert.Equal(t, 3000, report.Groups[0].TotalTokens)
+	}
+}
+
+func TestUsageRejectsInvalidRanges(t *testing.T) {
+	history := &fakeHistory{}
+	engine := newUsageEngine(history)
+
+	for name, query := range map[string]string{
+		"from after to":    "from=2024-04-01&to=2024-03-01",
+		"empty range":      "from=2024-03-01&to=2024-03-01",
+		"range too long":   "from=2020-01-01&to=2024-01-01",
+		"malformed date":   "from=March",
+		"unknown grouping": "group_by=user",
+	} {
+		w := getUsage(engine, query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+	assert.Zero(t, history.calls)
+}
+
+func TestUsageWithoutHistory(t *testing.T) {
+	engine := newUsageEngine(nil)
+
+	assert.Equal(t, http.StatusServiceUnavailable, getUsage(engine, "group_by=model").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, getUsage(engine, "").Code)
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"fmt"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// RequestLimits bounds what a chat completion request may ask for. Requests
+// over a limit are rejected before reaching a provider. Zero disables a
+// limit.
+type RequestLimits struct {
+	// MaxBodyBytes caps the size of the request body
+	MaxBodyBytes int64
+	// MaxMessages caps the number of messages
+	MaxMessages int
+	// MaxPromptChars caps the total length of the message contents
+	MaxPromptChars int
+	// MaxTokens caps the requested max_tokens
+	MaxTokens int
+}
+
+// maxChoices is the most choices a request may ask for with n, as in
+// OpenAI's API
+const maxChoices = 128
+
+// maxStopSequences is the most stop sequences a request may set, as in
+// OpenAI's API
+const maxStopSequences = 4
+
+// maxTopLogprobs is the most alternatives per token a request may ask for
+// with top_logprobs, as in OpenAI's API
+const maxTopLogprobs = 20
+
+// DefaultRequestLimits returns the limits used when none are configured
+func DefaultRequestLimits() RequestLimits {
+	return RequestLimits{
+		MaxBodyBytes:   4 << 20,
+		MaxMessages:    1000,
+		MaxPromptChars: 1000000,
+	}
+}
+
+// SetRequestLimits replaces the chat completion request limits
+func (r *Router) SetRequestLimits(limits RequestLimits) {
+	r.limits = limits
+}
+
+// validateChatRequest checks a chat request is complete and within limits
+func (r *Router) validateChatRequest(req *providers.ChatRequest) error {
+	if req.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("messages must not be empty")
+	}
+	if r.limits.MaxMessages > 0 && len(req.Messages) > r.limits.MaxMessages {
+		return fmt.Errorf("too many messages: %d exceeds the limit of %d", len(req.Messages), r.limits.MaxMessages)
+	}
+	for _, msg := range req.Messages {
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case providers.ContentPartText:
+			case providers.ContentPartImageURL:
+				if part.ImageURL == nil || part.ImageURL.URL == "" {
+					return fmt.Errorf("image_url content part requires a url")
+				}
+			default:
+				return fmt.Errorf("unsupported content part type %q", part.Type)
+			}
+		}
+	}
+	if r.limits.MaxPromptChars > 0 {
+		chars := 0
+		for _, msg := range req.Messages {
+			chars += len(msg.Content)
+		}
+		if chars > r.limits.MaxPromptChars {
+			return fmt.Errorf("prompt too long: %d characters exceeds the limit of %d", chars, r.limits.MaxPromptChars)
+		}
+	}
+	if req.N < 0 || req.N > maxChoices {
+		return fmt.Errorf("n must be between 1 and %d", maxChoices)
+	}
+	if len(req.Stop) > maxStopSequences {
+		return fmt.Errorf("stop must have at most %d sequences", maxStopSequences)
+	}
+	for _, stop := range req.Stop {
+		if stop == "" {
+			return fmt.Errorf("stop sequences must not be empty")
+		}
+	}
+	if req.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if req.TopLogprobs < 0 || req.TopLogprobs > maxTopLogprobs {
+		return fmt.Errorf("top_logprobs must be between 0 and %d", maxTopLogprobs)
+	}
+	if req.TopLogprobs > 0 && !req.Logprobs {
+		return fmt.Errorf("top_logprobs requires logprobs")
+	}
+	if r.limits.MaxTokens > 0 && req.MaxTokens > r.limits.MaxTokens {
+		return fmt.Errorf("max_tokens %d exceeds the limit of %d", req.MaxTokens, r.limits.MaxTokens)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+func TestChatRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := &stubProvider{name: "openai"}
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+	r.SetRequestLimits(RequestLimits{MaxBodyBytes: 1024, MaxMessages: 2, MaxPromptChars: 10, MaxTokens: 100})
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	cases := []struct {
+		name  string
+		body  string
+		code  int
+		error string
+	}{
+		{"missing model", `{"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "model is required"},
+		{"empty messages", `{"model":"gpt-4","messages":[]}`, http.StatusBadRequest, "messages must not be empty"},
+		{"too many messages", `{"model":"gpt-4","messages":[{"role":"user","content":"a"},{"role":"user","content":"b"},{"role":"user","content":"c"}]}`, http.StatusBadRequest, "too many messages"},
+		{"prompt too long", `{"model":"gpt-4","messages":[{"role":"user","content":"Hello, world"}]}`, http.StatusBadRequest, "prompt too long"},
+		{"max_tokens over limit", `{"model":"gpt-4","max_tokens":500,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "max_tokens 500 exceeds"},
+		{"body too large", `{"model":"gpt-4","messages":[{"role":"user","content":"` + strings.Repeat("x", 2048) + `"}]}`, http.StatusRequestEntityTooLarge, "request body exceeds"},
+		{"unknown content part", `{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"audio"}]}]}`, http.StatusBadRequest, "unsupported content part type"},
+		{"image without url", `{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"image_url"}]}]}`, http.StatusBadRequest, "requires a url"},
+		{"n over limit", `{"model":"gpt-4","n":500,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "n must be between 1 and 128"},
+		{"too many stop sequences", `{"model":"gpt-4","stop":["a","b","c","d","e"],"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "stop must have at most 4 sequences"},
+		{"top_logprobs over limit", `{"model":"gpt-4","logprobs":true,"top_logprobs":21,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "top_logprobs must be between 0 and 20"},
+		{"top_logprobs without logprobs", `{"model":"gpt-4","top_logprobs":5,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "top_logprobs requires logprobs"},
+		{"empty stop sequence", `{"model":"gpt-4","stop":"","messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, "stop sequences must not be empty"},
+		{"within limits", `{"model":"gpt-4","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusOK, ""},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tc.body))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.name)
+		assert.Contains(t, w.Body.String(), tc.error, tc.name)
+	}
+	assert.Equal(t, 1, provider.calls)
+}
+
+func TestModelAliasResolution(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", &stubProvider{name: "openai"})
+	r.SetModelAlias("fast", "gpt-3.5-turbo")
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	for alias, model := range map[string]string{"gpt": "gpt-4o-mini", "fast": "gpt-3.5-turbo", "gpt-4": "gpt-4"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"`+alias+`","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, alias)
+		assert.Contains(t, w.Body.String(), `"model":"`+model+`"`, alias)
+	}
+}
@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/buildinfo"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+)
+
+// BackendInfo describes a registered provider backend. BaseURL is empty
+// for providers that don't call an HTTP API.
+type BackendInfo struct {
+	Name    string `json:"name"`
+	Region  string `json:"region,omitempty"`
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// Backends lists the registered provider backends by name and region, with
+// credentials in their base URLs redacted
+func (r *Router) Backends() []BackendInfo {
+	r.providersMu.RLock()
+	var backends []BackendInfo
+	for name, registered := range r.providers {
+		for _, backend := range registered {
+			info := BackendInfo{Name: name, Region: backend.region}
+			if endpoint, ok := backend.provider.(providers.EndpointProvider); ok {
+				info.BaseURL = redactURL(endpoint.BaseURL())
+			}
+			backends = append(backends, info)
+		}
+	}
+	r.providersMu.RUnlock()
+
+	sort.SliceStable(backends, func(i, j int) bool {
+		if backends[i].Name != backends[j].Name {
+			return backends[i].Name < backends[j].Name
+		}
+		return backends[i].Region < backends[j].Region
+	})
+	return backends
+}
+
+// redactedQueryParams are query parameters that carry API keys
+var redactedQueryParams = []string{"key", "api_key", "api-key", "access_token"}
+
+// redactURL hides the password and API key query parameters of a URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if query := u.Query(); len(query) > 0 {
+		for _, param := range redactedQueryParams {
+			if query.Has(param) {
+				query.Set(param, "REDACTED")
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// HandleVersion reports the version of the running build and the
+// registered provider backends, so operators can confirm what a pod runs
+func (r *Router) HandleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, struct {
+		buildinfo.Info
+		Providers []BackendInfo `json:"providers"`
+	}{buildinfo.Get(), r.Backends()})
+}
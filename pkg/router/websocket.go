@@ -0,0 +1,217 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/middleware"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// wsCancel is the type of the message a WebSocket client sends to stop the
+// generation
+const wsCancel = "cancel"
+
+// errStreamCancelled reports a WebSocket stream stopped by its client
+var errStreamCancelled = errors.New("stream cancelled by client")
+
+// wsClientMessage is a message sent by a WebSocket client after its request
+type wsClientMessage struct {
+	Type string `json:"type"`
+}
+
+// HandleChatStream streams chat completions over a WebSocket. The client
+// sends a chat request as its first message; the completion is sent back as
+// one frame per chunk, in the same format as the server-sent events of
+// HandleChatCompletion, followed by a "[DONE]" frame. Failures are sent as
+// an {"error": {...}} frame. Sending {"type": "cancel"}, or closing the
+// socket, cancels the upstream request. WebSocket streams bypass the cache.
+func (r *Router) HandleChatStream(c *gin.Context) {
+	if r.refuseWhileDraining(c) {
+		return
+	}
+	userID := r.userID(c)
+	if userID == "" {
+		respondError(c, http.StatusUnauthorized, errors.New("missing user ID"))
+		return
+	}
+	priority, err := ratelimit.ParsePriority(c.GetHeader("X-Priority"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// websocket.Server skips the Origin check of websocket.Handler, which
+	// would refuse clients other than browsers
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		r.serveChatStream(c, ws, userID, priority)
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveChatStream serves the chat request received on ws
+func (r *Router) serveChatStream(c *gin.Context, ws *websocket.Conn, userID string, priority ratelimit.Priority) {
+	start := time.Now()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	var req providers.ChatRequest
+	if err := websocket.JSON.Receive(ws, &req); err != nil {
+		sendWSError(ws, http.StatusBadRequest, fmt.Errorf("invalid chat request: %w", err))
+		return
+	}
+	req.Stream = true
+	if err := r.validateChatRequest(&req); err != nil {
+		sendWSError(ws, http.StatusBadRequest, err)
+		return
+	}
+	if err := r.filterRequest(ctx, &req); err != nil {
+		sendWSError(ws, statusForError(err), err)
+		return
+	}
+	req.Model = r.resolveModel(req.Model)
+	r.applyProviderDefaults(&req)
+
+	if !r.modelAllowed(c, userID, req.Model) {
+		sendWSError(ws, http.StatusForbidden, fmt.Errorf("model not allowed: %s", req.Model))
+		return
+	}
+	rateLimitCost := r.chatRateLimitCost(&req)
+	decision, err := r.allowRequest(ctx, apiKeyID(c), userID, req.Model, priority, rateLimitCost)
+	if err != nil {
+		middleware.RecordRateLimitExceeded(userID)
+		sendWSError(ws, http.StatusTooManyRequests, err)
+		return
+	}
+	if decision.SoftExceeded {
+		middleware.RecordRateLimitWarning()
+	}
+	if r.budget != nil && r.budget.Cap(userID) > 0 {
+		promptTokens, completionTokens := estimateTokens(&req)
+		allowed, err := r.budget.Allow(userID, r.budget.EstimateCost(req.Model, promptTokens, completionTokens))
+		if err != nil {
+			sendWSError(ws, http.StatusInternalServerError, err)
+			return
+		}
+		if !allowed {
+			sendWSError(ws, http.StatusPaymentRequired, errBudgetExceeded)
+			return
+		}
+	}
+
+	providerName := r.getProviderFromModel(req.Model)
+	provider, ok := r.getProvider(providerName)
+	if !ok {
+		sendWSError(ws, http.StatusBadRequest, fmt.Errorf("unsupported model: %s", req.Model))
+		return
+	}
+	streamer, ok := provider.(providers.StreamingProvider)
+	if !ok {
+		sendWSError(ws, http.StatusBadRequest, fmt.Errorf("streaming not supported by provider: %s", provider.Name()))
+		return
+	}
+
+	if !r.streams.acquire() {
+		sendWSError(ws, http.StatusServiceUnavailable, errors.New("server is shutting down"))
+		return
+	}
+	defer r.streams.release()
+
+	call := &callLog{requestID: middleware.RequestIDFromContext(ctx), userID: userID, provider: providerName, model: req.Model, stream: true, req: &req, cache: cacheBypass}
+	defer func() { r.logCall(call, time.Since(start)) }()
+
+	streamStart := time.Now()
+	chunks, err := streamer.ChatCompletionStream(ctx, &req)
+	if err != nil {
+		err = tagRequestID(ctx, err)
+		middleware.RecordLLMRequest(provider.Name(), req.Model, "error", false, time.Since(streamStart), 0, 0)
+		call.err = err
+		sendWSError(ws, statusForError(err), err)
+		return
+	}
+
+	// The client may cancel at any time; a closed socket cancels too
+	cancelled := make(chan struct{})
+	go func() {
+		defer cancel()
+		for {
+			var msg wsClientMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			if msg.Type == wsCancel {
+				close(cancelled)
+				return
+			}
+		}
+	}()
+
+	created := time.Now().Unix()
+	recorder := newStreamRecorder(created)
+
+	// However the stream ends, the tokens it used are accounted for
+	defer func() {
+		if call.resp == nil {
+			recorder.estimateUsage(&req)
+			call.resp = recorder.response()
+		}
+		r.recordStreamUsage(userID, provider, &req, call.resp, time.Since(streamStart), call.err)
+		r.reconcileRateLimit(c, userID, req.Model, rateLimitCost, call.resp.Usage.TotalTokens)
+	}()
+
+	reader := r.newChunkReader(provider.Name(), chunks)
+	for {
+		chunk, ok := reader.next()
+		if !ok || ctx.Err() != nil {
+			break
+		}
+		if chunk.Err != nil {
+			call.err = tagRequestID(ctx, chunk.Err)
+			sendWSError(ws, statusForError(call.err), call.err)
+			return
+		}
+		if chunk.RequestID != "" {
+			continue
+		}
+		recorder.add(chunk)
+		if err := websocket.JSON.Send(ws, openAIChunk(chunk, created)); err != nil {
+			call.err = err
+			return
+		}
+	}
+
+	select {
+	case <-cancelled:
+		call.err = errStreamCancelled
+		sendWSError(ws, http.StatusBadRequest, errStreamCancelled)
+		return
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		call.err = fmt.Errorf("stream aborted: %w", err)
+		return
+	}
+
+	recorder.estimateUsage(&req)
+	resp, err := r.filterResponse(ctx, recorder.response())
+	if err != nil {
+		call.err = err
+		sendWSError(ws, statusForError(err), err)
+		return
+	}
+	call.resp = resp
+	_ = websocket.Message.Send(ws, "[DONE]")
+}
+
+// sendWSError sends an error frame, in the error envelope of the status
+// the error would have had over HTTP; a client that is gone is ignored
+func sendWSError(ws *websocket.Conn, status int, err error) {
+	_ = websocket.JSON.Send(ws, errorResponse(status, err))
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
+	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
+)
+
+// cancellableStreamProvider streams a delta, then holds the stream open
+// until it is cancelled or released
+type cancellableStreamProvider struct {
+	stubProvider
+	release   chan struct{}
+	cancelled chan struct{}
+}
+
+func (p *cancellableStreamProvider) ChatCompletionStream(ctx context.Context, req *providers.ChatRequest) (<-chan providers.StreamChunk, error) {
+	chunks := make(chan providers.StreamChunk)
+	go func() {
+		defer close(chunks)
+		chunks <- providers.StreamChunk{ID: "stream-1", Model: req.Model, Role: "assistant", Content: "Hello"}
+		select {
+		case <-p.release:
+			chunks <- providers.StreamChunk{ID: "stream-1", Model: req.Model, FinishReason: "stop"}
+		case <-ctx.Done():
+			close(p.cancelled)
+		}
+	}()
+	return chunks, nil
+}
+
+func dialChatStream(t *testing.T, provider providers.Provider) *websocket.Conn {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(nil, ratelimit.NewRateLimiter(100, 1))
+	r.RegisterProvider("openai", provider)
+
+	engine := gin.New()
+	engine.GET("/v1/chat/stream", r.HandleChatStream)
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/chat/stream", server.URL)
+	assert.NoError(t, err)
+	config.Header.Set("X-User-ID", "test-user")
+	ws, err := websocket.DialConfig(config)
+	assert.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+
+	assert.NoError(t, websocket.Message.Send(ws, `{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`))
+	return ws
+}
+
+func receiveFrame(t *testing.T, ws *websocket.Conn) string {
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var frame string
+	assert.NoError(t, websocket.Message.Receive(ws, &frame))
+	return frame
+}
+
+func TestChatStreamOverWebSocket(t *testing.T) {
+	provider := &cancellableStreamProvider{stubProvider: stubProvider{name: "openai"}, release: make(chan struct{}), cancelled: make(chan struct{})}
+	close(provider.release)
+	ws := dialChatStream(t, provider)
+
+	var chunk providers.ChatStreamChunk
+	assert.NoError(t, json.Unmarshal([]byte(receiveFrame(t, ws)), &chunk))
+	assert.Equal(t, "chat.completion.chunk", chunk.Object)
+	assert.Equal(t, "Hello", chunk.Choices[0].Delta.Content)
+
+	assert.Contains(t, receiveFrame(t, ws), `"finish_reason":"stop"`)
+	assert.Equal(t, "[DONE]", receiveFrame(t, ws))
+}
+
+func TestChatStreamCancelMessage(t *testing.T) {
+	provider := &cancellableStreamProvider{stubProvider: stubProvider{name: "openai"}, release: make(chan struct{}), cancelled: make(chan struct{})}
+	ws := dialChatStream(t, provider)
+
+	assert.Contains(t, receiveFrame(t, ws), "Hello")
+	assert.NoError(t, websocket.JSON.Send(ws, wsClientMessage{Type: wsCancel}))
+
+	select {
+	case <-provider.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the upstream stream was not cancelled")
+	}
+	assert.Contains(t, receiveFrame(t, ws), "stream cancelled by client")
+}
+
+func TestChatStreamReportsErrors(t *testing.T) {
+	ws := dialChatStream(t, &stubProvider{name: "openai"})
+	assert.Contains(t, receiveFrame(t, ws), "streaming not supported by provider")
+}
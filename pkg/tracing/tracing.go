@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// OTLP transport protocols
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+// Samplers
+const (
+	SamplerAlways = "always"
+	SamplerNever  = "never"
+	SamplerRatio  = "ratio"
+)
+
+// Config configures how spans are sampled and where they are exported
+type Config struct {
+	// ServiceName identifies the gateway's spans
+	ServiceName string
+
+	// Endpoint is the URL of the OTLP collector, such as
+	// http://localhost:4318 for ProtocolHTTP or http://localhost:4317 for
+	// ProtocolGRPC; an http URL disables TLS. With no endpoint nothing is
+	// traced.
+	Endpoint string
+	Protocol string
+
+	// Sampler decides which traces starting at the gateway are recorded:
+	// SamplerAlways, SamplerNever, or SamplerRatio to record SampleRatio of
+	// them. Traces started by a caller keep the caller's decision.
+	Sampler     string
+	SampleRatio float64
+}
+
+// Provider is a tracer provider that flushes its buffered spans on Shutdown
+type Provider interface {
+	trace.TracerProvider
+	Shutdown(ctx context.Context) error
+}
+
+// noopProvider creates spans that are neither recorded nor exported
+type noopProvider struct {
+	noop.TracerProvider
+}
+
+// Shutdown implements Provider
+func (noopProvider) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// NewTracerProvider creates a tracer provider that samples spans as
+// configured and exports them to the OTLP collector, or a no-op provider
+// if no collector is configured. Shut it down to flush the spans still
+// buffered.
+func NewTracerProvider(ctx context.Context, cfg Config) (Provider, error) {
+	if cfg.Endpoint == "" {
+		// Still reject a bad sampler so the mistake surfaces before a
+		// collector is configured
+		if _, err := newSampler(cfg); err != nil {
+			return nil, err
+		}
+		return noopProvider{}, nil
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	tp, err := newTracerProvider(cfg, exporter)
+	if err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// newTracerProvider creates a tracer provider that batches the sampled
+// spans to exporter
+func newTracerProvider(cfg Config, exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(cfg.ServiceName),
+		)),
+		sdktrace.WithBatcher(exporter),
+	), nil
+}
+
+// newSampler returns the sampler of traces starting at the gateway
+func newSampler(cfg Config) (sdktrace.Sampler, error) {
+	switch cfg.Sampler {
+	case SamplerAlways, "":
+		return sdktrace.AlwaysSample(), nil
+	case SamplerNever:
+		return sdktrace.NeverSample(), nil
+	case SamplerRatio:
+		if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+			return nil, fmt.Errorf("sample ratio must be between 0 and 1, got %g", cfg.SampleRatio)
+		}
+		return sdktrace.TraceIDRatioBased(cfg.SampleRatio), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", cfg.Sampler)
+}
+
+// newExporter returns an OTLP exporter sending spans to the endpoint over
+// the configured protocol
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	// The exporters take the endpoint as a host, and a path for HTTP
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", cfg.Endpoint)
+	}
+
+	switch cfg.Protocol {
+	case ProtocolHTTP, "":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case ProtocolGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+	return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.Protocol)
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+func TestSamplers(t *testing.T) {
+	cases := []struct {
+		sampler string
+		ratio   float64
+		sampled bool
+	}{
+		{SamplerAlways, 0, true},
+		{SamplerNever, 0, false},
+		{SamplerRatio, 0, false},
+		{SamplerRatio, 1, true},
+	}
+
+	for _, tc := range cases {
+		tp, err := newTracerProvider(Config{ServiceName: "test", Sampler: tc.sampler, SampleRatio: tc.ratio}, tracetest.NewInMemoryExporter())
+		assert.NoError(t, err)
+		_, span := tp.Tracer("test").Start(context.Background(), "op")
+		assert.Equal(t, tc.sampled, span.SpanContext().IsSampled(), "%s %g", tc.sampler, tc.ratio)
+		span.End()
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	}
+}
+
+func TestExportsSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp, err := newTracerProvider(Config{ServiceName: "ai-gateway", Sampler: SamplerAlways}, exporter)
+	assert.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	_, child := tp.Tracer("test").Start(ctx, "provider call")
+	child.End()
+	parent.End()
+
+	// Flushing sends the batch; the exporter forgets its spans on shutdown
+	assert.NoError(t, tp.ForceFlush(context.Background()))
+	defer tp.Shutdown(context.Background())
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "provider call", spans[0].Name)
+		assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+		assert.Contains(t, spans[0].Resource.Attributes(), semconv.ServiceNameKey.String("ai-gateway"))
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	var exported atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			exported.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	tp, err := NewTracerProvider(context.Background(), Config{ServiceName: "test", Endpoint: collector.URL, Protocol: ProtocolHTTP})
+	assert.NoError(t, err)
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	span.End()
+
+	// Shutting down flushes the batch
+	assert.NoError(t, tp.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), exported.Load())
+}
+
+func TestNoEndpointIsNoop(t *testing.T) {
+	tp, err := NewTracerProvider(context.Background(), Config{ServiceName: "test"})
+	assert.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	assert.False(t, span.IsRecording())
+	span.End()
+	assert.NoError(t, tp.Shutdown(context.Background()))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Endpoint: "http://localhost:4318", Protocol: "thrift"},
+		{Endpoint: "collector:4318"},
+		{Sampler: "sometimes"},
+		{Sampler: SamplerRatio, SampleRatio: 1.5},
+	} {
+		_, err := NewTracerProvider(context.Background(), cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+}
@@ -0,0 +1,70 @@
+package usage
+
+import "sync"
+
+// BudgetLimit enforces monthly spend caps in USD on top of a UsageTracker
+type BudgetLimit struct {
+	tracker    *UsageTracker
+	defaultCap float64
+	userCaps   map[string]float64
+	mu         sync.RWMutex
+}
+
+// NewBudgetLimit creates a new budget limit. A cap of 0 means unlimited.
+func NewBudgetLimit(tracker *UsageTracker, defaultCap float64) *BudgetLimit {
+	return &BudgetLimit{
+		tracker:    tracker,
+		defaultCap: defaultCap,
+		userCaps:   make(map[string]float64),
+	}
+}
+
+// SetUserCap overrides the monthly cap of a user
+func (b *BudgetLimit) SetUserCap(userID string, cap float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.userCaps[userID] = cap
+}
+
+// SetCaps replaces the default cap and all per-user caps at once
+func (b *BudgetLimit) SetCaps(defaultCap float64, userCaps map[string]float64) {
+	caps := make(map[string]float64, len(userCaps))
+	for userID, cap := range userCaps {
+		caps[userID] = cap
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.defaultCap = defaultCap
+	b.userCaps = caps
+}
+
+// Cap returns the monthly cap of a user
+func (b *BudgetLimit) Cap(userID string) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if cap, ok := b.userCaps[userID]; ok {
+		return cap
+	}
+	return b.defaultCap
+}
+
+// EstimateCost returns the cost of a request to a model from token counts
+func (b *BudgetLimit) EstimateCost(model string, promptTokens, completionTokens int) float64 {
+	return b.tracker.cost(Record{Model: model, PromptTokens: promptTokens, CompletionTokens: completionTokens})
+}
+
+// Allow reports whether a request with the estimated cost fits in the
+// user's remaining monthly budget
+func (b *BudgetLimit) Allow(userID string, estimatedCost float64) (bool, error) {
+	cap := b.Cap(userID)
+	if cap <= 0 {
+		return true, nil
+	}
+
+	stats, err := b.tracker.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	return stats.Month.Cost+estimatedCost <= cap, nil
+}
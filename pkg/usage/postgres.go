@@ -0,0 +1,182 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// maxInsertRows is the most records inserted by one statement, well below
+// the Postgres limit of 65535 parameters per statement
+const maxInsertRows = 1000
+
+// usageAggregates selects the sums of a UsageWindow
+const usageAggregates = "COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cached_tokens), 0) AS cached_tokens, COALESCE(SUM(reasoning_tokens), 0) AS reasoning_tokens, COUNT(*) AS requests, COALESCE(SUM(cost), 0) AS cost"
+
+// groupColumns are the expressions usage is grouped by
+var groupColumns = map[string]string{
+	GroupByModel:    "model",
+	GroupByProvider: "provider",
+	GroupByDay:      "to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')",
+}
+
+// usageRow is a usage record as stored in Postgres
+type usageRow struct {
+	ID               uint64    `gorm:"primaryKey"`
+	UserID           string    `gorm:"not null;index:idx_usage_records_user_time,priority:1"`
+	Provider         string    `gorm:"not null"`
+	Model            string    `gorm:"not null"`
+	PromptTokens     int       `gorm:"not null"`
+	CompletionTokens int       `gorm:"not null"`
+	CachedTokens     int       `gorm:"not null;default:0"`
+	ReasoningTokens  int       `gorm:"not null;default:0"`
+	Cost             float64   `gorm:"not null"`
+	CreatedAt        time.Time `gorm:"not null;index:idx_usage_records_user_time,priority:2"`
+}
+
+// TableName implements gorm's schema.Tabler
+func (usageRow) TableName() string {
+	return "usage_records"
+}
+
+// PostgresUsageStore keeps every usage record in Postgres, as a durable
+// history that can be aggregated over any time range. Records are priced
+// when they are written.
+type PostgresUsageStore struct {
+	pricer
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewPostgresUsageStore creates a usage store over an open database
+func NewPostgresUsageStore(db *gorm.DB, prices PriceTable) *PostgresUsageStore {
+	return &PostgresUsageStore{
+		pricer: pricer{prices: prices},
+		db:     db,
+		now:    time.Now,
+	}
+}
+
+// OpenPostgresUsageStore connects to the Postgres database at dsn
+func OpenPostgresUsageStore(dsn string, prices PriceTable) (*PostgresUsageStore, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	return NewPostgresUsageStore(db, prices), nil
+}
+
+// Migrate creates or updates the usage_records table and its index
+func (s *PostgresUsageStore) Migrate(ctx context.Context) error {
+	if err := s.db.WithContext(ctx).AutoMigrate(&usageRow{}); err != nil {
+		return fmt.Errorf("failed to migrate usage_records: %w", err)
+	}
+	return nil
+}
+
+// WriteUsage inserts a batch of records with multi-row inserts
+func (s *PostgresUsageStore) WriteUsage(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	rows := make([]usageRow, len(records))
+	for i, record := range records {
+		rows[i] = usageRow{
+			UserID:           record.UserID,
+			Provider:         record.Provider,
+			Model:            record.Model,
+			PromptTokens:     record.PromptTokens,
+			CompletionTokens: record.CompletionTokens,
+			CachedTokens:     record.CachedTokens,
+			ReasoningTokens:  record.ReasoningTokens,
+			Cost:             s.cost(record),
+			CreatedAt:        record.Time,
+		}
+	}
+	if err := s.db.WithContext(ctx).CreateInBatches(rows, maxInsertRows).Error; err != nil {
+		return fmt.Errorf("failed to insert usage records: %w", err)
+	}
+	return nil
+}
+
+// Usage returns the user's usage from from up to, but excluding, to
+func (s *PostgresUsageStore) Usage(ctx context.Context, userID string, from, to time.Time) (UsageWindow, error) {
+	var w UsageWindow
+	err := s.db.WithContext(ctx).Model(&usageRow{}).
+		Select(usageAggregates).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, from, to).
+		Scan(&w).Error
+	if err != nil {
+		return UsageWindow{}, fmt.Errorf("failed to get usage: %w", err)
+	}
+	w.TotalTokens = w.PromptTokens + w.CompletionTokens
+	return w, nil
+}
+
+// Report implements UsageHistory. Groups are ordered by model, provider
+// or day.
+func (s *PostgresUsageStore) Report(ctx context.Context, userID string, from, to time.Time, groupBy string) (UsageReport, error) {
+	report := UsageReport{UserID: userID, From: from, To: to, GroupBy: groupBy}
+
+	var err error
+	if report.Total, err = s.Usage(ctx, userID, from, to); err != nil {
+		return report, err
+	}
+	if groupBy == "" {
+		return report, nil
+	}
+
+	column, ok := groupColumns[groupBy]
+	if !ok {
+		return report, fmt.Errorf("unknown usage grouping %q", groupBy)
+	}
+	err = s.db.WithContext(ctx).Model(&usageRow{}).
+		Select(column+` AS "group", `+usageAggregates).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, from, to).
+		Group(column).
+		Order(column).
+		Scan(&report.Groups).Error
+	if err != nil {
+		return report, fmt.Errorf("failed to get usage: %w", err)
+	}
+	for i := range report.Groups {
+		w := &report.Groups[i].UsageWindow
+		w.TotalTokens = w.PromptTokens + w.CompletionTokens
+	}
+	return report, nil
+}
+
+// Get returns the user's usage for the current day and month (UTC), as
+// UsageTracker does
+func (s *PostgresUsageStore) Get(userID string) (UsageStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	now := s.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	stats := UsageStats{UserID: userID}
+	var err error
+	if stats.Day, err = s.Usage(ctx, userID, day, day.AddDate(0, 0, 1)); err != nil {
+		return stats, err
+	}
+	if stats.Month, err = s.Usage(ctx, userID, month, month.AddDate(0, 1, 0)); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// Close closes the database connections
+func (s *PostgresUsageStore) Close() error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,107 @@
+package usage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newMockStore(t *testing.T) (*PostgresUsageStore, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPostgresUsageStore(db, PriceTable{"gpt-4": {PromptPer1K: 0.03, CompletionPer1K: 0.06}}), mock
+}
+
+func TestPostgresWriteUsage(t *testing.T) {
+	store, mock := newMockStore(t)
+	at := time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	// Both records go in a single insert, priced at the store's prices
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "usage_records" ("user_id","provider","model","prompt_tokens","completion_tokens","cached_tokens","reasoning_tokens","cost","created_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9),($10,$11,$12,$13,$14,$15,$16,$17,$18) RETURNING "id"`)).
+		WithArgs("user-1", "openai", "gpt-4", 1000, 500, 0, 0, 0.06, at, "user-2", "azure", "unpriced", 10, 5, 0, 0, 0.0, at).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
+
+	err := store.WriteUsage(context.Background(), []Record{
+		{UserID: "user-1", Provider: "openai", Model: "gpt-4", PromptTokens: 1000, CompletionTokens: 500, Time: at},
+		{UserID: "user-2", Provider: "azure", Model: "unpriced", PromptTokens: 10, CompletionTokens: 5, Time: at},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresUsage(t *testing.T) {
+	store, mock := newMockStore(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cached_tokens), 0) AS cached_tokens, COALESCE(SUM(reasoning_tokens), 0) AS reasoning_tokens, COUNT(*) AS requests, COALESCE(SUM(cost), 0) AS cost FROM "usage_records" WHERE user_id = $1 AND created_at >= $2 AND created_at < $3`)).
+		WithArgs("user-1", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"prompt_tokens", "completion_tokens", "requests", "cost"}).AddRow(3000, 1500, 3, 0.18))
+
+	w, err := store.Usage(context.Background(), "user-1", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, UsageWindow{PromptTokens: 3000, CompletionTokens: 1500, TotalTokens: 4500, Requests: 3, Cost: 0.18}, w)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresGet(t *testing.T) {
+	store, mock := newMockStore(t)
+	store.now = func() time.Time { return time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC) }
+
+	query := regexp.QuoteMeta(`FROM "usage_records" WHERE user_id = $1 AND created_at >= $2 AND created_at < $3`)
+	columns := []string{"prompt_tokens", "completion_tokens", "requests", "cost"}
+	mock.ExpectQuery(query).
+		WithArgs("user-1", time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(10, 5, 1, 0.01))
+	mock.ExpectQuery(query).
+		WithArgs("user-1", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(100, 50, 4, 0.1))
+
+	stats, err := store.Get("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Day.Requests)
+	assert.Equal(t, 150, stats.Month.TotalTokens)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresReportByModel(t *testing.T) {
+	store, mock := newMockStore(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	columns := []string{"prompt_tokens", "completion_tokens", "requests", "cost"}
+	mock.ExpectQuery(regexp.QuoteMeta(`AS cost FROM "usage_records" WHERE user_id = $1 AND created_at >= $2 AND created_at < $3`)).
+		WithArgs("user-1", from, to).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3000, 1500, 3, 0.18))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT model AS "group", COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cached_tokens), 0) AS cached_tokens, COALESCE(SUM(reasoning_tokens), 0) AS reasoning_tokens, COUNT(*) AS requests, COALESCE(SUM(cost), 0) AS cost FROM "usage_records" WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 GROUP BY "model" ORDER BY model`)).
+		WithArgs("user-1", from, to).
+		WillReturnRows(sqlmock.NewRows(append([]string{"group"}, columns...)).
+			AddRow("gpt-4", 2000, 1000, 2, 0.12).
+			AddRow("gpt-4o", 1000, 500, 1, 0.06))
+
+	report, err := store.Report(context.Background(), "user-1", from, to, GroupByModel)
+	assert.NoError(t, err)
+	assert.Equal(t, 4500, report.Total.TotalTokens)
+	assert.Equal(t, []UsageGroup{
+		{Group: "gpt-4", UsageWindow: UsageWindow{PromptTokens: 2000, CompletionTokens: 1000, TotalTokens: 3000, Requests: 2, Cost: 0.12}},
+		{Group: "gpt-4o", UsageWindow: UsageWindow{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500, Requests: 1, Cost: 0.06}},
+	}, report.Groups)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,93 @@
+package usage
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelPrice is the price of a model in USD per 1K tokens
+type ModelPrice struct {
+	PromptPer1K     float64 `json:"prompt_per_1k" yaml:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k" yaml:"completion_per_1k"`
+
+	// CachedPromptPer1K is the discounted price of prompt tokens read from
+	// the provider's prompt cache. Zero bills them as other prompt tokens.
+	CachedPromptPer1K float64 `json:"cached_prompt_per_1k,omitempty" yaml:"cached_prompt_per_1k"`
+}
+
+// Cost returns the cost in USD of a completion, cachedTokens of whose
+// promptTokens were read from the prompt cache
+func (p ModelPrice) Cost(promptTokens, cachedTokens, completionTokens int) float64 {
+	cachedPrice := p.CachedPromptPer1K
+	if cachedPrice == 0 {
+		cachedPrice = p.PromptPer1K
+	}
+	return float64(promptTokens-cachedTokens)/1000*p.PromptPer1K +
+		float64(cachedTokens)/1000*cachedPrice +
+		float64(completionTokens)/1000*p.CompletionPer1K
+}
+
+// PriceTable maps model names, or model name prefixes, to their price
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable returns list prices for common models
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"gpt-4o-mini":       {PromptPer1K: 0.00015, CompletionPer1K: 0.0006, CachedPromptPer1K: 0.000075},
+		"gpt-4o":            {PromptPer1K: 0.0025, CompletionPer1K: 0.01, CachedPromptPer1K: 0.00125},
+		"gpt-4-turbo":       {PromptPer1K: 0.01, CompletionPer1K: 0.03},
+		"gpt-4":             {PromptPer1K: 0.03, CompletionPer1K: 0.06},
+		"gpt-3.5-turbo":     {PromptPer1K: 0.0005, CompletionPer1K: 0.0015},
+		"claude-3-opus":     {PromptPer1K: 0.015, CompletionPer1K: 0.075, CachedPromptPer1K: 0.0015},
+		"claude-3-5-sonnet": {PromptPer1K: 0.003, CompletionPer1K: 0.015, CachedPromptPer1K: 0.0003},
+		"claude-3-sonnet":   {PromptPer1K: 0.003, CompletionPer1K: 0.015},
+		"claude-3-5-haiku":  {PromptPer1K: 0.0008, CompletionPer1K: 0.004, CachedPromptPer1K: 0.00008},
+		"claude-3-haiku":    {PromptPer1K: 0.00025, CompletionPer1K: 0.00125, CachedPromptPer1K: 0.00003},
+	}
+}
+
+// Price returns the price of a model. An exact match wins, otherwise the
+// longest matching prefix is used. Unknown models are free.
+func (pt PriceTable) Price(model string) (ModelPrice, bool) {
+	if price, ok := pt[model]; ok {
+		return price, true
+	}
+
+	best := ""
+	for prefix := range pt {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return pt[best], true
+}
+
+// Cost returns the cost in USD of a request to a model
+func (pt PriceTable) Cost(model string, promptTokens, completionTokens int) float64 {
+	price, _ := pt.Price(model)
+	return price.Cost(promptTokens, 0, completionTokens)
+}
+
+// pricer prices usage at a price table that can be replaced at runtime
+type pricer struct {
+	prices   PriceTable
+	pricesMu sync.RWMutex
+}
+
+// SetPrices replaces the price table used for new records
+func (p *pricer) SetPrices(prices PriceTable) {
+	p.pricesMu.Lock()
+	defer p.pricesMu.Unlock()
+	p.prices = prices
+}
+
+// cost returns the cost of a record at the current prices
+func (p *pricer) cost(record Record) float64 {
+	p.pricesMu.RLock()
+	defer p.pricesMu.RUnlock()
+	price, _ := p.prices.Price(record.Model)
+	return price.Cost(record.PromptTokens, record.CachedTokens, record.CompletionTokens)
+}
@@ -0,0 +1,31 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceTableLongestPrefixWins(t *testing.T) {
+	prices := PriceTable{
+		"gpt-4":  {PromptPer1K: 0.03, CompletionPer1K: 0.06},
+		"gpt-4o": {PromptPer1K: 0.0025, CompletionPer1K: 0.01},
+	}
+
+	assert.InDelta(t, 0.03+0.06, prices.Cost("gpt-4-0613", 1000, 1000), 1e-9)
+	assert.InDelta(t, 0.0025+0.01, prices.Cost("gpt-4o-2024-08-06", 1000, 1000), 1e-9)
+	assert.Equal(t, 0.0, prices.Cost("unknown-model", 1000, 1000))
+}
+
+func TestCachedTokensAreDiscounted(t *testing.T) {
+	p := &pricer{prices: PriceTable{
+		"gpt-4o": {PromptPer1K: 0.0025, CompletionPer1K: 0.01, CachedPromptPer1K: 0.00125},
+		"gpt-4":  {PromptPer1K: 0.03, CompletionPer1K: 0.06},
+	}}
+
+	// 1000 of the 2000 prompt tokens were cached
+	assert.InDelta(t, 0.0025+0.00125+0.01, p.cost(Record{Model: "gpt-4o", PromptTokens: 2000, CachedTokens: 1000, CompletionTokens: 1000}), 1e-9)
+
+	// Without a cached price, cached tokens cost as much as the others
+	assert.InDelta(t, 0.06+0.06, p.cost(Record{Model: "gpt-4", PromptTokens: 2000, CachedTokens: 1000, CompletionTokens: 1000}), 1e-9)
+}
@@ -0,0 +1,41 @@
+package usage
+
+import (
+	"context"
+	"time"
+)
+
+// Groupings of usage reports
+const (
+	GroupByModel    = "model"
+	GroupByProvider = "provider"
+	GroupByDay      = "day"
+)
+
+// UsageGroup is the usage of one model, provider or day (YYYY-MM-DD, UTC)
+type UsageGroup struct {
+	Group string `json:"group"`
+	UsageWindow
+}
+
+// UsageReport is a user's usage over a time range, in total and, if
+// GroupBy is set, broken down by model, provider or day
+type UsageReport struct {
+	UserID  string       `json:"user_id"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	GroupBy string       `json:"group_by,omitempty"`
+	Total   UsageWindow  `json:"total"`
+	Groups  []UsageGroup `json:"groups,omitempty"`
+}
+
+// StatsReader reads a user's usage for the current day and month
+type StatsReader interface {
+	Get(userID string) (UsageStats, error)
+}
+
+// UsageHistory reports a user's usage from from up to, but excluding, to,
+// grouped by groupBy unless it is empty
+type UsageHistory interface {
+	Report(ctx context.Context, userID string, from, to time.Time, groupBy string) (UsageReport, error)
+}
@@ -0,0 +1,139 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// UsageWindow holds the usage accumulated over a time window
+type UsageWindow struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	Requests         int     `json:"requests"`
+	Cost             float64 `json:"cost"`
+}
+
+// UsageStats holds a user's usage for the current day and month
+type UsageStats struct {
+	UserID string      `json:"user_id"`
+	Day    UsageWindow `json:"day"`
+	Month  UsageWindow `json:"month"`
+}
+
+// UsageTracker records per-user token usage and cost in Redis, bucketed by
+// calendar day and month (UTC)
+type UsageTracker struct {
+	pricer
+	client *redis.Client
+	now    func() time.Time
+}
+
+// NewUsageTracker creates a new usage tracker
+func NewUsageTracker(client *redis.Client, prices PriceTable) *UsageTracker {
+	return &UsageTracker{
+		pricer: pricer{prices: prices},
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// Record adds the tokens and cost of a completion to the user's usage
+func (t *UsageTracker) Record(record Record) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	record.Time = t.now()
+	if err := t.WriteUsage(ctx, []Record{record}); err != nil {
+		return fmt.Errorf("failed to record usage for %s/%s: %w", record.Provider, record.Model, err)
+	}
+	return nil
+}
+
+// WriteUsage adds a batch of records to their users' usage in a single
+// transaction. Records are priced at the current prices and counted in the
+// day and month they were made.
+func (t *UsageTracker) WriteUsage(ctx context.Context, records []Record) error {
+	ttls := make(map[string]time.Duration)
+	windows := make(map[string]*UsageWindow)
+	for _, record := range records {
+		cost := t.cost(record)
+		dayKey, monthKey := t.keys(record.UserID, record.Time)
+		for key, ttl := range map[string]time.Duration{dayKey: 48 * time.Hour, monthKey: 62 * 24 * time.Hour} {
+			w, ok := windows[key]
+			if !ok {
+				w = &UsageWindow{}
+				windows[key] = w
+				ttls[key] = ttl
+			}
+			w.PromptTokens += record.PromptTokens
+			w.CompletionTokens += record.CompletionTokens
+			w.CachedTokens += record.CachedTokens
+			w.ReasoningTokens += record.ReasoningTokens
+			w.Requests++
+			w.Cost += cost
+		}
+	}
+
+	pipe := t.client.TxPipeline()
+	for key, w := range windows {
+		pipe.HIncrBy(ctx, key, "prompt_tokens", int64(w.PromptTokens))
+		pipe.HIncrBy(ctx, key, "completion_tokens", int64(w.CompletionTokens))
+		pipe.HIncrBy(ctx, key, "cached_tokens", int64(w.CachedTokens))
+		pipe.HIncrBy(ctx, key, "reasoning_tokens", int64(w.ReasoningTokens))
+		pipe.HIncrBy(ctx, key, "requests", int64(w.Requests))
+		pipe.HIncrByFloat(ctx, key, "cost", w.Cost)
+		pipe.Expire(ctx, key, ttls[key])
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Get returns the user's usage for the current day and month
+func (t *UsageTracker) Get(userID string) (UsageStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	stats := UsageStats{UserID: userID}
+	dayKey, monthKey := t.keys(userID, t.now())
+
+	var err error
+	if stats.Day, err = t.window(ctx, dayKey); err != nil {
+		return stats, err
+	}
+	if stats.Month, err = t.window(ctx, monthKey); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// keys returns the Redis keys of the user's day and month at a time
+func (t *UsageTracker) keys(userID string, at time.Time) (string, string) {
+	at = at.UTC()
+	return fmt.Sprintf("usage:%s:day:%s", userID, at.Format("2006-01-02")),
+		fmt.Sprintf("usage:%s:month:%s", userID, at.Format("2006-01"))
+}
+
+// window reads the usage stored under a key
+func (t *UsageTracker) window(ctx context.Context, key string) (UsageWindow, error) {
+	values, err := t.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return UsageWindow{}, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	var w UsageWindow
+	w.PromptTokens, _ = strconv.Atoi(values["prompt_tokens"])
+	w.CompletionTokens, _ = strconv.Atoi(values["completion_tokens"])
+	w.CachedTokens, _ = strconv.Atoi(values["cached_tokens"])
+	w.ReasoningTokens, _ = strconv.Atoi(values["reasoning_tokens"])
+	w.Requests, _ = strconv.Atoi(values["requests"])
+	w.Cost, _ = strconv.ParseFloat(values["cost"], 64)
+	w.TotalTokens = w.PromptTokens + w.CompletionTokens
+	return w, nil
+}
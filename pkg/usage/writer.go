@@ -0,0 +1,209 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record is the token usage of one completion
+type Record struct {
+	UserID           string
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+
+	// CachedTokens is the part of PromptTokens read from the provider's
+	// prompt cache, and ReasoningTokens the part of CompletionTokens spent
+	// on reasoning
+	CachedTokens    int
+	ReasoningTokens int
+
+	// Time is when the completion was made; recorders set it
+	Time time.Time
+}
+
+// UsageStore persists usage records in batches. WriteUsage must not keep
+// the records slice, which is reused for later batches.
+type UsageStore interface {
+	WriteUsage(ctx context.Context, records []Record) error
+}
+
+// multiStore writes records to several stores
+type multiStore []UsageStore
+
+// MultiStore returns a store writing records to each of stores, such as
+// the Redis counters budgets are checked against and a Postgres history
+func MultiStore(stores ...UsageStore) UsageStore {
+	return multiStore(stores)
+}
+
+// WriteUsage implements UsageStore, writing to every store even if some
+// fail
+func (m multiStore) WriteUsage(ctx context.Context, records []Record) error {
+	var errs []error
+	for _, store := range m {
+		if err := store.WriteUsage(ctx, records); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Recorder records the usage of completions. It is implemented by
+// UsageTracker, which writes each record as it is made, and UsageWriter,
+// which batches them.
+type Recorder interface {
+	Record(record Record) error
+}
+
+// ErrWriterClosed is returned for records made after a writer is closed
+var ErrWriterClosed = errors.New("usage writer closed")
+
+// overloadSampleEvery is the fraction of records kept, one in this many,
+// once a writer's buffer is three quarters full. Sampling leaves room for
+// records of every user rather than only those made first.
+const overloadSampleEvery = 10
+
+// WriterConfig configures a UsageWriter
+type WriterConfig struct {
+	// BufferSize is the number of records held awaiting a flush
+	BufferSize int
+
+	// BatchSize is the most records written to the store at once
+	BatchSize int
+
+	// FlushInterval is the longest a record is held before it is written
+	FlushInterval time.Duration
+}
+
+// UsageWriter records usage off the request path. Records are buffered and
+// written to a UsageStore in batches by a background goroutine. Recording
+// never blocks: as the buffer fills up records are sampled, and once it is
+// full they are dropped.
+type UsageWriter struct {
+	store   UsageStore
+	config  WriterConfig
+	records chan Record
+	now     func() time.Time
+
+	offered atomic.Uint64
+	dropped atomic.Int64
+
+	closed bool
+	mu     sync.RWMutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewUsageWriter creates a usage writer and starts flushing it to store.
+// Close it to write the records still buffered.
+func NewUsageWriter(store UsageStore, config WriterConfig) *UsageWriter {
+	w := &UsageWriter{
+		store:   store,
+		config:  config,
+		records: make(chan Record, config.BufferSize),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Record buffers the usage of a completion to be written with the next
+// batch
+func (w *UsageWriter) Record(record Record) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	if len(w.records) >= cap(w.records)*3/4 && w.offered.Add(1)%overloadSampleEvery != 0 {
+		w.dropped.Add(1)
+		return nil
+	}
+	record.Time = w.now()
+	select {
+	case w.records <- record:
+	default:
+		w.dropped.Add(1)
+	}
+	return nil
+}
+
+// Close stops accepting records and writes those still buffered, waiting
+// until they are written or ctx is done
+func (w *UsageWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes the buffered records in batches until the writer is closed
+func (w *UsageWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, w.config.BatchSize)
+	add := func(record Record) {
+		batch = append(batch, record)
+		if len(batch) >= w.config.BatchSize {
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case record := <-w.records:
+			add(record)
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		case <-w.stop:
+			for {
+				select {
+				case record := <-w.records:
+					add(record)
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes a batch of records to the store
+func (w *UsageWriter) flush(batch []Record) {
+	if dropped := w.dropped.Swap(0); dropped > 0 {
+		log.Printf("Dropped %d usage records: buffer full", dropped)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.store.WriteUsage(ctx, batch); err != nil {
+		log.Printf("Failed to write %d usage records: %v", len(batch), err)
+	}
+}
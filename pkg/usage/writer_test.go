@@ -0,0 +1,100 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore keeps the records written to it
+type memoryStore struct {
+	mu      sync.Mutex
+	records []Record
+	batches []int
+	block   chan struct{}
+}
+
+func (s *memoryStore) WriteUsage(ctx context.Context, records []Record) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	s.batches = append(s.batches, len(records))
+	return nil
+}
+
+func TestUsageWriterFlushesEveryRecord(t *testing.T) {
+	store := &memoryStore{}
+	w := NewUsageWriter(store, WriterConfig{BufferSize: 1000, BatchSize: 100, FlushInterval: time.Hour})
+
+	for i := 0; i < 250; i++ {
+		assert.NoError(t, w.Record(Record{UserID: "user-1", Provider: "openai", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5}))
+	}
+	assert.NoError(t, w.Close(context.Background()))
+
+	assert.Len(t, store.records, 250)
+	for _, size := range store.batches {
+		assert.LessOrEqual(t, size, 100)
+	}
+	assert.Equal(t, Record{UserID: "user-1", Provider: "openai", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5, Time: store.records[0].Time}, store.records[0])
+
+	assert.ErrorIs(t, w.Record(Record{UserID: "user-1", Provider: "openai", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5}), ErrWriterClosed)
+}
+
+// failingStore fails every write
+type failingStore struct{}
+
+func (failingStore) WriteUsage(ctx context.Context, records []Record) error {
+	return errors.New("connection refused")
+}
+
+func TestMultiStoreWritesEveryStore(t *testing.T) {
+	store := &memoryStore{}
+	err := MultiStore(failingStore{}, store).WriteUsage(context.Background(), []Record{{UserID: "user-1"}})
+	assert.EqualError(t, err, "connection refused")
+	assert.Len(t, store.records, 1)
+}
+
+func TestUsageWriterFlushesOnInterval(t *testing.T) {
+	store := &memoryStore{}
+	w := NewUsageWriter(store, WriterConfig{BufferSize: 10, BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer w.Close(context.Background())
+
+	assert.NoError(t, w.Record(Record{UserID: "user-1", Provider: "openai", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5}))
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.records) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestUsageWriterSamplesWhenFull(t *testing.T) {
+	store := &memoryStore{block: make(chan struct{})}
+	w := NewUsageWriter(store, WriterConfig{BufferSize: 40, BatchSize: 1, FlushInterval: time.Hour})
+
+	// With the store stalled, recording neither blocks nor buffers more
+	// than the buffer holds
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			w.Record(Record{UserID: "user-1", Provider: "openai", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("recording blocked on a stalled store")
+	}
+
+	close(store.block)
+	assert.NoError(t, w.Close(context.Background()))
+	assert.Greater(t, len(store.records), 30)
+	assert.LessOrEqual(t, len(store.records), 41)
+}
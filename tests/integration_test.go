@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,10 +10,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/stretchr/testify/assert"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/providers"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/ratelimit"
 	"github.com/sanketny8/ai-gateway-microservices/pkg/router"
+	"github.com/stretchr/testify/assert"
 )
 
 // MockProvider is a mock LLM provider for testing
@@ -22,7 +23,7 @@ func (m *MockProvider) Name() string {
 	return "mock"
 }
 
-func (m *MockProvider) ChatCompletion(req *providers.ChatRequest) (*providers.ChatResponse, error) {
+func (m *MockProvider) ChatCompletion(ctx context.Context, req *providers.ChatRequest) (*providers.ChatResponse, error) {
 	return &providers.ChatResponse{
 		ID:      "mock-123",
 		Object:  "chat.completion",
@@ -46,10 +47,30 @@ func (m *MockProvider) ChatCompletion(req *providers.ChatRequest) (*providers.Ch
 	}, nil
 }
 
+func (m *MockProvider) Models(ctx context.Context) ([]providers.ModelInfo, error) {
+	return []providers.ModelInfo{
+		{ID: "mock-model", Object: "model", OwnedBy: "mock", Capabilities: providers.ModelCapabilities{Chat: true}},
+	}, nil
+}
+
+func (m *MockProvider) Embeddings(ctx context.Context, req *providers.EmbeddingRequest) (*providers.EmbeddingResponse, error) {
+	data := make([]providers.Embedding, len(req.Input))
+	for i := range req.Input {
+		data[i] = providers.Embedding{Object: "embedding", Index: i, Embedding: []float64{float64(i), 0.5}}
+	}
+	return &providers.EmbeddingResponse{
+		Object: "list",
+		Data:   data,
+		Model:  req.Model,
+		Usage:  providers.EmbeddingUsage{PromptTokens: len(req.Input), TotalTokens: len(req.Input)},
+	}, nil
+}
+
 func setupTestRouter() *router.Router {
 	rateLimiter := ratelimit.NewRateLimiter(100, 1.0)
 	r := router.NewRouter(nil, rateLimiter) // nil cache for testing
 	r.RegisterProvider("mock", &MockProvider{})
+	r.SetModelRoute("mock-*", "mock")
 	return r
 }
 
@@ -89,11 +110,37 @@ func TestChatCompletion(t *testing.T) {
 	assert.Equal(t, "This is a mock response", resp.Choices[0].Message.Content)
 }
 
+func TestChatCompletionWithNilCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := setupTestRouter() // nil cache: every lookup misses, nothing is stored
+
+	ginRouter := gin.New()
+	ginRouter.POST("/v1/chat/completions", r.HandleChatCompletion)
+
+	body, _ := json.Marshal(providers.ChatRequest{
+		Model:    "mock-model",
+		Messages: []providers.Message{{Role: "user", Content: "Hello"}},
+		Stream:   false,
+	})
+
+	// Repeat the request so both the lookup and the store paths run twice
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "test-user")
+		w := httptest.NewRecorder()
+
+		assert.NotPanics(t, func() { ginRouter.ServeHTTP(w, req) })
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
 func TestRateLimiting(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	rateLimiter := ratelimit.NewRateLimiter(2, 0.1) // 2 requests capacity, slow refill
 	r := router.NewRouter(nil, rateLimiter)
 	r.RegisterProvider("mock", &MockProvider{})
+	r.SetModelRoute("mock-*", "mock")
 
 	ginRouter := gin.New()
 	ginRouter.POST("/v1/chat/completions", r.HandleChatCompletion)
@@ -129,3 +176,26 @@ func TestRateLimiting(t *testing.T) {
 	assert.Equal(t, http.StatusTooManyRequests, w3.Code)
 }
 
+func TestListModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := setupTestRouter()
+
+	ginRouter := gin.New()
+	ginRouter.GET("/v1/models", r.HandleListModels)
+
+	req, _ := http.NewRequest("GET", "/v1/models", nil)
+	w := httptest.NewRecorder()
+	ginRouter.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Object string                `json:"object"`
+		Data   []providers.ModelInfo `json:"data"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "list", resp.Object)
+	assert.Len(t, resp.Data, 1)
+	assert.Equal(t, "mock-model", resp.Data[0].ID)
+}